@@ -0,0 +1,105 @@
+package wavmaker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// ACIDInfo is the contents of an "acid" chunk, which loop libraries use so that DAWs know the
+// tempo and length in beats. A loop (OneShot false) with Stretch set is what DAWs time-stretch
+// to the song tempo. RootNote only means anything with RootNoteSet; it's a MIDI note number
+// (60 is middle C). A zero meter is written as 4/4.
+
+type ACIDInfo struct {
+	OneShot bool
+	RootNoteSet bool
+	Stretch bool
+	DiskBased bool
+	RootNote uint16
+	Beats uint32
+	MeterDenominator uint16
+	MeterNumerator uint16
+	Tempo float32				// BPM
+
+	other_flags uint32			// Flag bits we don't interpret, kept for the round trip
+	reserved uint16				// Unknown fields, likewise; a new chunk gets the usual values
+	reserved_float float32
+	reserved_set bool
+}
+
+const (
+	acid_one_shot = 0x01
+	acid_root_note_set = 0x02
+	acid_stretch = 0x04
+	acid_disk_based = 0x08
+
+	acid_chunk_size = 24
+)
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (info *ACIDInfo) encode() []byte {
+
+	b := make([]byte, acid_chunk_size)
+	bo := binary.LittleEndian
+
+	flags := info.other_flags
+	if info.OneShot { flags |= acid_one_shot }
+	if info.RootNoteSet { flags |= acid_root_note_set }
+	if info.Stretch { flags |= acid_stretch }
+	if info.DiskBased { flags |= acid_disk_based }
+
+	reserved := uint16(0x8000)			// As written by ACID itself
+	if info.reserved_set {
+		reserved = info.reserved
+	}
+
+	den, num := info.MeterDenominator, info.MeterNumerator
+	if den == 0 && num == 0 {
+		den, num = 4, 4
+	}
+
+	bo.PutUint32(b[0:], flags)
+	bo.PutUint16(b[4:], info.RootNote)
+	bo.PutUint16(b[6:], reserved)
+	bo.PutUint32(b[8:], math.Float32bits(info.reserved_float))
+	bo.PutUint32(b[12:], info.Beats)
+	bo.PutUint16(b[16:], den)
+	bo.PutUint16(b[18:], num)
+	bo.PutUint32(b[20:], math.Float32bits(info.Tempo))
+
+	return b
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func parse_acid(b []byte) (*ACIDInfo, error) {
+
+	if len(b) < acid_chunk_size {
+		return nil, fmt.Errorf("parse_acid(): chunk is %d bytes, expected %d", len(b), acid_chunk_size)
+	}
+
+	bo := binary.LittleEndian
+	flags := bo.Uint32(b[0:])
+
+	return &ACIDInfo{
+		OneShot: flags & acid_one_shot != 0,
+		RootNoteSet: flags & acid_root_note_set != 0,
+		Stretch: flags & acid_stretch != 0,
+		DiskBased: flags & acid_disk_based != 0,
+		RootNote: bo.Uint16(b[4:]),
+		Beats: bo.Uint32(b[12:]),
+		MeterDenominator: bo.Uint16(b[16:]),
+		MeterNumerator: bo.Uint16(b[18:]),
+		Tempo: math.Float32frombits(bo.Uint32(b[20:])),
+
+		other_flags: flags &^ (acid_one_shot | acid_root_note_set | acid_stretch | acid_disk_based),
+		reserved: bo.Uint16(b[6:]),
+		reserved_float: math.Float32frombits(bo.Uint32(b[8:])),
+		reserved_set: true,
+	}, nil
+}
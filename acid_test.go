@@ -0,0 +1,152 @@
+package wavmaker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func acid_chunk(flags uint32, reserved uint16) []byte {
+
+	// An acid chunk laid out by hand: root note 57, 8 beats of 3/4 at 96 BPM.
+
+	b := make([]byte, acid_chunk_size)
+	bo := binary.LittleEndian
+
+	bo.PutUint32(b[0:], flags)
+	bo.PutUint16(b[4:], 57)
+	bo.PutUint16(b[6:], reserved)
+	bo.PutUint32(b[12:], 8)
+	bo.PutUint16(b[16:], 4)
+	bo.PutUint16(b[18:], 3)
+	bo.PutUint32(b[20:], 0x42c00000)		// 96.0
+
+	return b
+}
+
+
+func TestACIDFlags(t *testing.T) {
+
+	// Each flag bit on its own, both ways.
+
+	flags := []struct {
+		bit uint32
+		get func(info *ACIDInfo) bool
+	}{
+		{0x01, func(info *ACIDInfo) bool { return info.OneShot }},
+		{0x02, func(info *ACIDInfo) bool { return info.RootNoteSet }},
+		{0x04, func(info *ACIDInfo) bool { return info.Stretch }},
+		{0x08, func(info *ACIDInfo) bool { return info.DiskBased }},
+	}
+
+	for _, f := range flags {
+
+		chunk := acid_chunk(f.bit, 0x8000)
+
+		info, err := parse_acid(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, other := range flags {
+			if other.get(info) != (other.bit == f.bit) {
+				t.Fatalf("flags %#x: flag %#x read as %v", f.bit, other.bit, other.get(info))
+			}
+		}
+
+		if !bytes.Equal(info.encode(), chunk) {
+			t.Fatalf("flags %#x: encoded as % x, expected % x", f.bit, info.encode(), chunk)
+		}
+	}
+}
+
+
+func TestACIDFields(t *testing.T) {
+
+	info, err := parse_acid(acid_chunk(0x06, 0x8000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ACIDInfo{RootNoteSet: true, Stretch: true, RootNote: 57, Beats: 8, MeterDenominator: 4, MeterNumerator: 3, Tempo: 96}
+
+	if info.OneShot != want.OneShot || info.RootNoteSet != want.RootNoteSet || info.Stretch != want.Stretch ||
+		info.DiskBased != want.DiskBased || info.RootNote != want.RootNote || info.Beats != want.Beats ||
+		info.MeterDenominator != want.MeterDenominator || info.MeterNumerator != want.MeterNumerator || info.Tempo != want.Tempo {
+		t.Fatalf("parsed %+v, expected %+v", *info, want)
+	}
+
+	if _, err := parse_acid(make([]byte, acid_chunk_size - 1)); err == nil {
+		t.Fatalf("a short chunk was accepted")
+	}
+}
+
+
+func TestACIDPreservesUnknowns(t *testing.T) {
+
+	// Flag bits we don't know and the reserved fields come back as they were, even after the
+	// known flags are changed.
+
+	chunk := acid_chunk(0x1f0 | 0x04, 0x1234)
+	binary.LittleEndian.PutUint32(chunk[8:], 0x3f800000)
+
+	info, err := parse_acid(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(info.encode(), chunk) {
+		t.Fatalf("encoded as % x, expected % x", info.encode(), chunk)
+	}
+
+	info.Stretch = false
+	info.OneShot = true
+
+	b := info.encode()
+
+	if flags := binary.LittleEndian.Uint32(b[0:]) ; flags != 0x1f0 | 0x01 {
+		t.Fatalf("flags after editing were %#x, expected %#x", flags, 0x1f0 | 0x01)
+	}
+	if !bytes.Equal(b[4:], chunk[4:]) {
+		t.Fatalf("editing the flags changed the rest of the chunk")
+	}
+}
+
+
+func TestACIDNewChunkDefaults(t *testing.T) {
+
+	// A chunk made from scratch gets ACID's 0x8000 in the reserved field, and a zero meter
+	// becomes 4/4.
+
+	b := (&ACIDInfo{Stretch: true, Beats: 4, Tempo: 120}).encode()
+	bo := binary.LittleEndian
+
+	if reserved := bo.Uint16(b[6:]) ; reserved != 0x8000 {
+		t.Fatalf("reserved field was %#x, expected 0x8000", reserved)
+	}
+	if bo.Uint16(b[16:]) != 4 || bo.Uint16(b[18:]) != 4 {
+		t.Fatalf("a zero meter was written as %d/%d", bo.Uint16(b[18:]), bo.Uint16(b[16:]))
+	}
+	if bo.Uint32(b[0:]) != 0x04 {
+		t.Fatalf("flags were %#x, expected 0x04", bo.Uint32(b[0:]))
+	}
+}
+
+
+func TestACIDSaveLoad(t *testing.T) {
+
+	wav := New(100)
+	wav.ACID = &ACIDInfo{Stretch: true, RootNoteSet: true, RootNote: 60, Beats: 16, Tempo: 133.5}
+
+	again, err := LoadBytes(wav.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.ACID == nil || !bytes.Equal(again.ACID.encode(), wav.ACID.encode()) {
+		t.Fatalf("the acid chunk didn't survive Save() and Load(): %+v", again.ACID)
+	}
+	if again.ACID.Tempo != 133.5 || again.ACID.RootNote != 60 || !again.ACID.Stretch {
+		t.Fatalf("loaded back as %+v", *again.ACID)
+	}
+}
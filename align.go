@@ -0,0 +1,126 @@
+package wavmaker
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const align_min_frames = 1 << 20		// Least audio examined by AlignOffset
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) AlignOffset(other *WAV, max_offset_frames uint32) (int64, float64) {
+
+	// Finds how far this WAV's audio lags the other's, i.e. the offset such that frame n of the
+	// other best matches frame n + offset of this one, searching ±max_offset_frames. The score
+	// is the normalised cross-correlation at that offset (1 is a perfect match). The correlation
+	// is done by FFT; only the start of each file is examined (the greater of about 2^20 frames
+	// and 4 * max_offset_frames), which is plenty for lining up two recordings of one event.
+
+	limit := max(align_min_frames, 4 * int(max_offset_frames))
+
+	a := wav.mono_floats(limit)
+	b := other.mono_floats(limit)
+
+	if len(a) == 0 || len(b) == 0 {
+		return 0, 0
+	}
+
+	size := next_pow2(len(a) + len(b))
+
+	fa := make([]complex128, size)
+	fb := make([]complex128, size)
+
+	for i, v := range a {
+		fa[i] = complex(v, 0)
+	}
+	for i, v := range b {
+		fb[i] = complex(v, 0)
+	}
+
+	fft(fa, false)
+	fft(fb, false)
+
+	for i := range fa {
+		fa[i] *= cmplx.Conj(fb[i])
+	}
+
+	fft(fa, true)		// fa[k] is now sum over n of a[n + k] * b[n], with negative k wrapped around
+
+	best_lag, best := int64(0), math.Inf(-1)
+
+	for lag := -int64(max_offset_frames) ; lag <= int64(max_offset_frames) ; lag++ {
+
+		if lag >= int64(len(a)) || -lag >= int64(len(b)) {
+			continue
+		}
+
+		v := real(fa[(lag + int64(size)) % int64(size)])
+
+		if v > best {
+			best_lag, best = lag, v
+		}
+	}
+
+	// Normalise by the energy of the overlapping parts...
+
+	var energy_a, energy_b float64
+
+	for n := int64(0) ; n < int64(len(b)) ; n++ {
+		if n + best_lag >= 0 && n + best_lag < int64(len(a)) {
+			energy_a += a[n + best_lag] * a[n + best_lag]
+			energy_b += b[n] * b[n]
+		}
+	}
+
+	if energy_a == 0 || energy_b == 0 {
+		return best_lag, 0
+	}
+
+	return best_lag, math.Max(-1, math.Min(1, best / math.Sqrt(energy_a * energy_b)))		// Clamped against rounding
+}
+
+
+func (wav *WAV) AlignTo(other *WAV, max_offset_frames uint32) (int64, float64) {
+
+	// Finds the offset as AlignOffset does and applies it in place, trimming frames from the
+	// start (if this WAV lags) or padding the start with silence (if it leads), so that the two
+	// then line up frame for frame. Returns the offset and score.
+
+	offset, score := wav.AlignOffset(other, max_offset_frames)
+
+	stride := uint32(wav.FmtChunk.BlockAlign)
+
+	if offset > 0 {
+		wav.own_data()
+		wav.DataChunk.Data = wav.DataChunk.Data[uint32(offset) * stride:wav.DataChunk.Size]
+		wav.DataChunk.Size = uint32(len(wav.DataChunk.Data))
+	} else if offset < 0 {
+		padding := make([]byte, uint32(-offset) * stride, uint32(-offset) * stride + wav.DataChunk.Size)
+		wav.DataChunk.Data = append(padding, wav.DataChunk.Data[:wav.DataChunk.Size]...)
+		wav.DataChunk.Size = uint32(len(wav.DataChunk.Data))
+		wav.borrowed = false
+	}
+
+	return offset, score
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) mono_floats(limit int) []float64 {
+
+	// The first (at most) limit frames, channels averaged.
+
+	frames := min(int(wav.FrameCount()), limit)
+	ret := make([]float64, frames)
+
+	for n := 0 ; n < frames ; n++ {
+		left, right := wav.Get(uint32(n))
+		ret[n] = (float64(left) + float64(right)) / 2
+	}
+
+	return ret
+}
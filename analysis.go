@@ -0,0 +1,440 @@
+package wavmaker
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"sync"
+)
+
+// BlockMeter holds levels for one block of frames, as fractions of full scale.
+
+type BlockMeter struct {
+	LeftPeak float64
+	RightPeak float64
+	LeftRMS float64
+	RightRMS float64
+}
+
+// ChannelStats summarises one channel. DCOffset is the mean sample value as a fraction of full
+// scale; FullScale counts samples at exactly 32767 or -32768.
+
+type ChannelStats struct {
+	Min int16
+	Max int16
+	PeakDB float64
+	RMSDB float64
+	DCOffset float64
+	FullScale uint64
+}
+
+// Region is a span of frames [Start, End) in one channel (0 is left, 1 is right).
+
+type Region struct {
+	Start uint32
+	End uint32
+	Channel int
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) Peak() float64 {
+
+	// Returns the largest absolute sample value as a fraction of full scale, where -32768 counts as 1.0.
+
+	var mutex sync.Mutex
+	peak := int32(0)
+
+	parallel_frames(wav.FrameCount(), func(start, end uint32) error {
+
+		local_peak := int32(0)
+
+		for n := start ; n < end ; n++ {
+
+			left, right := wav.Get(n)
+
+			if abs32(int32(left)) > local_peak {
+				local_peak = abs32(int32(left))
+			}
+			if abs32(int32(right)) > local_peak {
+				local_peak = abs32(int32(right))
+			}
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if local_peak > peak {
+			peak = local_peak
+		}
+		return nil
+	})
+
+	return float64(peak) / 32768
+}
+
+
+func (wav *WAV) PeakDB() float64 {
+	return to_db(wav.Peak())		// -Inf for silence
+}
+
+
+func (wav *WAV) RMS() float64 {
+
+	// Returns the root mean square of all samples (both channels together) as a fraction of full scale.
+
+	frames := wav.FrameCount()
+	if frames == 0 {
+		return 0
+	}
+
+	sum := 0.0
+
+	for n := uint32(0) ; n < frames ; n++ {
+		left, right := wav.Get(n)
+		sum += float64(left) * float64(left) + float64(right) * float64(right)
+	}
+
+	return math.Sqrt(sum / float64(frames * 2)) / 32768
+}
+
+
+func (wav *WAV) RMSDB() float64 {
+	return to_db(wav.RMS())			// -Inf for silence
+}
+
+
+func (wav *WAV) PhaseCorrelation() float64 {
+
+	// Returns the correlation between the channels as a phase meter shows it: +1 when they're
+	// identical (including mono), 0 when unrelated, -1 when one is the other inverted. Values near
+	// or below 0 mean a mono fold-down will lose a lot. Digital silence gives +1, since it folds
+	// to mono perfectly; if only one channel is silent the result is 0.
+
+	return wav.phase_correlation(0, wav.FrameCount())
+}
+
+
+func (wav *WAV) PhaseCorrelationWindowed(window_frames uint32) []float64 {
+
+	// As PhaseCorrelation, but for consecutive blocks of window_frames, so entry i covers frames
+	// starting at i * window_frames. The final block may be short.
+
+	var ret []float64
+
+	if window_frames == 0 {
+		return ret
+	}
+
+	frames := wav.FrameCount()
+
+	for start := uint32(0) ; start < frames ; {
+		end := start + min(window_frames, frames - start)		// Can't overflow
+		ret = append(ret, wav.phase_correlation(start, end))
+		start = end
+	}
+
+	return ret
+}
+
+
+func (wav *WAV) Meter(block_frames uint32) []BlockMeter {
+
+	// Peak and RMS levels for consecutive blocks, in one pass. Entry i covers frames starting at
+	// i * block_frames; the final block may be short.
+
+	var ret []BlockMeter
+
+	if block_frames == 0 {
+		return ret
+	}
+
+	frames := wav.FrameCount()
+	fast := wav.fast_16_stereo()
+	data := wav.DataChunk.Data
+
+	for start := uint32(0) ; start < frames ; {
+
+		end := start + min(block_frames, frames - start)
+
+		var left_peak, right_peak int32
+		var left_sum, right_sum float64
+
+		for n := start ; n < end ; n++ {
+
+			var left, right int16
+
+			if fast {
+				left  = int16(binary.LittleEndian.Uint16(data[n * 4:]))
+				right = int16(binary.LittleEndian.Uint16(data[n * 4 + 2:]))
+			} else {
+				left, right = wav.Get(n)
+			}
+
+			left_peak = max(left_peak, abs32(int32(left)))
+			right_peak = max(right_peak, abs32(int32(right)))
+
+			left_sum += float64(left) * float64(left)
+			right_sum += float64(right) * float64(right)
+		}
+
+		count := float64(end - start)
+
+		ret = append(ret, BlockMeter{
+			LeftPeak: float64(left_peak) / 32768,
+			RightPeak: float64(right_peak) / 32768,
+			LeftRMS: math.Sqrt(left_sum / count) / 32768,
+			RightRMS: math.Sqrt(right_sum / count) / 32768,
+		})
+
+		start = end
+	}
+
+	return ret
+}
+
+
+func (wav *WAV) TruePeakDB() (float64, float64) {
+
+	// Estimates the inter-sample peak of each channel in dBTP, by 4x oversampling with a windowed
+	// sinc interpolator (16 taps per phase) in the spirit of BS.1770. This catches peaks between
+	// samples that an ordinary Peak() misses, so it can exceed 0 dB even for unclipped audio.
+
+	frames := wav.FrameCount()
+
+	// Precompute the filter for the three in-between phases...
+
+	const half = 8
+	var taps [3][2 * half]float64
+
+	for p := 1 ; p <= 3 ; p++ {
+		for k := -half + 1 ; k <= half ; k++ {
+			t := float64(p) / 4 - float64(k)
+			window := 0.5 * (1 + math.Cos(math.Pi * t / half))
+			taps[p - 1][k + half - 1] = sinc(t) * window
+		}
+	}
+
+	get := func(n int64, right bool) float64 {
+		if n < 0 || n >= int64(frames) {
+			return 0
+		}
+		l, r := wav.Get(uint32(n))
+		if right {
+			return float64(r)
+		}
+		return float64(l)
+	}
+
+	var peaks [2]float64
+
+	for ch, right := range []bool{false, true} {
+
+		peak := 0.0
+
+		for n := int64(0) ; n < int64(frames) ; n++ {
+
+			peak = math.Max(peak, math.Abs(get(n, right)))
+
+			for p := 0 ; p < 3 ; p++ {
+				sum := 0.0
+				for k := -half + 1 ; k <= half ; k++ {
+					sum += get(n + int64(k), right) * taps[p][k + half - 1]
+				}
+				peak = math.Max(peak, math.Abs(sum))
+			}
+		}
+
+		peaks[ch] = to_db(peak / 32768)
+	}
+
+	return peaks[0], peaks[1]
+}
+
+
+func (wav *WAV) FindClipping(min_run_samples uint32) []Region {
+
+	// Finds runs of at least min_run_samples consecutive samples at full scale (32767 or -32768)
+	// in each channel, which is the usual sign of clipping. Regions are sorted by start frame,
+	// left before right on ties. A mono WAV only reports channel 0.
+
+	var ret []Region
+
+	frames := wav.FrameCount()
+	channels := 2
+	if wav.FmtChunk.NumChannels == 1 {
+		channels = 1
+	}
+
+	var run_start [2]uint32
+	var in_run [2]bool
+
+	finish := func(ch int, end uint32) {
+		if in_run[ch] && end - run_start[ch] >= max(min_run_samples, 1) {
+			ret = append(ret, Region{run_start[ch], end, ch})
+		}
+		in_run[ch] = false
+	}
+
+	for n := uint32(0) ; n < frames ; n++ {
+
+		left, right := wav.Get(n)
+
+		vals := [2]int16{left, right}
+
+		for ch, val := range vals[:channels] {
+			if val == 32767 || val == -32768 {
+				if !in_run[ch] {
+					run_start[ch] = n
+					in_run[ch] = true
+				}
+			} else {
+				finish(ch, n)
+			}
+		}
+	}
+
+	for ch := 0 ; ch < channels ; ch++ {
+		finish(ch, frames)
+	}
+
+	sort.Slice(ret, func(a, b int) bool {
+		if ret[a].Start != ret[b].Start {
+			return ret[a].Start < ret[b].Start
+		}
+		return ret[a].Channel < ret[b].Channel
+	})
+
+	return ret
+}
+
+
+func (wav *WAV) Stats() (ChannelStats, ChannelStats) {
+
+	// Everything in ChannelStats for the left and right channels, in a single pass. An empty WAV
+	// gives zero values, with -Inf for the dB figures.
+
+	frames := wav.FrameCount()
+	fast := wav.fast_16_stereo()
+	data := wav.DataChunk.Data
+
+	var mins, maxes [2]int16
+	var sums, squares [2]int64		// int64 is enough for the squares of 2^32 full scale samples
+	var full [2]uint64
+
+	for ch := 0 ; ch < 2 ; ch++ {
+		mins[ch], maxes[ch] = 32767, -32768
+	}
+
+	accumulate := func(ch int, v int16) {
+		if v < mins[ch] { mins[ch] = v }
+		if v > maxes[ch] { maxes[ch] = v }
+		sums[ch] += int64(v)
+		squares[ch] += int64(v) * int64(v)
+		if v == 32767 || v == -32768 { full[ch]++ }
+	}
+
+	for n := uint32(0) ; n < frames ; n++ {
+
+		var left, right int16
+
+		if fast {
+			left  = int16(binary.LittleEndian.Uint16(data[n * 4:]))
+			right = int16(binary.LittleEndian.Uint16(data[n * 4 + 2:]))
+		} else {
+			left, right = wav.Get(n)
+		}
+
+		accumulate(0, left)
+		accumulate(1, right)
+	}
+
+	var ret [2]ChannelStats
+
+	for ch := 0 ; ch < 2 ; ch++ {
+
+		if frames == 0 {
+			ret[ch] = ChannelStats{PeakDB: math.Inf(-1), RMSDB: math.Inf(-1)}
+			continue
+		}
+
+		peak := max(abs32(int32(mins[ch])), abs32(int32(maxes[ch])))
+
+		ret[ch] = ChannelStats{
+			Min: mins[ch],
+			Max: maxes[ch],
+			PeakDB: to_db(float64(peak) / 32768),
+			RMSDB: to_db(math.Sqrt(float64(squares[ch]) / float64(frames)) / 32768),
+			DCOffset: float64(sums[ch]) / float64(frames) / 32768,
+			FullScale: full[ch],
+		}
+	}
+
+	return ret[0], ret[1]
+}
+
+
+func (wav *WAV) Histogram(bins uint32) ([]uint64, []uint64) {
+
+	// Counts the left and right samples into equal-width bins covering -32768 to 32767, so that
+	// bin 0 starts at -32768 and the last bin ends at 32767. A bins value of 0 (or anything over
+	// 65536) gives the exact mode, with one bin per possible value; bin i then counts i - 32768.
+
+	if bins == 0 || bins > 65536 {
+		bins = 65536
+	}
+
+	left_counts := make([]uint64, bins)
+	right_counts := make([]uint64, bins)
+
+	frames := wav.FrameCount()
+
+	for n := uint32(0) ; n < frames ; n++ {
+		left, right := wav.Get(n)
+		left_counts[(uint32(int32(left) + 32768) * bins) >> 16]++
+		right_counts[(uint32(int32(right) + 32768) * bins) >> 16]++
+	}
+
+	return left_counts, right_counts
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) phase_correlation(start, end uint32) float64 {
+
+	var lr, ll, rr float64
+
+	for n := start ; n < end ; n++ {
+		left, right := wav.Get(n)
+		lr += float64(left) * float64(right)
+		ll += float64(left) * float64(left)
+		rr += float64(right) * float64(right)
+	}
+
+	if ll == 0 && rr == 0 {
+		return 1
+	}
+	if ll == 0 || rr == 0 {
+		return 0
+	}
+
+	return lr / math.Sqrt(ll * rr)
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func to_db(fraction float64) float64 {
+	return 20 * math.Log10(fraction)
+}
+
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi * x) / (math.Pi * x)
+}
@@ -0,0 +1,32 @@
+package wavmaker
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTruePeakBetweenSamples(t *testing.T) {
+
+	// The classic case: a sine at a quarter of the sample rate, phased so every sample lands 45
+	// degrees off a crest. Scaled so the samples reach full scale, the samples read 0 dBFS but the
+	// wave itself peaks about 3 dB higher.
+
+	wav := New(PREFERRED_FREQ)
+
+	for n := uint32(0) ; n < wav.FrameCount() ; n++ {
+		val := int16(math.Round(32767 * math.Sqrt2 * math.Sin(2 * math.Pi * 11025 * float64(n) / PREFERRED_FREQ + math.Pi / 4)))
+		wav.Set(n, val, -val)
+	}
+
+	if peak := to_db(wav.Peak()) ; peak < -0.01 {
+		t.Fatalf("sample peak is %.2f dBFS, expected 0", peak)
+	}
+
+	left, right := wav.TruePeakDB()
+
+	for _, db := range []float64{left, right} {
+		if db <= 0 || math.Abs(db - 3.01) > 0.3 {
+			t.Fatalf("true peak is %.2f, %.2f dBTP, expected about +3", left, right)
+		}
+	}
+}
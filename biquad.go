@@ -0,0 +1,392 @@
+package wavmaker
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Filters here are biquads built from the well-known "Audio EQ Cookbook" formulas by Robert
+// Bristow-Johnson, run in Direct Form I at float64 precision, once per channel. Results are
+// rounded and clamped back to 16 bits.
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64		// Normalised so a0 is 1
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) EQ3(low_gain_db, mid_gain_db, high_gain_db float64, low_cross_hz, high_cross_hz float64) (uint32, error) {
+
+	// A basic three band EQ: a low shelf at low_cross_hz, a high shelf at high_cross_hz, and a
+	// peaking band centred (geometrically) between them, as wide as the gap. A band with a gain
+	// of 0 is skipped entirely, so all zero gains leave the audio exactly as it was. Returns the
+	// number of samples clamped.
+
+	nyquist := float64(wav.FmtChunk.SampleRate) / 2
+
+	if !(low_cross_hz > 0 && low_cross_hz < high_cross_hz && high_cross_hz < nyquist) {
+		return 0, fmt.Errorf("EQ3(): need 0 < low crossover < high crossover < %v Hz", nyquist)
+	}
+
+	rate := float64(wav.FmtChunk.SampleRate)
+	centre := math.Sqrt(low_cross_hz * high_cross_hz)
+
+	var filters []biquad
+
+	if low_gain_db != 0 {
+		filters = append(filters, low_shelf(rate, low_cross_hz, low_gain_db))
+	}
+	if mid_gain_db != 0 {
+		filters = append(filters, peaking(rate, centre, mid_gain_db, centre / (high_cross_hz - low_cross_hz)))
+	}
+	if high_gain_db != 0 {
+		filters = append(filters, high_shelf(rate, high_cross_hz, high_gain_db))
+	}
+
+	return wav.apply_biquads(filters), nil
+}
+
+
+func (wav *WAV) PeakingEQ(freq_hz, gain_db, q float64) (uint32, error) {
+
+	// A single parametric band, boosting (positive gain) or cutting (negative) around freq_hz
+	// with the given Q. A gain of 0 changes nothing. Returns the number of samples clamped.
+
+	if !(freq_hz > 0 && freq_hz < float64(wav.FmtChunk.SampleRate) / 2) || !(q > 0) {
+		return 0, fmt.Errorf("PeakingEQ(): need 0 < frequency < %v Hz and Q > 0", float64(wav.FmtChunk.SampleRate) / 2)
+	}
+
+	if gain_db == 0 {
+		return 0, nil
+	}
+
+	return wav.apply_biquads([]biquad{peaking(float64(wav.FmtChunk.SampleRate), freq_hz, gain_db, q)}), nil
+}
+
+
+func (wav *WAV) LowShelf(freq_hz, gain_db float64) (uint32, error) {
+
+	// Boosts or cuts everything below freq_hz by gain_db, with a gentle (S = 1) slope. Corner
+	// frequencies right at the extremes are pulled in slightly so the filter stays well behaved.
+
+	if !(freq_hz > 0 && freq_hz < float64(wav.FmtChunk.SampleRate) / 2) {
+		return 0, fmt.Errorf("LowShelf(): need 0 < frequency < %v Hz", float64(wav.FmtChunk.SampleRate) / 2)
+	}
+
+	if gain_db == 0 {
+		return 0, nil
+	}
+
+	return wav.apply_biquads([]biquad{low_shelf(float64(wav.FmtChunk.SampleRate), freq_hz, gain_db)}), nil
+}
+
+
+func (wav *WAV) HighShelf(freq_hz, gain_db float64) (uint32, error) {
+
+	// As LowShelf, but for everything above freq_hz.
+
+	if !(freq_hz > 0 && freq_hz < float64(wav.FmtChunk.SampleRate) / 2) {
+		return 0, fmt.Errorf("HighShelf(): need 0 < frequency < %v Hz", float64(wav.FmtChunk.SampleRate) / 2)
+	}
+
+	if gain_db == 0 {
+		return 0, nil
+	}
+
+	return wav.apply_biquads([]biquad{high_shelf(float64(wav.FmtChunk.SampleRate), freq_hz, gain_db)}), nil
+}
+
+
+func (wav *WAV) Notch(freq_hz, q float64) (uint32, error) {
+
+	// Removes a narrow band around freq_hz; higher Q is narrower. Returns the clamp count.
+
+	if !(freq_hz > 0 && freq_hz < float64(wav.FmtChunk.SampleRate) / 2) || !(q > 0) {
+		return 0, fmt.Errorf("Notch(): need 0 < frequency < %v Hz and Q > 0", float64(wav.FmtChunk.SampleRate) / 2)
+	}
+
+	return wav.apply_biquads([]biquad{notch(float64(wav.FmtChunk.SampleRate), freq_hz, q)}), nil
+}
+
+
+func (wav *WAV) RemoveHum(fundamental_hz float64, harmonics int) (uint32, error) {
+
+	// Notches out mains hum (usually 50 or 60 Hz) plus the given number of harmonics above it,
+	// so 0 removes just the fundamental. The notches have a Q of 10, which leaves music an octave
+	// away essentially untouched.
+
+	const hum_q = 10
+
+	if harmonics < 0 || !(fundamental_hz > 0) {
+		return 0, fmt.Errorf("RemoveHum(): need a positive fundamental and harmonics >= 0")
+	}
+
+	highest := fundamental_hz * float64(harmonics + 1)
+	if highest >= float64(wav.FmtChunk.SampleRate) / 2 {
+		return 0, fmt.Errorf("RemoveHum(): highest harmonic (%v Hz) is not below Nyquist", highest)
+	}
+
+	var filters []biquad
+
+	for k := 1 ; k <= harmonics + 1 ; k++ {
+		filters = append(filters, notch(float64(wav.FmtChunk.SampleRate), fundamental_hz * float64(k), hum_q))
+	}
+
+	return wav.apply_biquads(filters), nil
+}
+
+
+func (wav *WAV) FilterSweep(start_hz, end_hz, q float64, lowpass bool) (uint32, error) {
+
+	// A resonant low-pass (or high-pass) filter whose cutoff moves exponentially from start_hz to
+	// end_hz over the length of the WAV, in place. Coefficients are recomputed every 64 frames
+	// (under 2 ms at 44100 Hz), which is smooth enough to be inaudible. Q is limited to 20, as
+	// higher values ring excessively. If start_hz equals end_hz the result is the same as that
+	// static filter. Returns the clamp count.
+
+	const block = 64
+
+	nyquist := float64(wav.FmtChunk.SampleRate) / 2
+
+	if !(start_hz > 0 && start_hz < nyquist && end_hz > 0 && end_hz < nyquist) || !(q > 0) {
+		return 0, fmt.Errorf("FilterSweep(): need frequencies between 0 and %v Hz and Q > 0", nyquist)
+	}
+
+	q = min(q, 20)
+
+	rate := float64(wav.FmtChunk.SampleRate)
+	frames := wav.FrameCount()
+
+	make_filter := lowpass_biquad
+	if !lowpass {
+		make_filter = highpass_biquad
+	}
+
+	return wav.apply_filter(func(signal []float64) {
+
+		var x1, x2, y1, y2 float64
+
+		for start := 0 ; start < len(signal) ; start += block {
+
+			freq := start_hz * math.Pow(end_hz / start_hz, float64(start) / float64(max(frames, 1)))
+			f := make_filter(rate, freq, q)
+
+			for i := start ; i < min(start + block, len(signal)) ; i++ {
+				x := signal[i]
+				y := f.b0 * x + f.b1 * x1 + f.b2 * x2 - f.a1 * y1 - f.a2 * y2
+				x2, x1 = x1, x
+				y2, y1 = y1, y
+				signal[i] = y
+			}
+		}
+	}), nil
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) apply_biquads(filters []biquad) uint32 {
+
+	// Runs the filters in series over each channel, in place. Returns the clamped sample count.
+
+	if len(filters) == 0 {
+		return 0
+	}
+
+	return wav.apply_filter(func(signal []float64) {
+		for _, f := range filters {
+			f.process(signal)
+		}
+	})
+}
+
+
+func (wav *WAV) apply_filter(process func(signal []float64)) uint32 {
+
+	// Calls process on each channel, as float64 sample values, and writes the results back. The
+	// channels are independent, so may be processed at the same time; process must allow that.
+
+	frames := wav.FrameCount()
+
+	channels := 2
+	if wav.FmtChunk.NumChannels == 1 {
+		channels = 1
+	}
+
+	out := make([][]float64, channels)
+
+	parallel_channels(channels, frames, func(ch int) {
+
+		signal := make([]float64, frames)
+
+		for n := uint32(0) ; n < frames ; n++ {
+			left, right := wav.Get(n)
+			if ch == 0 {
+				signal[n] = float64(left)
+			} else {
+				signal[n] = float64(right)
+			}
+		}
+
+		process(signal)
+		out[ch] = signal
+	})
+
+	if channels == 1 {
+		out = append(out, out[0])		// Set() averages the two for mono
+	}
+
+	var mutex sync.Mutex
+	clipped := uint32(0)
+
+	wav.own_data()
+
+	parallel_frames(frames, func(start, end uint32) error {
+
+		local_clipped := uint32(0)
+
+		for n := start ; n < end ; n++ {
+
+			left, left_clipped := round_clamp(out[0][n])
+			right, right_clipped := round_clamp(out[1][n])
+
+			if left_clipped { local_clipped++ }
+			if right_clipped && channels == 2 { local_clipped++ }
+
+			wav.Set(n, left, right)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		clipped += local_clipped
+		return nil
+	})
+
+	return clipped
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func (f biquad) process(signal []float64) {
+
+	// In place, Direct Form I.
+
+	var x1, x2, y1, y2 float64
+
+	for i, x := range signal {
+		y := f.b0 * x + f.b1 * x1 + f.b2 * x2 - f.a1 * y1 - f.a2 * y2
+		x2, x1 = x1, x
+		y2, y1 = y1, y
+		signal[i] = y
+	}
+}
+
+
+func cookbook_w0(rate, freq float64) float64 {
+
+	// The angular frequency, with the frequency kept away from DC and Nyquist where the formulas
+	// degenerate.
+
+	freq = max(1, min(rate * 0.499, freq))
+	return 2 * math.Pi * freq / rate
+}
+
+
+func normalise_biquad(b0, b1, b2, a0, a1, a2 float64) biquad {
+	return biquad{b0 / a0, b1 / a0, b2 / a0, a1 / a0, a2 / a0}
+}
+
+
+func peaking(rate, freq, gain_db, q float64) biquad {
+
+	a := math.Pow(10, gain_db / 40)
+	w0 := cookbook_w0(rate, freq)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+
+	return normalise_biquad(
+		1 + alpha * a, -2 * cos, 1 - alpha * a,
+		1 + alpha / a, -2 * cos, 1 - alpha / a)
+}
+
+
+func low_shelf(rate, freq, gain_db float64) biquad {
+
+	// Shelf slope S = 1, the steepest without overshoot.
+
+	a := math.Pow(10, gain_db / 40)
+	w0 := cookbook_w0(rate, freq)
+	alpha := math.Sin(w0) / 2 * math.Sqrt2
+	cos := math.Cos(w0)
+	sq := 2 * math.Sqrt(a) * alpha
+
+	return normalise_biquad(
+		a * ((a + 1) - (a - 1) * cos + sq), 2 * a * ((a - 1) - (a + 1) * cos), a * ((a + 1) - (a - 1) * cos - sq),
+		(a + 1) + (a - 1) * cos + sq, -2 * ((a - 1) + (a + 1) * cos), (a + 1) + (a - 1) * cos - sq)
+}
+
+
+func high_shelf(rate, freq, gain_db float64) biquad {
+
+	a := math.Pow(10, gain_db / 40)
+	w0 := cookbook_w0(rate, freq)
+	alpha := math.Sin(w0) / 2 * math.Sqrt2
+	cos := math.Cos(w0)
+	sq := 2 * math.Sqrt(a) * alpha
+
+	return normalise_biquad(
+		a * ((a + 1) + (a - 1) * cos + sq), -2 * a * ((a - 1) + (a + 1) * cos), a * ((a + 1) + (a - 1) * cos - sq),
+		(a + 1) - (a - 1) * cos + sq, 2 * ((a - 1) - (a + 1) * cos), (a + 1) - (a - 1) * cos - sq)
+}
+
+
+func notch(rate, freq, q float64) biquad {
+
+	w0 := cookbook_w0(rate, freq)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+
+	return normalise_biquad(
+		1, -2 * cos, 1,
+		1 + alpha, -2 * cos, 1 - alpha)
+}
+
+
+func lowpass_biquad(rate, freq, q float64) biquad {
+
+	w0 := cookbook_w0(rate, freq)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+
+	return normalise_biquad(
+		(1 - cos) / 2, 1 - cos, (1 - cos) / 2,
+		1 + alpha, -2 * cos, 1 - alpha)
+}
+
+
+func highpass_biquad(rate, freq, q float64) biquad {
+
+	w0 := cookbook_w0(rate, freq)
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+
+	return normalise_biquad(
+		(1 + cos) / 2, -(1 + cos), (1 + cos) / 2,
+		1 + alpha, -2 * cos, 1 - alpha)
+}
+
+
+func round_clamp(v float64) (int16, bool) {
+
+	v = math.Round(v)
+
+	if v < -32768 { return -32768, true }
+	if v >  32767 { return  32767, true }
+
+	return int16(v), false
+}
@@ -0,0 +1,245 @@
+package wavmaker
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func gain_at(t *testing.T, freq float64, filter func(wav *WAV) (uint32, error)) float64 {
+
+	// Measures a filter's gain in dB at one frequency: two seconds of sine in, filtered, and the
+	// RMS of the second second (by then the filter has settled) compared before and after. Whole
+	// numbers of Hz make that a whole number of cycles.
+
+	wav := New(2 * PREFERRED_FREQ)
+
+	for n := uint32(0) ; n < wav.FrameCount() ; n++ {
+		val := int16(math.Round(8000 * math.Sin(2 * math.Pi * freq * float64(n) / PREFERRED_FREQ)))
+		wav.Set(n, val, val)
+	}
+
+	before := wav.Copy()
+
+	clipped, err := filter(wav)
+	if err != nil || clipped != 0 {
+		t.Fatalf("filter failed, or clamped %d samples: %v", clipped, err)
+	}
+
+	rms := func(w *WAV) float64 {
+		var sum float64
+		for n := uint32(PREFERRED_FREQ) ; n < w.FrameCount() ; n++ {
+			left, _ := w.Get(n)
+			sum += float64(left) * float64(left)
+		}
+		return math.Sqrt(sum / PREFERRED_FREQ)
+	}
+
+	return to_db(rms(wav) / rms(before))
+}
+
+
+func TestEQ3BandGains(t *testing.T) {
+
+	// At each band's centre (a quarter of the low crossover, the geometric middle, and four times
+	// the high crossover or as near as the rate allows) the gain should be as asked within 0.5 dB.
+
+	configs := []struct{ low, mid, high, low_cross, high_cross float64 }{
+		{6, -6, 6, 200, 4000},
+		{4, -3, 5, 250, 2500},
+		{-6, 6, -6, 100, 5000},
+		{-2, 0, 3, 300, 3000},
+	}
+
+	for _, c := range configs {
+
+		centres := []float64{
+			math.Round(c.low_cross / 4),
+			math.Round(math.Sqrt(c.low_cross * c.high_cross)),
+			math.Round(min(c.high_cross * 4, 0.9 * PREFERRED_FREQ / 2)),
+		}
+
+		for i, want := range []float64{c.low, c.mid, c.high} {
+
+			got := gain_at(t, centres[i], func(wav *WAV) (uint32, error) {
+				return wav.EQ3(c.low, c.mid, c.high, c.low_cross, c.high_cross)
+			})
+
+			if math.Abs(got - want) > 0.5 {
+				t.Errorf("EQ3%v: gain at %v Hz is %.2f dB, expected %v", c, centres[i], got, want)
+			}
+		}
+	}
+}
+
+
+func TestEQ3Passthrough(t *testing.T) {
+
+	wav := noise_wav(10000, 3)
+	want := wav.Copy()
+
+	if _, err := wav.EQ3(0, 0, 0, 200, 4000); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wav.DataChunk.Data, want.DataChunk.Data) {
+		t.Fatalf("all zero gains changed the audio")
+	}
+
+	for _, cross := range [][2]float64{{0, 4000}, {4000, 200}, {200, 22050}} {
+		if _, err := wav.EQ3(3, 3, 3, cross[0], cross[1]); err == nil {
+			t.Fatalf("crossovers %v were accepted", cross)
+		}
+	}
+}
+
+
+func TestBiquadCoefficients(t *testing.T) {
+
+	// Reference values worked out separately from the Audio EQ Cookbook formulas (shelves with
+	// S = 1), normalised so a0 is 1.
+
+	cases := []struct {
+		name string
+		got biquad
+		want biquad
+	}{
+		{"peaking(48000, 1000, 6, 1)", peaking(48000, 1000, 6, 1),
+			biquad{1.043953086990, -1.895320723937, 0.867722284760, -1.895320723937, 0.911675371750}},
+		{"peaking(44100, 3200, -9, 4)", peaking(44100, 3200, -9, 4),
+			biquad{0.945429825671, -1.643828285807, 0.885409272915, -1.643828285807, 0.830839098586}},
+		{"low_shelf(44100, 200, 6)", low_shelf(44100, 200, 6),
+			biquad{1.007017439791, -1.965814454212, 0.959924830847, -1.966095738827, 0.966660986022}},
+		{"high_shelf(48000, 8000, -4)", high_shelf(48000, 8000, -4),
+			biquad{0.739665724473, -0.367563410894, 0.159448628069, -0.737999011332, 0.269549952980}},
+		{"notch(44100, 60, 10)", notch(44100, 60, 10),
+			biquad{0.999572760246, -1.999072474426, 0.999572760246, -1.999072474426, 0.999145520492}},
+	}
+
+	for _, c := range cases {
+		got := []float64{c.got.b0, c.got.b1, c.got.b2, c.got.a1, c.got.a2}
+		want := []float64{c.want.b0, c.want.b1, c.want.b2, c.want.a1, c.want.a2}
+		for i := range got {
+			if math.Abs(got[i] - want[i]) > 1e-9 {
+				t.Errorf("%s: coefficients %v, expected %v", c.name, got, want)
+				break
+			}
+		}
+	}
+}
+
+
+func TestPeakingEQ(t *testing.T) {
+
+	// Boosts and cuts both reach their gain at the centre; 0 dB changes nothing.
+
+	for _, gain := range []float64{6, -9} {
+		got := gain_at(t, 3200, func(wav *WAV) (uint32, error) { return wav.PeakingEQ(3200, gain, 4) })
+		if math.Abs(got - gain) > 0.1 {
+			t.Errorf("PeakingEQ(3200, %v, 4): gain at 3200 Hz is %.2f dB", gain, got)
+		}
+	}
+
+	wav := noise_wav(10000, 4)
+	want := wav.Copy()
+
+	wav.PeakingEQ(3200, 0, 4)
+
+	if !bytes.Equal(wav.DataChunk.Data, want.DataChunk.Data) {
+		t.Fatalf("a gain of 0 dB changed the audio")
+	}
+}
+
+
+func TestShelfConvergence(t *testing.T) {
+
+	// Well past the corner (two octaves or more) a shelf should give its full gain on one side
+	// and nothing on the other.
+
+	for _, gain := range []float64{6, -6, 3, -12} {
+
+		low := func(wav *WAV) (uint32, error) { return wav.LowShelf(400, gain) }
+		high := func(wav *WAV) (uint32, error) { return wav.HighShelf(4000, gain) }
+
+		for _, freq := range []float64{20, 40, 60, 100} {
+			if got := gain_at(t, freq, low) ; math.Abs(got - gain) > 0.5 {
+				t.Errorf("LowShelf(400, %v): gain at %v Hz is %.2f dB", gain, freq, got)
+			}
+		}
+		for _, freq := range []float64{1600, 3200, 8000, 16000} {
+			if got := gain_at(t, freq, low) ; math.Abs(got) > 0.5 {
+				t.Errorf("LowShelf(400, %v): gain at %v Hz is %.2f dB, expected 0", gain, freq, got)
+			}
+		}
+		for _, freq := range []float64{16000, 18000, 20000} {
+			if got := gain_at(t, freq, high) ; math.Abs(got - gain) > 0.5 {
+				t.Errorf("HighShelf(4000, %v): gain at %v Hz is %.2f dB", gain, freq, got)
+			}
+		}
+		for _, freq := range []float64{50, 250, 500, 1000} {
+			if got := gain_at(t, freq, high) ; math.Abs(got) > 0.5 {
+				t.Errorf("HighShelf(4000, %v): gain at %v Hz is %.2f dB, expected 0", gain, freq, got)
+			}
+		}
+	}
+}
+
+
+func TestShelfExtremeCorners(t *testing.T) {
+
+	// Corners at (nearly) DC and Nyquist mustn't make the filters unstable; mid-band audio just
+	// passes through.
+
+	filters := map[string]func(wav *WAV) (uint32, error){
+		"LowShelf(0.001)": func(wav *WAV) (uint32, error) { return wav.LowShelf(0.001, 12) },
+		"HighShelf(22049.9)": func(wav *WAV) (uint32, error) { return wav.HighShelf(22049.9, 12) },
+	}
+
+	for name, filter := range filters {
+		if got := gain_at(t, 1000, filter) ; math.IsNaN(got) || math.Abs(got) > 0.5 {
+			t.Errorf("%s: gain at 1000 Hz is %.2f dB, expected 0", name, got)
+		}
+	}
+}
+
+
+func TestNotchDepth(t *testing.T) {
+
+	// Over 30 dB down at the centre, under 1 dB an octave either side.
+
+	for _, q := range []float64{5, 10} {
+
+		notch := func(wav *WAV) (uint32, error) { return wav.Notch(1000, q) }
+
+		if got := gain_at(t, 1000, notch) ; got > -30 {
+			t.Errorf("Notch(1000, %v): only %.1f dB at the centre", q, got)
+		}
+		for _, freq := range []float64{500, 2000} {
+			if got := gain_at(t, freq, notch) ; got < -1 {
+				t.Errorf("Notch(1000, %v): %.2f dB at %v Hz", q, got, freq)
+			}
+		}
+	}
+}
+
+
+func TestRemoveHum(t *testing.T) {
+
+	hum := func(wav *WAV) (uint32, error) { return wav.RemoveHum(50, 3) }
+
+	for _, freq := range []float64{50, 100, 150, 200} {
+		if got := gain_at(t, freq, hum) ; got > -30 {
+			t.Errorf("RemoveHum(50, 3): only %.1f dB at %v Hz", got, freq)
+		}
+	}
+	for _, freq := range []float64{25, 400} {
+		if got := gain_at(t, freq, hum) ; got < -1 {
+			t.Errorf("RemoveHum(50, 3): %.2f dB at %v Hz, an octave from the nearest notch", got, freq)
+		}
+	}
+
+	// 60 Hz times 368 is past 22050 Hz.
+
+	if _, err := New(10).RemoveHum(60, 367); err == nil {
+		t.Fatalf("a harmonic above Nyquist was accepted")
+	}
+}
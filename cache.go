@@ -0,0 +1,197 @@
+package wavmaker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheStatistics reports on the LoadCached() cache. Bytes counts audio data only.
+
+type CacheStatistics struct {
+	Hits uint64
+	Misses uint64
+	Entries int
+	Bytes int64
+}
+
+const DEFAULT_CACHE_MAX_BYTES = 256 << 20
+
+// A cached WAV is keyed on its absolute path, and only used while the file's size and
+// modification time are as they were when it was loaded.
+
+type cache_entry struct {
+	wav *WAV				// Never handed out; callers get copies
+	mod_time time.Time
+	size int64
+	last_used uint64		// Value of cache.clock when last hit, for eviction
+}
+
+type cache_load struct {	// A load in progress, which other goroutines wanting the same file wait for
+	done chan struct{}
+	wav *WAV
+	err error
+}
+
+var cache = struct {
+	mutex sync.Mutex
+	entries map[string]*cache_entry
+	loading map[string]*cache_load
+	max_bytes int64
+	bytes int64
+	clock uint64
+	hits uint64
+	misses uint64
+}{
+	entries: make(map[string]*cache_entry),
+	loading: make(map[string]*cache_load),
+	max_bytes: DEFAULT_CACHE_MAX_BYTES,
+}
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func LoadCached(filename string) (*WAV, error) {
+
+	// Like Load(), but remembers the result, so loading the same unchanged file again is just a
+	// Copy(). Safe for concurrent use; if several goroutines ask for the same file at once, it's
+	// only decoded once. Failed loads aren't cached. When the cache grows past its limit (see
+	// SetCacheLimit), the least recently used WAVs are dropped.
+
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return &WAV{}, fmt.Errorf("LoadCached(): %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return &WAV{}, fmt.Errorf("LoadCached(): %w", err)
+	}
+
+	key := fmt.Sprintf("%s\x00%d\x00%d", path, info.Size(), info.ModTime().UnixNano())
+
+	cache.mutex.Lock()
+
+	if entry, ok := cache.entries[path]; ok {
+		if entry.size == info.Size() && entry.mod_time.Equal(info.ModTime()) {
+			cache.hits++
+			cache.clock++
+			entry.last_used = cache.clock
+			wav := entry.wav
+			cache.mutex.Unlock()
+			return wav.Copy(), nil
+		}
+		cache_remove(path)		// Stale
+	}
+
+	cache.misses++
+
+	if load, ok := cache.loading[key]; ok {
+		cache.mutex.Unlock()
+		<-load.done
+		if load.err != nil {
+			return &WAV{}, load.err
+		}
+		return load.wav.Copy(), nil
+	}
+
+	load := &cache_load{done: make(chan struct{})}
+	cache.loading[key] = load
+	cache.mutex.Unlock()
+
+	load.wav, load.err = load_file(context.Background(), path, LoadOptions{})
+
+	cache.mutex.Lock()
+	delete(cache.loading, key)
+	if load.err == nil {
+		cache_remove(path)		// In case of a race with a load of a different version
+		cache.clock++
+		cache.entries[path] = &cache_entry{load.wav, info.ModTime(), info.Size(), cache.clock}
+		cache.bytes += int64(len(load.wav.DataChunk.Data))
+		cache_evict()
+	}
+	cache.mutex.Unlock()
+
+	close(load.done)
+
+	if load.err != nil {
+		return load.wav, load.err
+	}
+	return load.wav.Copy(), nil
+}
+
+
+func CacheClear() {
+
+	// Empties the cache and resets the statistics. Loads in progress still finish.
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries = make(map[string]*cache_entry)
+	cache.bytes = 0
+	cache.hits = 0
+	cache.misses = 0
+}
+
+
+func CacheStats() CacheStatistics {
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return CacheStatistics{cache.hits, cache.misses, len(cache.entries), cache.bytes}
+}
+
+
+func SetCacheLimit(max_bytes int64) {
+
+	// Sets the most audio data the cache may hold; 0 means DEFAULT_CACHE_MAX_BYTES. A single WAV
+	// bigger than the limit is still returned by LoadCached(), just not kept.
+
+	if max_bytes <= 0 {
+		max_bytes = DEFAULT_CACHE_MAX_BYTES
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.max_bytes = max_bytes
+	cache_evict()
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func cache_remove(path string) {		// Caller must hold cache.mutex
+	if entry, ok := cache.entries[path]; ok {
+		cache.bytes -= int64(len(entry.wav.DataChunk.Data))
+		delete(cache.entries, path)
+	}
+}
+
+
+func cache_evict() {
+
+	// Drops least recently used entries until the cache is within its limit. A linear scan per
+	// eviction, which is fine for the modest number of samples a cache like this holds. Caller
+	// must hold cache.mutex.
+
+	for cache.bytes > cache.max_bytes && len(cache.entries) > 0 {
+
+		oldest := ""
+		oldest_used := ^uint64(0)
+
+		for path, entry := range cache.entries {
+			if entry.last_used < oldest_used {
+				oldest, oldest_used = path, entry.last_used
+			}
+		}
+
+		cache_remove(oldest)
+	}
+}
@@ -0,0 +1,131 @@
+package wavmaker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DiffSummary describes the result of Difference(). MaxAbs is in sample units; RMSDB is the level
+// of the difference signal (-Inf when identical); ExtraFrames is how much longer one input was
+// than the other, that part not having been compared.
+
+type DiffSummary struct {
+	MaxAbs int32
+	RMSDB float64
+	ExtraFrames uint32
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) Equal(other *WAV) bool {
+
+	// True if the format fields (including any fmt extension) and the audio bytes are identical.
+
+	return wav.same_format(other) && bytes.Equal(wav.DataChunk.Data, other.DataChunk.Data)
+}
+
+
+func (wav *WAV) ApproxEqual(other *WAV, max_delta int16) (bool, uint32) {
+
+	// True if the formats match and no sample differs by more than max_delta. When false, the
+	// second return value is the first frame that differs (or the length of the shorter WAV, if
+	// the lengths are the cause; or 0 if the formats don't even match).
+
+	if !wav.same_format(other) {
+		return false, 0
+	}
+
+	frames := wav.FrameCount()
+	if other.FrameCount() < frames {
+		frames = other.FrameCount()
+	}
+
+	for n := uint32(0) ; n < frames ; n++ {
+
+		left, right := wav.Get(n)
+		other_left, other_right := other.Get(n)
+
+		if abs32(int32(left) - int32(other_left)) > int32(max_delta) || abs32(int32(right) - int32(other_right)) > int32(max_delta) {
+			return false, n
+		}
+	}
+
+	if wav.FrameCount() != other.FrameCount() {
+		return false, frames
+	}
+
+	return true, 0
+}
+
+
+func (wav *WAV) Difference(other *WAV) (*WAV, DiffSummary, error) {
+
+	// The null test: returns a new WAV of wav minus other, per channel and clamped, over the
+	// length they have in common, plus a summary. The sample rates must match.
+
+	var summary DiffSummary
+
+	if wav.FmtChunk.SampleRate != other.FmtChunk.SampleRate {
+		return nil, summary, errors.New("Difference(): sample rates differ")
+	}
+
+	frames := min(wav.FrameCount(), other.FrameCount())
+	summary.ExtraFrames = max(wav.FrameCount(), other.FrameCount()) - frames
+
+	result, err := NewWithFormat(frames, wav.FmtChunk.SampleRate, 2)
+	if err != nil {
+		return nil, summary, fmt.Errorf("Difference(): %w", err)
+	}
+
+	sum := 0.0
+
+	for n := uint32(0) ; n < frames ; n++ {
+
+		left, right := wav.Get(n)
+		other_left, other_right := other.Get(n)
+
+		diff_left  := int32(left)  - int32(other_left)
+		diff_right := int32(right) - int32(other_right)
+
+		summary.MaxAbs = max(summary.MaxAbs, abs32(diff_left), abs32(diff_right))
+		sum += float64(diff_left) * float64(diff_left) + float64(diff_right) * float64(diff_right)
+
+		result.Set(n, clamp16(diff_left), clamp16(diff_right))
+	}
+
+	summary.RMSDB = math.Inf(-1)
+	if frames > 0 {
+		summary.RMSDB = to_db(math.Sqrt(sum / (float64(frames) * 2)) / 32768)
+	}
+
+	return result, summary, nil
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) same_format(other *WAV) bool {
+	return wav.FmtChunk == other.FmtChunk && bytes.Equal(wav.FmtExtension, other.FmtExtension)
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func abs32(x int32) int32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+
+func clamp16(x int32) int16 {
+	if x < -32768 { return -32768 }
+	if x >  32767 { return  32767 }
+	return int16(x)
+}
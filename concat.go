@@ -0,0 +1,171 @@
+package wavmaker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ConcatOptions adjusts joins in ConcatWithOptions() and AppendWithOptions(). The zero value
+// gives plain butt joins, as Concat() and Append().
+
+type ConcatOptions struct {
+	JoinFadeFrames uint32		// Overlap each join by this much, crossfading
+	JoinCurve JoinCurve			// The shape of the crossfade
+}
+
+// JoinCurve is the shape of a crossfade at a join.
+
+type JoinCurve int
+
+const (
+	JOIN_EQUAL_POWER JoinCurve = iota		// Sine / cosine, for unrelated audio
+	JOIN_LINEAR								// Straight lines, for audio that's correlated across the join
+)
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) Append(other *WAV) error {
+
+	// Adds a copy of the other WAV's audio to the end of this one. The formats must match.
+
+	if wav.FmtChunk != other.FmtChunk {
+		return errors.New("Append(): formats differ")
+	}
+	if uint64(len(wav.DataChunk.Data)) + uint64(len(other.DataChunk.Data)) > math.MaxUint32 {
+		return errors.New("Append(): result would exceed the maximum WAV size")
+	}
+
+	wav.own_data()
+	wav.DataChunk.Data = append(wav.DataChunk.Data[:wav.DataChunk.Size], other.DataChunk.Data...)
+	wav.DataChunk.Size = uint32(len(wav.DataChunk.Data))
+
+	return nil
+}
+
+
+func (wav *WAV) AppendWithOptions(other *WAV, opts ConcatOptions) error {
+
+	// As Append, but the join can be crossfaded, as in ConcatWithOptions(), shortening the result.
+
+	if opts.JoinFadeFrames == 0 {
+		return wav.Append(other)
+	}
+
+	result, err := concat([]*WAV{wav, other}, opts)
+	if err != nil {
+		return fmt.Errorf("AppendWithOptions(): %w", err)
+	}
+
+	wav.DataChunk = result.DataChunk
+	wav.borrowed = false
+
+	return nil
+}
+
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func Concat(wavs ...*WAV) (*WAV, error) {
+
+	// Joins the WAVs end to end into a new WAV. All must have the same format. With no arguments
+	// the result is an empty WAV from New(0); with one, it's a copy.
+
+	return concat(wavs, ConcatOptions{})
+}
+
+
+func ConcatCrossfaded(crossfade uint32, wavs ...*WAV) (*WAV, error) {
+
+	// As Concat, but each join overlaps the end of one WAV with the start of the next by the given
+	// number of frames, fading linearly from one to the other. So the result is shorter than the
+	// plain Concat by (crossfade * joins). Where an input is too short, its joins are shortened.
+
+	return ConcatWithOptions(ConcatOptions{JoinFadeFrames: crossfade, JoinCurve: JOIN_LINEAR}, wavs...)
+}
+
+
+func ConcatWithOptions(opts ConcatOptions, wavs ...*WAV) (*WAV, error) {
+
+	// As Concat, but with JoinFadeFrames set, each join overlaps by that many frames with a
+	// crossfade. The default, equal-power (sine / cosine) curve holds the level steady through the
+	// join when the two sides are unrelated; this hides the click that a butt join between
+	// arbitrary audio usually makes. Each join shortens the result by its overlap, which is
+	// clamped to the length of the shorter neighbour.
+
+	return concat(wavs, opts)
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func concat(wavs []*WAV, opts ConcatOptions) (*WAV, error) {
+
+	if len(wavs) == 0 {
+		return New(0), nil
+	}
+	if len(wavs) == 1 {
+		return wavs[0].Copy(), nil
+	}
+
+	// Check formats and work out the final length first, so there's only one allocation...
+
+	overlaps := make([]uint32, len(wavs))		// overlaps[i] is how much wavs[i] overlaps its predecessor
+
+	total := uint64(wavs[0].FrameCount())
+
+	for i := 1 ; i < len(wavs) ; i++ {
+
+		if wavs[i].FmtChunk != wavs[0].FmtChunk {
+			return nil, fmt.Errorf("Concat(): input %d has a different format to input 0", i)
+		}
+
+		overlaps[i] = min(opts.JoinFadeFrames, wavs[i - 1].FrameCount(), wavs[i].FrameCount())
+		total += uint64(wavs[i].FrameCount()) - uint64(overlaps[i])
+	}
+
+	if total * uint64(wavs[0].FmtChunk.BlockAlign) > math.MaxUint32 {
+		return nil, errors.New("Concat(): result would exceed the maximum WAV size")
+	}
+
+	result := wavs[0].blank_copy(uint32(total))
+	stride := uint32(wavs[0].FmtChunk.BlockAlign)
+
+	pos := uint32(0)		// Frame where the current input starts in the result
+
+	for i, wav := range wavs {
+
+		pos -= overlaps[i]
+
+		// The overlapping part is blended sample by sample; the rest is a straight copy.
+
+		for n := uint32(0) ; n < overlaps[i] ; n++ {
+
+			f := float64(n + 1) / float64(overlaps[i] + 1)
+
+			old_left, old_right := result.Get(pos + n)
+			new_left, new_right := wav.Get(n)
+
+			if opts.JoinCurve == JOIN_EQUAL_POWER {
+				out_gain, in_gain := math.Cos(f * math.Pi / 2), math.Sin(f * math.Pi / 2)
+				left, _ := round_clamp(float64(old_left) * out_gain + float64(new_left) * in_gain)
+				right, _ := round_clamp(float64(old_right) * out_gain + float64(new_right) * in_gain)
+				result.Set(pos + n, left, right)
+				continue
+			}
+
+			result.Set(pos + n,
+				int16(float64(old_left)  * (1 - f) + float64(new_left)  * f),
+				int16(float64(old_right) * (1 - f) + float64(new_right) * f))
+		}
+
+		copy(result.DataChunk.Data[(pos + overlaps[i]) * stride:], wav.DataChunk.Data[overlaps[i] * stride:wav.DataChunk.Size])
+
+		pos += wav.FrameCount()
+	}
+
+	return result, nil
+}
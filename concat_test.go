@@ -0,0 +1,76 @@
+package wavmaker
+
+import (
+	"math"
+	"testing"
+)
+
+func sine_wav(frames uint32, freq float64, phase float64) *WAV {
+
+	wav := New(frames)
+
+	for n := uint32(0) ; n < frames ; n++ {
+		val := int16(math.Round(16000 * math.Sin(2 * math.Pi * freq * float64(n) / PREFERRED_FREQ + phase)))
+		wav.Set(n, val, val)
+	}
+
+	return wav
+}
+
+
+func max_step(wav *WAV) int32 {
+
+	// The largest jump between neighbouring frames in the left channel.
+
+	step := int32(0)
+
+	for n := uint32(1) ; n < wav.FrameCount() ; n++ {
+		prev, _ := wav.Get(n - 1)
+		cur, _ := wav.Get(n)
+		step = max(step, abs32(int32(cur) - int32(prev)))
+	}
+
+	return step
+}
+
+
+func TestJoinFadeRemovesDiscontinuity(t *testing.T) {
+
+	// Two segments of a 100 Hz sine, the second out of phase with where the first leaves off, so
+	// a butt join jumps from a peak to a trough.
+
+	first := sine_wav(4410 + 110, 100, 0)			// Ends just past a positive peak
+	second := sine_wav(4410, 100, math.Pi / 2 + math.Pi)	// Starts at a negative peak
+
+	smooth := max(max_step(first), max_step(second))
+
+	butt, err := Concat(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max_step(butt) < 4 * smooth {
+		t.Fatalf("the butt join was expected to jump (step %d vs %d)", max_step(butt), smooth)
+	}
+
+	for _, curve := range []JoinCurve{JOIN_EQUAL_POWER, JOIN_LINEAR} {
+
+		joined, err := ConcatWithOptions(ConcatOptions{JoinFadeFrames: 441, JoinCurve: curve}, first, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if joined.FrameCount() != butt.FrameCount() - 441 {
+			t.Fatalf("curve %d: length %d, expected %d", curve, joined.FrameCount(), butt.FrameCount() - 441)
+		}
+		if step := max_step(joined) ; step > smooth * 3 / 2 {
+			t.Fatalf("curve %d: largest step is %d, against %d within the segments", curve, step, smooth)
+		}
+	}
+
+	linear, _ := ConcatWithOptions(ConcatOptions{JoinFadeFrames: 441, JoinCurve: JOIN_LINEAR}, first, second)
+	crossfaded, _ := ConcatCrossfaded(441, first, second)
+
+	if !linear.Equal(crossfaded) {
+		t.Fatalf("ConcatCrossfaded() differs from ConcatWithOptions() with a linear curve")
+	}
+}
@@ -0,0 +1,97 @@
+package wavmaker
+
+import (
+	"errors"
+	"math"
+)
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) PingPongDelay(delay_seconds float64, feedback float64, mix float64, extend bool) (uint32, error) {
+
+	// A stereo bounce delay, in place. The input (channels summed, so dual mono works as expected)
+	// feeds the left delay line, whose output feeds the right, whose output feeds back into the
+	// left scaled by feedback (clamped to 0-0.95). So the echoes alternate left, right, left...
+	// each feedback times quieter than the last. They're added to the dry signal at the mix
+	// level, so a mix of 0 changes nothing. With extend, the WAV is lengthened so the echoes
+	// can ring out until they're below -80 dBFS. Returns the number of samples clamped.
+
+	if wav.FmtChunk.NumChannels != 2 {
+		return 0, errors.New("PingPongDelay(): needs a stereo WAV")
+	}
+	if !(delay_seconds > 0) {
+		return 0, errors.New("PingPongDelay(): delay must be positive")
+	}
+
+	if mix == 0 {
+		return 0, nil
+	}
+
+	feedback = max(0, min(0.95, feedback))
+
+	delay := uint64(math.Round(delay_seconds * float64(wav.FmtChunk.SampleRate)))
+	if delay == 0 {
+		return 0, errors.New("PingPongDelay(): delay is shorter than a frame")
+	}
+
+	frames := uint64(wav.FrameCount())
+	total := frames
+
+	if extend {
+
+		// Echo j arrives at (j + 1) * delay with gain feedback^j; find the first that's quiet enough.
+
+		echoes := uint64(1)
+		if feedback > 0 {
+			echoes = uint64(math.Ceil(math.Log(0.0001) / math.Log(feedback))) + 1
+		}
+
+		total = frames + echoes * delay
+
+		if total * uint64(wav.FmtChunk.BlockAlign) > math.MaxUint32 {
+			return 0, errors.New("PingPongDelay(): extended WAV would exceed the maximum size")
+		}
+	}
+
+	echo_left := make([]float64, total)
+	echo_right := make([]float64, total)
+
+	input := func(n uint64) float64 {
+		if n >= frames {
+			return 0
+		}
+		left, right := wav.Get(uint32(n))
+		return (float64(left) + float64(right)) / 2
+	}
+
+	for n := delay ; n < total ; n++ {
+		echo_left[n] = input(n - delay) + feedback * echo_right[n - delay]
+		echo_right[n] = feedback * echo_left[n - delay]
+	}
+
+	if total > frames {
+		wav.own_data()
+		wav.DataChunk.Data = append(wav.DataChunk.Data[:wav.DataChunk.Size], make([]byte, (total - frames) * uint64(wav.FmtChunk.BlockAlign))...)
+		wav.DataChunk.Size = uint32(len(wav.DataChunk.Data))
+	}
+
+	clipped := uint32(0)
+
+	for n := delay ; n < total ; n++ {
+
+		left, right := wav.Get(uint32(n))
+
+		new_left  := int32(float64(left)  + echo_left[n]  * mix)
+		new_right := int32(float64(right) + echo_right[n] * mix)
+
+		if new_left  < -32768 { new_left  = -32768 ; clipped++ }
+		if new_left  >  32767 { new_left  =  32767 ; clipped++ }
+		if new_right < -32768 { new_right = -32768 ; clipped++ }
+		if new_right >  32767 { new_right =  32767 ; clipped++ }
+
+		wav.Set(uint32(n), int16(new_left), int16(new_right))
+	}
+
+	return clipped, nil
+}
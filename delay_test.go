@@ -0,0 +1,73 @@
+package wavmaker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPingPongDelayTail(t *testing.T) {
+
+	// A full scale burst, extended, against the same burst with plenty of silence after it: they
+	// should agree as far as the extension goes, and whatever the extension left out must be below
+	// -80 dBFS. With feedback, the last delay's worth of the extension is below that too.
+
+	burst := func(frames uint32) *WAV {
+		wav := New(frames)
+		for n := uint32(0) ; n < 1000 ; n++ {
+			val := int16(32767 - 65534 * int32(n % 2))
+			wav.Set(n, val, val)
+		}
+		return wav
+	}
+
+	quiet := func(wav *WAV, start, end uint32) bool {
+		for n := start ; n < end ; n++ {
+			left, right := wav.Get(n)
+			if peak := max(abs_diff(int(left), 0), abs_diff(int(right), 0)) ; to_db(float64(peak) / 32768) > -80 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, feedback := range []float64{0, 0.3, 0.5, 0.9, 0.95} {
+
+		wav := burst(1000)
+		if _, err := wav.PingPongDelay(0.1, feedback, 1, true); err != nil {
+			t.Fatal(err)
+		}
+
+		long := burst(1000 + 200 * 4410)
+		if _, err := long.PingPongDelay(0.1, feedback, 1, false); err != nil {
+			t.Fatal(err)
+		}
+
+		frames := wav.FrameCount()
+
+		if !bytes.Equal(wav.DataChunk.Data, long.DataChunk.Data[:wav.DataChunk.Size]) {
+			t.Fatalf("feedback %v: the extended WAV differs from the padded one", feedback)
+		}
+		if !quiet(long, frames, long.FrameCount()) {
+			t.Fatalf("feedback %v: the extension (to %d frames) cut off echoes above -80 dBFS", feedback, frames)
+		}
+		if feedback > 0 && !quiet(wav, frames - 4410, frames) {
+			t.Fatalf("feedback %v: the last delay of the extension is above -80 dBFS", feedback)
+		}
+	}
+}
+
+
+func TestPingPongDelayZeroMix(t *testing.T) {
+
+	for _, extend := range []bool{false, true} {
+
+		wav := noise_wav(10000, 21)
+		want := wav.Copy()
+
+		clipped, err := wav.PingPongDelay(0.05, 0.8, 0, extend)
+
+		if err != nil || clipped != 0 || !bytes.Equal(wav.Bytes(), want.Bytes()) {
+			t.Fatalf("extend %v: a mix of 0 changed the WAV (%d clipped, %v)", extend, clipped, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package wavmaker
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Drum hits, synthesised from scratch. Each is a short stereo WAV (the same in both channels) at
+// the preferred rate, peak normalised to DRUM_PEAK, whose last frame is silence, so hits can be
+// dropped in with Add() without clicking. Decay times are the time to fall by 60 dB; they're
+// kept within [0.01, 10] seconds. The noise is seeded, so a given set of arguments always gives
+// the same sound.
+
+const DRUM_PEAK = 0.891		// -1 dBFS
+
+const drum_seed = 808
+const drum_tail_seconds = 0.005		// The final linear fade to silence
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func NewKick(pitch_hz, decay_s, click_amount float64) *WAV {
+
+	// A sine that sweeps down from four times pitch_hz to pitch_hz over the first 30 ms or so,
+	// plus a couple of milliseconds of noise at the start, at click_amount relative to the body
+	// (0 for none, 1 for as loud).
+
+	decay_s = drum_decay(decay_s)
+	signal := make([]float64, drum_frames(decay_s))
+
+	rng := rand.New(rand.NewSource(drum_seed))
+	phase := 0.0
+
+	for n := range signal {
+
+		t := float64(n) / PREFERRED_FREQ
+
+		freq := pitch_hz * (1 + 3 * math.Exp(-t / 0.01))
+		phase += 2 * math.Pi * freq / PREFERRED_FREQ
+
+		signal[n] = math.Sin(phase) * drum_envelope(t, decay_s)
+		signal[n] += click_amount * (rng.Float64() * 2 - 1) * drum_envelope(t, 0.002)
+	}
+
+	return drum_finish(signal)
+}
+
+
+func NewSnare(tone_hz, noise_mix, decay_s float64) *WAV {
+
+	// Two sines (tone_hz and a little over 1.5 times it) for the drum's body, which die away three
+	// times faster than the high-passed noise of the snares. noise_mix is the noise's share, from
+	// 0 (all tone) to 1 (all noise).
+
+	decay_s = drum_decay(decay_s)
+	noise_mix = math.Max(0, math.Min(1, noise_mix))
+
+	signal := make([]float64, drum_frames(decay_s))
+	noise := make([]float64, len(signal))
+
+	rng := rand.New(rand.NewSource(drum_seed))
+
+	for n := range noise {
+		noise[n] = rng.Float64() * 2 - 1
+	}
+
+	highpass_biquad(PREFERRED_FREQ, 1500, 0.707).process(noise)
+
+	for n := range signal {
+
+		t := float64(n) / PREFERRED_FREQ
+
+		tone := (math.Sin(2 * math.Pi * tone_hz * t) + 0.5 * math.Sin(2 * math.Pi * tone_hz * 1.52 * t)) / 1.5
+
+		signal[n] = (1 - noise_mix) * tone * drum_envelope(t, decay_s / 3) + noise_mix * noise[n] * drum_envelope(t, decay_s)
+	}
+
+	return drum_finish(signal)
+}
+
+
+func NewHat(decay_s, brightness float64) *WAV {
+
+	// The 808 recipe: six square waves at inharmonic frequencies, which together sound metallic,
+	// plus some noise, all high-passed. brightness runs from 0 (high-passed at 5 kHz, mostly
+	// squares) to 1 (at 10 kHz, with more noise).
+
+	squares := []float64{205.3, 304.4, 369.6, 522.7, 540.0, 800.0}
+
+	decay_s = drum_decay(decay_s)
+	brightness = math.Max(0, math.Min(1, brightness))
+
+	signal := make([]float64, drum_frames(decay_s))
+
+	rng := rand.New(rand.NewSource(drum_seed))
+
+	for n := range signal {
+
+		t := float64(n) / PREFERRED_FREQ
+
+		v := 0.0
+		for _, freq := range squares {
+			if math.Mod(t * freq, 1) < 0.5 {
+				v += 1
+			} else {
+				v -= 1
+			}
+		}
+
+		signal[n] = (1 - brightness / 2) * v / float64(len(squares)) + brightness / 2 * (rng.Float64() * 2 - 1)
+	}
+
+	highpass_biquad(PREFERRED_FREQ, 5000 + 5000 * brightness, 0.707).process(signal)
+
+	for n := range signal {
+		signal[n] *= drum_envelope(float64(n) / PREFERRED_FREQ, decay_s)
+	}
+
+	return drum_finish(signal)
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func drum_decay(decay_s float64) float64 {
+	if !(decay_s >= 0.01) { return 0.01 }		// Including NaN
+	if decay_s > 10 { return 10 }
+	return decay_s
+}
+
+
+func drum_frames(decay_s float64) int {
+	return int(math.Round(decay_s * PREFERRED_FREQ)) + 1
+}
+
+
+func drum_envelope(t, decay_s float64) float64 {
+	return math.Exp(-t / decay_s * math.Ln10 * 3)		// -60 dB at decay_s
+}
+
+
+func drum_finish(signal []float64) *WAV {
+
+	// Fades the last few milliseconds linearly down to exactly zero, normalises the peak to
+	// DRUM_PEAK, and makes the WAV.
+
+	tail := min(len(signal), int(math.Round(drum_tail_seconds * PREFERRED_FREQ)))
+
+	for i := 0 ; i < tail ; i++ {
+		signal[len(signal) - 1 - i] *= float64(i) / float64(tail)
+	}
+
+	peak := 0.0
+	for _, v := range signal {
+		peak = math.Max(peak, math.Abs(v))
+	}
+
+	scale := 0.0
+	if peak > 0 {
+		scale = DRUM_PEAK * 32767 / peak
+	}
+
+	wav := New(uint32(len(signal)))
+
+	for n, v := range signal {
+		val, _ := round_clamp(v * scale)
+		wav.Set(uint32(n), val, val)
+	}
+
+	return wav
+}
@@ -0,0 +1,149 @@
+package wavmaker
+
+import (
+	"errors"
+	"math"
+)
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) Limit(ceiling_db float64, lookahead_ms float64, release_ms float64) error {
+
+	// A brickwall limiter, in place. Gain reduction is linked across channels, ramps in over the
+	// lookahead so peaks are caught without distortion, and recovers exponentially with the
+	// release time. Since the whole file is available, the "lookahead" is done by looking into
+	// the future rather than by delaying the audio, so the output is time-aligned with the input.
+	// No output sample exceeds the ceiling.
+
+	if !(ceiling_db <= 0) {
+		return errors.New("Limit(): ceiling must be at most 0 dB")
+	}
+	if lookahead_ms < 0 || release_ms < 0 {
+		return errors.New("Limit(): lookahead and release can't be negative")
+	}
+
+	wav.limit(1, ceiling_db, lookahead_ms, release_ms)
+	return nil
+}
+
+
+func (wav *WAV) Duck(sidechain *WAV, threshold_db, reduction_db, attack_ms, release_ms float64) error {
+
+	// Sidechain ducking, in place: whenever the sidechain's level is over the threshold, this WAV
+	// is turned down by reduction_db, moving into the reduction over the attack time and back out
+	// over the release time (both exponential). Past the end of the sidechain, the gain just
+	// recovers. The sample rates must match.
+
+	if sidechain.FmtChunk.SampleRate != wav.FmtChunk.SampleRate {
+		return errors.New("Duck(): sample rates differ")
+	}
+	if reduction_db < 0 || attack_ms < 0 || release_ms < 0 {
+		return errors.New("Duck(): reduction, attack and release can't be negative")
+	}
+
+	frames := wav.FrameCount()
+	side_frames := sidechain.FrameCount()
+
+	rate := float64(wav.FmtChunk.SampleRate)
+
+	coefficient := func(ms float64) float64 {		// Fraction of the remaining distance covered per frame
+		if ms * rate / 1000 < 1 {
+			return 1
+		}
+		return 1 - math.Exp(-1 / (ms * rate / 1000))
+	}
+
+	attack := coefficient(attack_ms)
+	release := coefficient(release_ms)
+
+	threshold := 32768 * math.Pow(10, threshold_db / 20)
+	ducked := math.Pow(10, -reduction_db / 20)
+
+	level := 0.0		// Peak follower on the sidechain, holding through the gaps between cycles
+	gain := 1.0
+
+	wav.scale_range(0, frames, func(n uint32) float64 {
+
+		if n < side_frames {
+			left, right := sidechain.Get(n)
+			level = math.Max(math.Abs((float64(left) + float64(right)) / 2), level * (1 - release))
+		} else {
+			level = 0
+		}
+
+		target := 1.0
+		if level > threshold {
+			target = ducked
+		}
+
+		if target < gain {
+			gain += (target - gain) * attack
+		} else {
+			gain += (target - gain) * release
+		}
+
+		return gain
+	})
+
+	return nil
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) limit(pre_gain float64, ceiling_db float64, lookahead_ms float64, release_ms float64) {
+
+	// The body of Limit(), arguments already checked. The audio is first scaled by pre_gain, which
+	// happens in the same pass as the limiting, so raising the level can't clip on the way.
+
+	frames := wav.FrameCount()
+	if frames == 0 {
+		return
+	}
+
+	ceiling := math.Min(32767, 32768 * math.Pow(10, ceiling_db / 20))
+
+	lookahead := math.Max(1, lookahead_ms * float64(wav.FmtChunk.SampleRate) / 1000)
+	release := release_ms * float64(wav.FmtChunk.SampleRate) / 1000
+
+	// The gain each frame needs, on its own...
+
+	gains := make([]float64, frames)
+
+	for n := uint32(0) ; n < frames ; n++ {
+		left, right := wav.Get(n)
+		peak := math.Max(math.Abs(float64(left)), math.Abs(float64(right))) * pre_gain
+		gains[n] = 1
+		if peak > ceiling {
+			gains[n] = ceiling / peak
+		}
+	}
+
+	// Backwards pass: the gain may only rise by 1 / lookahead per frame, so every reduction is
+	// approached by a ramp across the lookahead window. This never raises any gain.
+
+	step := 1 / lookahead
+
+	for n := int(frames) - 2 ; n >= 0 ; n-- {
+		gains[n] = math.Min(gains[n], gains[n + 1] + step)
+	}
+
+	// Forwards pass: release. Again, this can only lower gains.
+
+	coefficient := 1.0
+	if release > 0 {
+		coefficient = 1 - math.Exp(-1 / release)
+	}
+
+	for n := uint32(1) ; n < frames ; n++ {
+		gains[n] = math.Min(gains[n], gains[n - 1] + (1 - gains[n - 1]) * coefficient)
+	}
+
+	// Truncation towards zero can't push a sample past the ceiling, since |v| * gain <= ceiling.
+
+	wav.scale_range(0, frames, func(n uint32) float64 {
+		return gains[n] * pre_gain
+	})
+}
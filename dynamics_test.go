@@ -0,0 +1,106 @@
+package wavmaker
+
+import (
+	"math"
+	"testing"
+)
+
+func square_burst(frames, start, end uint32, amplitude int16) *WAV {
+
+	// Silence, with a 441 Hz square wave from start to end; the right channel is inverted.
+
+	wav := New(frames)
+
+	for n := start ; n < end ; n++ {
+		val := amplitude
+		if (n - start) % 100 >= 50 {
+			val = -amplitude
+		}
+		wav.Set(n, val, -val)
+	}
+
+	return wav
+}
+
+
+func TestLimitSquareBurst(t *testing.T) {
+
+	// A full scale burst: nothing may exceed the ceiling, the levelled-off burst should sit just
+	// under it, and nothing should move in time - the burst starts and ends on the same frames
+	// and every sample keeps its sign.
+
+	for _, ceiling_db := range []float64{-0.1, -6, -20} {
+
+		input := square_burst(20000, 5000, 15000, 32767)
+		wav := input.Copy()
+
+		if err := wav.Limit(ceiling_db, 5, 50); err != nil {
+			t.Fatal(err)
+		}
+
+		ceiling := math.Min(32767, 32768 * math.Pow(10, ceiling_db / 20))
+
+		for n := uint32(0) ; n < wav.FrameCount() ; n++ {
+
+			left, right := wav.Get(n)
+			in_left, in_right := input.Get(n)
+
+			if math.Abs(float64(left)) > ceiling || math.Abs(float64(right)) > ceiling {
+				t.Fatalf("ceiling %v dB: frame %d is %d, %d, over %.1f", ceiling_db, n, left, right, ceiling)
+			}
+			if (left > 0) != (in_left > 0) || (left < 0) != (in_left < 0) || (right > 0) != (in_right > 0) || (right < 0) != (in_right < 0) {
+				t.Fatalf("ceiling %v dB: frame %d went from %d, %d to %d, %d", ceiling_db, n, in_left, in_right, left, right)
+			}
+		}
+
+		if left, _ := wav.Get(10000) ; float64(left) < ceiling - 2 {
+			t.Fatalf("ceiling %v dB: the middle of the burst is at %d, expected about %.1f", ceiling_db, left, ceiling)
+		}
+	}
+}
+
+
+func TestDuckBurst(t *testing.T) {
+
+	// A steady tone, ducked by half a second of loud sidechain: level as it was before the burst,
+	// down by the reduction while it lasts, and back afterwards once the release has run out.
+
+	const rate = PREFERRED_FREQ
+
+	tone := New(3 * rate)
+	for n := uint32(0) ; n < tone.FrameCount() ; n++ {
+		val := int16(math.Round(10000 * math.Sin(2 * math.Pi * 441 * float64(n) / rate)))
+		tone.Set(n, val, val)
+	}
+
+	sidechain := New(3 * rate)
+	for n := uint32(rate) ; n < rate * 3 / 2 ; n++ {
+		sidechain.Set(n, 20000, 20000)
+	}
+
+	wav := tone.Copy()
+
+	if err := wav.Duck(sidechain, -20, 12, 10, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	level := func(start, end float64) float64 {
+		got, _ := channel_rms(wav, uint32(start * rate), uint32(end * rate))
+		want, _ := channel_rms(tone, uint32(start * rate), uint32(end * rate))
+		return to_db(got / want)
+	}
+
+	if db := level(0, 1) ; math.Abs(db) > 0.01 {
+		t.Errorf("before the burst the tone was changed by %.2f dB", db)
+	}
+	if db := level(1.1, 1.5) ; math.Abs(db + 12) > 0.2 {
+		t.Errorf("during the burst the tone was changed by %.2f dB, expected -12", db)
+	}
+	if db := level(2.5, 3) ; math.Abs(db) > 0.1 {
+		t.Errorf("a second after the burst the tone was still changed by %.2f dB", db)
+	}
+
+	if err := wav.Duck(New(10), -20, -3, 10, 100); err == nil {
+		t.Errorf("a negative reduction was accepted")
+	}
+}
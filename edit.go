@@ -0,0 +1,397 @@
+package wavmaker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) Slice(start, end uint32) (*WAV, error) {
+
+	// Returns a new WAV holding a copy of frames [start, end).
+
+	if start > end || end > wav.FrameCount() {
+		return nil, fmt.Errorf("Slice(): range %d-%d is not within 0-%d", start, end, wav.FrameCount())
+	}
+
+	return wav.frames_copy(start, end), nil
+}
+
+
+func (wav *WAV) ExtractSeconds(start, end float64, fade_frames uint32) (*WAV, error) {
+
+	// Like Slice() but in seconds. The times are rounded to the nearest frame and clamped to the
+	// length of the audio. If fade_frames is non-zero, the result is faded in and out over that
+	// many frames, to avoid clicks at the cut points.
+
+	if start >= end {
+		return nil, fmt.Errorf("ExtractSeconds(): start %v was not before end %v", start, end)
+	}
+
+	total := wav.FrameCount()
+
+	start_frame := min(wav.SecondsToFrames(start), total)
+	end_frame := min(wav.SecondsToFrames(end), total)
+
+	ret := wav.frames_copy(start_frame, end_frame)
+
+	if fade_frames > 0 {
+		ret.FadeInSamples(fade_frames)
+		ret.FadeSamples(fade_frames)
+	}
+
+	return ret, nil
+}
+
+
+func (wav *WAV) NearestZeroCrossing(frame uint32, window uint32) (uint32, bool) {
+
+	// Returns the closest frame to the given one (within window frames either way) where both
+	// channels are at zero or have just changed sign. Ties go to the earlier frame. The bool is
+	// false if there's no such frame.
+
+	frames := wav.FrameCount()
+
+	for dist := uint32(0) ; dist <= window ; dist++ {
+		if frame >= dist && frame - dist < frames && wav.is_zero_crossing(frame - dist) {
+			return frame - dist, true
+		}
+		if frame + dist >= dist && frame + dist < frames && wav.is_zero_crossing(frame + dist) {		// Also checks for wrap-around
+			return frame + dist, true
+		}
+	}
+
+	return 0, false
+}
+
+
+func (wav *WAV) TrimToZeroCrossings(window uint32) (uint32, uint32) {
+
+	// Moves the start forward and the end backward (by at most window frames each) so that the
+	// audio begins and ends on zero crossings, returning how many frames were cut from each end.
+	// If an end has no crossing within the window, it's given a 16 frame fade instead, and
+	// nothing is cut there.
+
+	const micro_fade = 16
+
+	frames := wav.FrameCount()
+	if frames == 0 {
+		return 0, 0
+	}
+
+	start, start_ok := uint32(0), false
+
+	for n := uint32(0) ; n <= window && n < frames ; n++ {
+		if wav.is_zero_crossing(n) {
+			start, start_ok = n, true
+			break
+		}
+	}
+
+	// At the end we want the last frame to be a crossing in the other sense, i.e. the frame
+	// after it (if there were one) would be on the other side of zero. Equivalently, the frame
+	// after the new end is a crossing, or the last frame itself is at zero.
+
+	end, end_ok := frames, false		// end is exclusive
+
+	for n := uint32(0) ; n <= window && n < frames ; n++ {
+		candidate := frames - n
+		if wav.is_silent_frame(candidate - 1) || (candidate < frames && wav.is_zero_crossing(candidate)) {
+			end, end_ok = candidate, true
+			break
+		}
+	}
+
+	if end <= start {		// Crossings overlapped; nothing sensible to keep, so don't cut
+		start_ok, end_ok = false, false
+		start, end = 0, frames
+	}
+
+	if start_ok || end_ok {
+		stride := uint32(wav.FmtChunk.BlockAlign)
+		wav.own_data()
+		wav.DataChunk.Data = wav.DataChunk.Data[start * stride:end * stride]
+		wav.DataChunk.Size = uint32(len(wav.DataChunk.Data))
+	}
+
+	if !start_ok {
+		wav.FadeInSamples(micro_fade)
+	}
+	if !end_ok {
+		wav.FadeSamples(micro_fade)
+	}
+
+	return start, frames - end
+}
+
+
+func (wav *WAV) Stutter(start, grain_frames, repeats uint32, decay float64, insert bool) error {
+
+	// Beat-repeat: the grain [start, start + grain_frames) is played again repeats more times right
+	// after itself, the nth repeat at a gain of decay^n. With insert, the repeats push the rest of
+	// the audio later; otherwise they're written over it and the length is unchanged. Each grain's
+	// edges get a short fade, as does the audio where it resumes, so no seam clicks. The grain is
+	// clamped to the audio; an empty grain or zero repeats does nothing.
+
+	const micro_fade = 32
+
+	if !(decay >= 0) {
+		return errors.New("Stutter(): decay can't be negative")
+	}
+
+	frames := wav.FrameCount()
+
+	start = min(start, frames)
+	grain_frames = min(grain_frames, frames - start)
+
+	if grain_frames == 0 || repeats == 0 {
+		return nil
+	}
+
+	stride := uint32(wav.FmtChunk.BlockAlign)
+	grain_end := start + grain_frames
+
+	total, resume := uint64(frames), uint64(grain_end)		// resume is where the rest of the original carries on from
+
+	if insert {
+		total += uint64(grain_frames) * uint64(repeats)
+	} else {
+		resume = min(uint64(frames), uint64(grain_end) + uint64(grain_frames) * uint64(repeats))
+	}
+
+	if total * uint64(stride) > math.MaxUint32 {
+		return errors.New("Stutter(): result would exceed the maximum WAV size")
+	}
+
+	fade := min(micro_fade, grain_frames / 4)
+
+	edge := func(i uint32) float64 {		// Gain at position i within a grain
+		if fade == 0 {
+			return 1
+		}
+		return min(1, float64(i) / float64(fade), float64(grain_frames - i) / float64(fade))
+	}
+
+	result := wav.blank_copy(uint32(total))
+
+	// The audio up to the end of the grain, faded out at the very end...
+
+	copy(result.DataChunk.Data, wav.DataChunk.Data[:grain_end * stride])
+
+	result.scale_range(grain_end - fade, grain_end, func(n uint32) float64 {
+		return min(1, float64(grain_end - n) / float64(fade))
+	})
+
+	// ...the repeats, the last possibly cut short by the end of the file...
+
+	pos := grain_end
+
+	for r := uint32(1) ; r <= repeats && pos < uint32(total) ; r++ {
+
+		length := min(grain_frames, uint32(total) - pos)
+		gain := math.Pow(decay, float64(r))
+		grain_start := pos
+
+		copy(result.DataChunk.Data[pos * stride:], wav.DataChunk.Data[start * stride:(start + length) * stride])
+
+		result.scale_range(pos, pos + length, func(n uint32) float64 {
+			return gain * edge(n - grain_start)
+		})
+
+		pos += length
+	}
+
+	// ...and whatever's left, faded back in.
+
+	copy(result.DataChunk.Data[pos * stride:], wav.DataChunk.Data[uint32(resume) * stride:frames * stride])
+
+	result.scale_range(pos, min(pos + fade, uint32(total)), func(n uint32) float64 {
+		return float64(n - pos) / float64(fade)
+	})
+
+	wav.DataChunk = result.DataChunk
+	wav.borrowed = false
+
+	return nil
+}
+
+
+func (wav *WAV) ReverseRange(start, end uint32) error {
+
+	// Reverses frames [start, end) in place, whole frames at a time, so doing it twice restores the
+	// original exactly. The range is clamped to the audio.
+
+	if start > end {
+		return fmt.Errorf("ReverseRange(): start %d was after end %d", start, end)
+	}
+
+	frames := wav.FrameCount()
+	start = min(start, frames)
+	end = min(end, frames)
+
+	if end - start < 2 {
+		return nil
+	}
+
+	wav.own_data()
+
+	stride := uint32(wav.FmtChunk.BlockAlign)
+
+	// The work is split by swap, the i-th swapping frames start + i and end - 1 - i, so each
+	// worker's frames are its own.
+
+	return parallel_frames((end - start) / 2, func(first, last uint32) error {
+
+		tmp := make([]byte, stride)
+
+		for i := first ; i < last ; i++ {
+			lo, hi := start + i, end - 1 - i
+			a := wav.DataChunk.Data[lo * stride:(lo + 1) * stride]
+			b := wav.DataChunk.Data[hi * stride:(hi + 1) * stride]
+			copy(tmp, a)
+			copy(a, b)
+			copy(b, tmp)
+		}
+
+		return nil
+	})
+}
+
+
+func (wav *WAV) RepeatRange(start, end, times uint32, crossfade uint32) error {
+
+	// Inserts times more copies of frames [start, end) straight after the range, pushing the rest
+	// of the audio later. The range is clamped to the audio. If crossfade is non-zero, the start of
+	// each copy is crossfaded (linearly, over that many frames, or fewer if the range or the audio
+	// after it is shorter) from the audio that really followed the range, hiding the seam.
+
+	if start > end {
+		return fmt.Errorf("RepeatRange(): start %d was after end %d", start, end)
+	}
+
+	frames := wav.FrameCount()
+	start = min(start, frames)
+	end = min(end, frames)
+
+	length := end - start
+
+	if length == 0 || times == 0 {
+		return nil
+	}
+
+	stride := uint32(wav.FmtChunk.BlockAlign)
+	total := uint64(frames) + uint64(length) * uint64(times)
+
+	if total * uint64(stride) > math.MaxUint32 {
+		return errors.New("RepeatRange(): result would exceed the maximum WAV size")
+	}
+
+	crossfade = min(crossfade, length, frames - end)
+
+	// One allocation, the exact size; then the head, the copies, and the tail.
+
+	result := wav.blank_copy(uint32(total))
+	data := wav.DataChunk.Data
+
+	copy(result.DataChunk.Data, data[:end * stride])
+
+	for k := uint32(1) ; k <= times ; k++ {
+
+		pos := end + (k - 1) * length
+
+		copy(result.DataChunk.Data[pos * stride:], data[start * stride:end * stride])
+
+		for i := uint32(0) ; i < crossfade ; i++ {
+
+			f := float64(i + 1) / float64(crossfade + 1)
+
+			old_left, old_right := wav.Get(end + i)
+			new_left, new_right := wav.Get(start + i)
+
+			left, _ := round_clamp(float64(old_left) * (1 - f) + float64(new_left) * f)
+			right, _ := round_clamp(float64(old_right) * (1 - f) + float64(new_right) * f)
+
+			result.Set(pos + i, left, right)
+		}
+	}
+
+	copy(result.DataChunk.Data[(end + times * length) * stride:], data[end * stride:frames * stride])
+
+	wav.DataChunk = result.DataChunk
+	wav.borrowed = false
+
+	return nil
+}
+
+
+func (wav *WAV) TruncateWithFade(frames uint32, fade_frames uint32) *WAV {
+
+	// Sets the length to exactly frames, with a fade-out (as FadeSamples) over the last fade_frames
+	// of the audio that remains, clamped to its length. If the WAV is shorter than frames, it's
+	// padded with silence instead, and it's the end of the original audio that gets the fade. A
+	// length too great for a WAV is a problem reported according to the Policy, changing nothing.
+
+	if wav.Err() != nil {
+		return wav
+	}
+
+	stride := uint32(wav.FmtChunk.BlockAlign)
+	current := wav.FrameCount()
+
+	if uint64(frames) * uint64(stride) > math.MaxUint32 {
+		wav.report(problem_too_large, "TruncateWithFade() refused to extend to %d frames, which would exceed the maximum WAV size", frames)
+		return wav
+	}
+
+	wav.own_data()
+
+	if frames < current {
+		wav.DataChunk.Data = wav.DataChunk.Data[:frames * stride]
+		wav.DataChunk.Size = frames * stride
+	}
+
+	wav.FadeSamples(fade_frames)
+
+	if frames > current {
+		wav.DataChunk.Data = append(wav.DataChunk.Data[:current * stride], make([]byte, (frames - current) * stride)...)
+		wav.DataChunk.Size = frames * stride
+	}
+
+	return wav
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) is_zero_crossing(frame uint32) bool {
+
+	// True if each channel is zero here, or has the opposite sign from the frame before.
+
+	left, right := wav.Get(frame)
+
+	if frame == 0 {
+		return left == 0 && right == 0
+	}
+
+	prev_left, prev_right := wav.Get(frame - 1)
+
+	return crosses(prev_left, left) && crosses(prev_right, right)
+}
+
+
+func (wav *WAV) is_silent_frame(frame uint32) bool {
+	left, right := wav.Get(frame)
+	return left == 0 && right == 0
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func crosses(a, b int16) bool {
+	return b == 0 || (a < 0) != (b < 0)
+}
@@ -0,0 +1,142 @@
+package wavmaker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func constant_wav(frames uint32, val int16) *WAV {
+	wav := New(frames)
+	wav.Policy = POLICY_PANIC
+	for n := uint32(0) ; n < frames ; n++ {
+		wav.Set(n, val, val)
+	}
+	return wav
+}
+
+
+func TestTruncateWithFadeExact(t *testing.T) {
+
+	wav := constant_wav(1000, 10000).TruncateWithFade(600, 100)
+
+	if wav.FrameCount() != 600 || len(wav.DataChunk.Data) != 600 * 4 {
+		t.Fatalf("length is %d frames (%d bytes), expected 600", wav.FrameCount(), len(wav.DataChunk.Data))
+	}
+	if left, _ := wav.Get(499); left != 10000 {
+		t.Fatalf("frame 499, before the fade, is %d", left)
+	}
+	if left, _ := wav.Get(550); left >= 10000 || left <= 0 {
+		t.Fatalf("frame 550, halfway through the fade, is %d", left)
+	}
+	if left, _ := wav.Get(599); left > 100 {
+		t.Fatalf("the last frame is %d, not faded out", left)
+	}
+}
+
+
+func TestTruncateWithFadeClamped(t *testing.T) {
+
+	// The fade is longer than what's left, so it covers all of it.
+
+	wav := constant_wav(1000, 10000).TruncateWithFade(200, 5000)
+
+	if wav.FrameCount() != 200 {
+		t.Fatalf("length is %d frames, expected 200", wav.FrameCount())
+	}
+	if left, _ := wav.Get(0); left != 10000 {
+		t.Fatalf("the first frame is %d; the fade should start from it at full level", left)
+	}
+	if left, _ := wav.Get(100); left < 4900 || left > 5100 {
+		t.Fatalf("frame 100 is %d, expected about half level", left)
+	}
+}
+
+
+func TestTruncateWithFadePadding(t *testing.T) {
+
+	wav := constant_wav(100, 10000).TruncateWithFade(300, 50)
+
+	if wav.FrameCount() != 300 || len(wav.DataChunk.Data) != 300 * 4 {
+		t.Fatalf("length is %d frames (%d bytes), expected 300", wav.FrameCount(), len(wav.DataChunk.Data))
+	}
+	if left, _ := wav.Get(49); left != 10000 {
+		t.Fatalf("frame 49, before the fade, is %d", left)
+	}
+	if left, _ := wav.Get(99); left > 300 {
+		t.Fatalf("the last original frame is %d, not faded out", left)
+	}
+	for n := uint32(100) ; n < 300 ; n++ {
+		if left, right := wav.Get(n); left != 0 || right != 0 {
+			t.Fatalf("padding frame %d isn't silent", n)
+		}
+	}
+}
+
+
+func TestTruncateWithFadeTooLarge(t *testing.T) {
+
+	wav := constant_wav(100, 10000)
+	wav.Policy = POLICY_ERROR
+
+	wav.TruncateWithFade(1 << 31, 10)		// 8 GB of 16-bit stereo
+
+	if wav.Err() == nil {
+		t.Fatalf("an impossible length wasn't reported")
+	}
+	if wav.FrameCount() != 100 || len(wav.DataChunk.Data) != 400 {
+		t.Fatalf("the WAV was changed: %d frames, %d bytes", wav.FrameCount(), len(wav.DataChunk.Data))
+	}
+	if left, _ := wav.Get(99); left != 10000 {
+		t.Fatalf("the WAV was faded anyway")
+	}
+}
+
+
+func TestReverseRangeTwice(t *testing.T) {
+
+	// Twice over restores the original bytes, in any layout and for odd, even and clamped ranges;
+	// once over moves whole frames and leaves the rest alone.
+
+	wide := extensible_wav(1, 24)
+	for n := range wide.DataChunk.Data {
+		wide.DataChunk.Data[n] = byte(n * 7)
+	}
+
+	narrow, err := LoadWithOptions(temp_file(t, mono8_file(100)), LoadOptions{KeepFormat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, wav := range []*WAV{noise_wav(100, 17), wide, narrow} {
+
+		block := uint32(wav.FmtChunk.BlockAlign)
+
+		for _, r := range [][2]uint32{{0, 100}, {10, 21}, {10, 20}, {50, 51}, {90, 500}} {
+
+			original := append([]byte(nil), wav.DataChunk.Data...)
+
+			if err := wav.ReverseRange(r[0], r[1]); err != nil {
+				t.Fatal(err)
+			}
+
+			end := min(r[1], 100)
+
+			if !bytes.Equal(wav.DataChunk.Data[:r[0] * block], original[:r[0] * block]) || !bytes.Equal(wav.DataChunk.Data[end * block:], original[end * block:]) {
+				t.Fatalf("%d bytes per frame, range %v: frames outside the range changed", block, r)
+			}
+			if end - r[0] > 1 && !bytes.Equal(wav.DataChunk.Data[r[0] * block:(r[0] + 1) * block], original[(end - 1) * block:end * block]) {
+				t.Fatalf("%d bytes per frame, range %v: the last frame didn't move to the start", block, r)
+			}
+
+			wav.ReverseRange(r[0], r[1])
+
+			if !bytes.Equal(wav.DataChunk.Data, original) {
+				t.Fatalf("%d bytes per frame, range %v: reversing twice changed the audio", block, r)
+			}
+		}
+	}
+
+	if err := New(10).ReverseRange(5, 4); err == nil {
+		t.Fatalf("a backwards range was accepted")
+	}
+}
@@ -0,0 +1,66 @@
+package wavmaker
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func fft(x []complex128, inverse bool) {
+
+	// In-place iterative radix-2 FFT; len(x) must be a power of 2. The inverse is scaled by 1/N,
+	// so fft(fft(x, false), true) gives back x.
+
+	n := len(x)
+	if n < 2 {
+		return
+	}
+
+	shift := 64 - bits.Len(uint(n - 1))
+
+	for i := 0 ; i < n ; i++ {
+		j := int(bits.Reverse64(uint64(i)) >> shift)
+		if j > i {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1.0
+	}
+
+	for size := 2 ; size <= n ; size <<= 1 {
+
+		step := cmplx.Rect(1, sign * 2 * math.Pi / float64(size))
+
+		for start := 0 ; start < n ; start += size {
+			w := complex(1, 0)
+			for k := 0 ; k < size / 2 ; k++ {
+				a := x[start + k]
+				b := x[start + k + size / 2] * w
+				x[start + k] = a + b
+				x[start + k + size / 2] = a - b
+				w *= step
+			}
+		}
+	}
+
+	if inverse {
+		for i := range x {
+			x[i] /= complex(float64(n), 0)
+		}
+	}
+}
+
+
+func next_pow2(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
@@ -0,0 +1,83 @@
+package wavmaker
+
+import (
+	"fmt"
+	"math"
+)
+
+// Float conversion uses a full scale of 32768, i.e. a sample s becomes s / 32768. This maps -32768
+// to exactly -1.0 and 32767 to slightly under +1.0, and every int16 survives the round trip
+// unchanged. On the way back, values are rounded to the nearest integer and clamped, so +1.0
+// becomes 32767 and anything beyond the range is simply limited.
+
+const float_scale = 32768
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) ToFloat64() ([]float64, []float64) {
+
+	// Returns left and right channels as separate slices. Mono WAVs give two identical slices
+	// (as Get does).
+
+	frames := wav.FrameCount()
+
+	left := make([]float64, frames)
+	right := make([]float64, frames)
+
+	for n := uint32(0) ; n < frames ; n++ {
+		l, r := wav.Get(n)
+		left[n] = sample_to_float(l)
+		right[n] = sample_to_float(r)
+	}
+
+	return left, right
+}
+
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func FromFloat64(left, right []float64, sample_rate uint32) (*WAV, error) {
+
+	// Makes a 16-bit stereo WAV from two channel slices, which must be the same length.
+
+	if len(left) != len(right) {
+		return nil, fmt.Errorf("FromFloat64(): channel lengths differ (%d vs %d)", len(left), len(right))
+	}
+	if uint64(len(left)) > math.MaxUint32 {
+		return nil, fmt.Errorf("FromFloat64(): %d frames is too many", len(left))
+	}
+
+	wav, err := NewWithFormat(uint32(len(left)), sample_rate, 2)
+	if err != nil {
+		return nil, fmt.Errorf("FromFloat64(): %w", err)
+	}
+
+	for n := range left {
+		wav.Set(uint32(n), float_to_sample(left[n]), float_to_sample(right[n]))
+	}
+
+	return wav, nil
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func sample_to_float(s int16) float64 {
+	return float64(s) / float_scale
+}
+
+
+func float_to_sample(f float64) int16 {
+
+	v := math.Round(f * float_scale)
+
+	if math.IsNaN(v) { return 0 }		// Nothing sensible to do with NaN
+
+	if v < -32768 { v = -32768 }
+	if v >  32767 { v =  32767 }
+
+	return int16(v)
+}
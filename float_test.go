@@ -0,0 +1,75 @@
+package wavmaker
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloatRoundTripExhaustive(t *testing.T) {
+
+	// Every possible sample, in the left channel ascending and the right descending.
+
+	wav := New(65536)
+	wav.Policy = POLICY_PANIC
+
+	for n := uint32(0) ; n < 65536 ; n++ {
+		wav.Set(n, int16(n - 32768), int16(32767 - n))
+	}
+
+	left, right := wav.ToFloat64()
+
+	if left[0] != -1.0 || left[65535] >= 1.0 {
+		t.Fatalf("full scale is wrong: -32768 gave %v, 32767 gave %v", left[0], left[65535])
+	}
+
+	result, err := FromFloat64(left, right, PREFERRED_FREQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, frame := result.ApproxEqual(wav, 0); !ok {
+		l, r := result.Get(frame)
+		want_l, want_r := wav.Get(frame)
+		t.Fatalf("frame %d came back as %d, %d, expected %d, %d", frame, l, r, want_l, want_r)
+	}
+}
+
+
+func TestFromFloat64Clamping(t *testing.T) {
+
+	cases := []struct {
+		in float64
+		out int16
+	}{
+		{1.0, 32767},
+		{-1.0, -32768},
+		{2.5, 32767},
+		{-7, -32768},
+		{math.Inf(1), 32767},
+		{math.Inf(-1), -32768},
+		{math.NaN(), 0},
+		{0.4 / 32768, 0},
+		{0.6 / 32768, 1},
+		{-0.6 / 32768, -1},
+	}
+
+	for _, c := range cases {
+
+		wav, err := FromFloat64([]float64{c.in}, []float64{-c.in}, PREFERRED_FREQ)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		left, _ := wav.Get(0)
+		if left != c.out {
+			t.Errorf("%v became %d, expected %d", c.in, left, c.out)
+		}
+	}
+}
+
+
+func TestFromFloat64LengthMismatch(t *testing.T) {
+	if _, err := FromFloat64(make([]float64, 10), make([]float64, 9), PREFERRED_FREQ) ; err == nil {
+		t.Fatalf("channels of different lengths were accepted")
+	}
+}
@@ -0,0 +1,263 @@
+package wavmaker
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// EnvelopePoint is a breakpoint for ApplyGainEnvelope. Its position is Frame plus Seconds
+// (either can be left at zero), and Gain is linear, i.e. 1.0 is unchanged.
+
+type EnvelopePoint struct {
+	Frame uint32
+	Seconds float64
+	Gain float64
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) SetChannelGains(left_gain, right_gain float64) (uint32, uint32) {
+
+	// Scales each channel by its own gain, in place, returning how many samples clipped in each.
+	// A gain of exactly 1.0 leaves that channel alone. On a mono WAV the two gains are applied to
+	// the one channel and averaged, as Set() does.
+
+	if left_gain == 1.0 && right_gain == 1.0 {
+		return 0, 0
+	}
+
+	var mutex sync.Mutex
+	left_clipped, right_clipped := uint32(0), uint32(0)
+
+	wav.own_data()		// Before splitting the work, so the workers all write to the same copy
+
+	parallel_frames(wav.FrameCount(), func(start, end uint32) error {
+
+		local_left, local_right := uint32(0), uint32(0)
+
+		for n := start ; n < end ; n++ {
+
+			left, right := wav.Get(n)
+
+			if left_gain != 1.0 {
+				var clipped bool
+				left, clipped = scale_sample(left, left_gain)
+				if clipped { local_left++ }
+			}
+
+			if right_gain != 1.0 {
+				var clipped bool
+				right, clipped = scale_sample(right, right_gain)
+				if clipped { local_right++ }
+			}
+
+			wav.Set(n, left, right)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		left_clipped += local_left
+		right_clipped += local_right
+		return nil
+	})
+
+	return left_clipped, right_clipped
+}
+
+
+func (wav *WAV) Balance(position float64) *WAV {
+
+	// Position runs from -1 (left only) through 0 (unchanged) to +1 (right only). Only the far
+	// channel is touched, and it's attenuated linearly, so e.g. +0.25 leaves the right alone and
+	// scales the left by 0.75. Nothing is ever boosted, so this can't clip.
+
+	if wav.Err() != nil {
+		return wav
+	}
+
+	position = max(-1, min(1, position))
+
+	if position > 0 {
+		wav.SetChannelGains(1 - position, 1)
+	} else if position < 0 {
+		wav.SetChannelGains(1, 1 + position)
+	}
+
+	return wav
+}
+
+
+func (wav *WAV) Normalize(peak float64) *WAV {
+
+	// Scales the whole WAV so its Peak() becomes peak, a fraction of full scale within [0, 1].
+	// Silence is left alone.
+
+	if wav.Err() != nil {
+		return wav
+	}
+
+	current := wav.Peak()
+
+	if current == 0 {
+		return wav
+	}
+
+	gain := math.Max(0, math.Min(1, peak)) / current
+
+	wav.SetChannelGains(gain, gain)
+	return wav
+}
+
+
+func (wav *WAV) ApplyGainEnvelope(points []EnvelopePoint) uint32 {
+
+	// Applies DAW-style volume automation in place, interpolating linearly between the points
+	// and holding the first and last gains flat beyond them. The points needn't be sorted; where
+	// two share a position, the later one in the slice wins. Returns the number of samples that
+	// clipped (only possible with gains above 1). With no points, nothing happens.
+
+	if len(points) == 0 {
+		return 0
+	}
+
+	type breakpoint struct {
+		frame uint32
+		gain float64
+	}
+
+	var bps []breakpoint
+
+	for _, p := range points {
+		frame := uint64(p.Frame) + uint64(wav.SecondsToFrames(p.Seconds))
+		bps = append(bps, breakpoint{uint32(min(frame, uint64(^uint32(0)))), p.Gain})
+	}
+
+	sort.SliceStable(bps, func(a, b int) bool {
+		return bps[a].frame < bps[b].frame
+	})
+
+	// Drop all but the last of any run of equal positions...
+
+	deduped := bps[:1]
+
+	for _, bp := range bps[1:] {
+		if bp.frame == deduped[len(deduped) - 1].frame {
+			deduped[len(deduped) - 1] = bp
+		} else {
+			deduped = append(deduped, bp)
+		}
+	}
+
+	bps = deduped
+	i := 0			// Index of the breakpoint at or before the current frame, if any
+
+	return wav.scale_range(0, wav.FrameCount(), func(n uint32) float64 {
+
+		for i + 1 < len(bps) && bps[i + 1].frame <= n {
+			i++
+		}
+
+		if n <= bps[0].frame {
+			return bps[0].gain
+		}
+		if i == len(bps) - 1 {
+			return bps[i].gain
+		}
+
+		a, b := bps[i], bps[i + 1]
+		f := float64(n - a.frame) / float64(b.frame - a.frame)
+
+		return a.gain + (b.gain - a.gain) * f
+	})
+}
+
+
+func (wav *WAV) InvertChannel(left bool) uint32 {
+
+	// Flips the polarity of one channel (the left if left is true, else the right), leaving the
+	// other exactly as it was. -32768 has no positive counterpart so becomes 32767; the return
+	// value counts these. A mono WAV has no separate channels, so nothing is done to it.
+
+	stride, width, ok := wav.layout()
+	if !ok || wav.FmtChunk.NumChannels < 2 {
+		return 0
+	}
+
+	// This works on the bytes of the one channel directly, so the other really isn't touched.
+
+	wav.own_data()
+
+	offset := width
+	if left {
+		offset = 0
+	}
+
+	clipped := uint32(0)
+	frames := uint32(len(wav.DataChunk.Data)) / stride
+
+	for n := uint32(0) ; n < frames ; n++ {
+
+		b := wav.DataChunk.Data[n * stride + offset:]
+		val := get_sample(b, width)
+
+		if val == -32768 {
+			val = 32767
+			clipped++
+		} else {
+			val = -val
+		}
+
+		set_sample(b, width, val)
+	}
+
+	return clipped
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) scale_range(start, end uint32, gain func(n uint32) float64) uint32 {
+
+	// The common path for fades and envelopes: multiplies frames [start, end) by gain(n), which
+	// is called in order, once per frame. Returns how many samples clipped.
+
+	clipped := uint32(0)
+
+	for n := start ; n < end ; n++ {
+
+		g := gain(n)
+
+		if g == 1.0 {
+			continue
+		}
+
+		old_left, old_right := wav.Get(n)
+
+		new_left, left_clipped := scale_sample(old_left, g)
+		new_right, right_clipped := scale_sample(old_right, g)
+
+		if left_clipped { clipped++ }
+		if right_clipped { clipped++ }
+
+		wav.Set(n, new_left, new_right)
+	}
+
+	return clipped
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func scale_sample(val int16, gain float64) (int16, bool) {
+
+	v := float64(val) * gain		// Compared as a float, so huge gains can't overflow
+
+	if v <= -32769 { return -32768, true }
+	if v >=  32768 { return  32767, true }
+
+	return int16(v), false
+}
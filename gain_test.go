@@ -0,0 +1,58 @@
+package wavmaker
+
+import (
+	"testing"
+)
+
+func TestBalanceLaw(t *testing.T) {
+
+	// The far channel is scaled by 1 - |position|, the near one left alone.
+
+	cases := []struct{ position, left_gain, right_gain float64 }{
+		{-1, 1, 0},
+		{-0.75, 1, 0.25},
+		{-0.5, 1, 0.5},
+		{-0.25, 1, 0.75},
+		{0, 1, 1},
+		{0.25, 0.75, 1},
+		{0.5, 0.5, 1},
+		{0.75, 0.25, 1},
+		{1, 0, 1},
+	}
+
+	for _, c := range cases {
+
+		wav := New(10)
+		for n := uint32(0) ; n < 10 ; n++ {
+			wav.Set(n, 20000, -20000)
+		}
+
+		wav.Balance(c.position)
+
+		left, right := wav.Get(5)
+		want_left, want_right := int(20000 * c.left_gain), int(-20000 * c.right_gain)
+
+		if abs_diff(int(left), want_left) > 1 || abs_diff(int(right), want_right) > 1 {
+			t.Errorf("Balance(%v) gave %d, %d, expected %d, %d", c.position, left, right, want_left, want_right)
+		}
+	}
+}
+
+
+func TestBalanceCentreUnchanged(t *testing.T) {
+
+	wav := noise_wav(1000, 9)
+	want := wav.Copy()
+
+	if !wav.Balance(0).Equal(want) {
+		t.Fatalf("Balance(0) changed the audio")
+	}
+}
+
+
+func abs_diff(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
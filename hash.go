@@ -0,0 +1,46 @@
+package wavmaker
+
+import (
+	"context"
+	"crypto/sha256"
+	"hash/crc32"
+)
+
+// These hash only the sample data, not the header, as it would be after Load()'s conversion to
+// 16-bit stereo 44100 Hz. So two files that decode to the same audio hash the same, whatever
+// their format on disk was, and likewise WAVs loaded with KeepFormat or made by NewWithFormat().
+// (A WAV at some other rate is resampled to hash it, which is lossy, so it only matches audio that
+// was resampled the same way.) Audio that Load() couldn't convert, e.g. float or 24-bit, is hashed
+// as it is.
+
+func (wav *WAV) AudioHash() [32]byte {
+	return sha256.Sum256(wav.canonical_data())
+}
+
+
+func (wav *WAV) AudioCRC32() uint32 {
+	return crc32.ChecksumIEEE(wav.canonical_data())
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) canonical_data() []byte {
+
+	// The data already in the canonical format is used as it is; anything else is converted in a
+	// copy, since convert() works in place.
+
+	if wav.fast_16_stereo() && wav.FmtChunk.SampleRate == PREFERRED_FREQ {
+		return wav.DataChunk.Data
+	}
+
+	canonical := wav.copy_metadata()
+	canonical.DataChunk.Data = append([]byte(nil), wav.DataChunk.Data...)
+
+	if canonical.convert(context.Background(), "(hash)", PREFERRED_FREQ, Discard) != nil {
+		return wav.DataChunk.Data
+	}
+
+	return canonical.DataChunk.Data
+}
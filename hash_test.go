@@ -0,0 +1,64 @@
+package wavmaker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+)
+
+func TestAudioHashIgnoresFormat(t *testing.T) {
+
+	// The same audio as 8-bit mono and as 16-bit stereo on disk, using the 8-bit to 16-bit mapping
+	// of the loader, must hash the same whichever way it's loaded.
+
+	mono8 := make([]byte, 1001)
+	var stereo16 bytes.Buffer
+
+	for n := range mono8 {
+		mono8[n] = byte(n * 37)
+		val := get_sample(mono8[n:], 1)
+		binary.Write(&stereo16, binary.LittleEndian, [2]int16{val, val})
+	}
+
+	file8 := raw_wav(FmtChunk_Struct{AudioFormat: 1, NumChannels: 1, SampleRate: 44100, ByteRate: 44100, BlockAlign: 1, BitsPerSample: 8}, mono8)
+	file16 := raw_wav(FmtChunk_Struct{AudioFormat: 1, NumChannels: 2, SampleRate: 44100, ByteRate: 176400, BlockAlign: 4, BitsPerSample: 16}, stereo16.Bytes())
+
+	want, err := LoadBytes(file16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []LoadOptions{{}, {KeepFormat: true}} {
+
+		wav, err := load_reader(context.Background(), bytes.NewReader(file8), "8-bit", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if wav.AudioHash() != want.AudioHash() || wav.AudioCRC32() != want.AudioCRC32() {
+			t.Fatalf("8-bit mono (KeepFormat %v) hashed differently from the same audio as 16-bit stereo", opts.KeepFormat)
+		}
+	}
+}
+
+
+func TestAudioHashNewWithFormat(t *testing.T) {
+
+	// A 16-bit mono WAV at the preferred rate and its stereo equivalent.
+
+	mono, _ := NewWithFormat(500, PREFERRED_FREQ, 1)
+	stereo := New(500)
+
+	for n := uint32(0) ; n < 500 ; n++ {
+		mono.Set(n, int16(n * 99), int16(n * 99))
+		stereo.Set(n, int16(n * 99), int16(n * 99))
+	}
+
+	if mono.AudioHash() != stereo.AudioHash() {
+		t.Fatalf("mono and stereo versions of the same audio hashed differently")
+	}
+	if mono.FmtChunk.NumChannels != 1 || mono.DataChunk.Size != 1000 {
+		t.Fatalf("hashing changed the WAV")
+	}
+}
@@ -0,0 +1,340 @@
+package wavmaker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ID3Tags holds the common fields of an ID3v2 tag, as found in an "id3 " chunk. Load() fills it
+// in from v2.3 and v2.4 tags. If the fields are unchanged, Save() writes the tag back exactly as
+// it was loaded; otherwise it writes a new tag of the same version (v2.3 for a new one), with
+// all the frames it doesn't interpret (pictures, chapters and so on) carried over unchanged.
+
+type ID3Tags struct {
+	Title string `json:"title,omitempty"`			// TIT2
+	Artist string `json:"artist,omitempty"`		// TPE1
+	Album string `json:"album,omitempty"`			// TALB
+	Comment string `json:"comment,omitempty"`		// COMM
+
+	other []byte			// Uninterpreted frames, whole, in the layout of version
+	version byte			// 3 or 4; 0 for a new tag, which is written as v2.3
+	original []byte			// The tag as loaded...
+	original_fields [4]string		// ...and the fields it had, to tell if they've changed
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (tags ID3Tags) IsEmpty() bool {
+	return tags.Title == "" && tags.Artist == "" && tags.Album == "" && tags.Comment == "" && len(tags.other) == 0
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (tags ID3Tags) encode() []byte {
+
+	// A whole ID3v2 tag, with no padding. Text goes out as Latin-1 where possible, otherwise as
+	// UTF-16 with a BOM, which both versions allow (v2.3 has no UTF-8).
+
+	if tags.original != nil && tags.fields() == tags.original_fields {
+		return tags.original
+	}
+
+	version := tags.version
+	if version != 4 {
+		version = 3
+	}
+
+	var frames bytes.Buffer
+
+	frame := func(id string, body []byte) {
+		frames.WriteString(id)
+		if version == 4 {
+			frames.Write(synchsafe(uint32(len(body))))
+		} else {
+			binary.Write(&frames, binary.BigEndian, uint32(len(body)))
+		}
+		frames.Write([]byte{0, 0})
+		frames.Write(body)
+	}
+
+	for _, text := range []struct{ id, value string }{{"TIT2", tags.Title}, {"TPE1", tags.Artist}, {"TALB", tags.Album}} {
+		if text.value != "" {
+			enc, b := id3_encode_text(text.value)
+			frame(text.id, append([]byte{enc}, b...))
+		}
+	}
+
+	if tags.Comment != "" {
+		enc, b := id3_encode_text(tags.Comment)
+		terminator := []byte{0}
+		empty := []byte{}
+		if enc == 1 {
+			terminator = []byte{0, 0}
+			empty = []byte{0xff, 0xfe}			// The empty description still needs its BOM
+		}
+		body := append([]byte{enc, 'e', 'n', 'g'}, empty...)
+		body = append(body, terminator...)
+		frame("COMM", append(body, b...))
+	}
+
+	frames.Write(tags.other)
+
+	var tag bytes.Buffer
+
+	tag.WriteString("ID3")
+	tag.Write([]byte{version, 0, 0})
+	tag.Write(synchsafe(uint32(frames.Len())))
+	tag.Write(frames.Bytes())
+
+	return tag.Bytes()
+}
+
+
+func (tags ID3Tags) fields() [4]string {
+	return [4]string{tags.Title, tags.Artist, tags.Album, tags.Comment}
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func parse_id3(b []byte) (ID3Tags, error) {
+
+	// Reads an ID3v2 tag. Only v2.3 and v2.4 are supported, and not unsynchronised tags (rare in
+	// practice, and never needed for v2.4 frames of text). The tag keeps b, which the caller
+	// mustn't change afterwards.
+
+	var tags ID3Tags
+
+	if len(b) < 10 || string(b[:3]) != "ID3" {
+		return tags, errors.New("parse_id3(): no ID3v2 header")
+	}
+
+	version, flags := b[3], b[5]
+
+	if version != 3 && version != 4 {
+		return tags, fmt.Errorf("parse_id3(): ID3v2.%d is not supported", version)
+	}
+	if flags & 0x80 != 0 {
+		return tags, errors.New("parse_id3(): unsynchronised tags are not supported")
+	}
+
+	size, ok := unsynchsafe(b[6:10])
+	if !ok || int(size) > len(b) - 10 {
+		return tags, errors.New("parse_id3(): bad tag size")
+	}
+
+	body := b[10:10 + size]
+
+	if flags & 0x40 != 0 {				// Extended header, which we skip
+		if len(body) < 4 {
+			return tags, errors.New("parse_id3(): truncated extended header")
+		}
+		ext_size := binary.BigEndian.Uint32(body[:4]) + 4		// v2.3 doesn't count the size field...
+		if version == 4 {
+			ext_size, ok = unsynchsafe(body[:4])				// ...v2.4 does
+			if !ok {
+				return tags, errors.New("parse_id3(): bad extended header size")
+			}
+		}
+		if ext_size > uint32(len(body)) {
+			return tags, errors.New("parse_id3(): truncated extended header")
+		}
+		body = body[ext_size:]
+	}
+
+	for len(body) >= 10 && body[0] != 0 {		// A zero byte is the start of the padding
+
+		id := string(body[:4])
+		frame_size := binary.BigEndian.Uint32(body[4:8])
+
+		if version == 4 {
+			frame_size, ok = unsynchsafe(body[4:8])
+			if !ok {
+				return tags, fmt.Errorf("parse_id3(): bad size for frame %q", id)
+			}
+		}
+
+		if frame_size > uint32(len(body)) - 10 {
+			return tags, fmt.Errorf("parse_id3(): frame %q runs past the end of the tag", id)
+		}
+
+		whole := body[:10 + frame_size]
+		content := whole[10:]
+		body = body[10 + frame_size:]
+
+		var err error
+
+		switch id {
+		case "TIT2":
+			tags.Title, err = id3_text(content)
+		case "TPE1":
+			tags.Artist, err = id3_text(content)
+		case "TALB":
+			tags.Album, err = id3_text(content)
+		case "COMM":
+			if tags.Comment == "" {
+				tags.Comment, err = id3_comment(content)
+			} else {
+				tags.other = append(tags.other, whole...)		// Comments in other languages etc.
+			}
+		default:
+			tags.other = append(tags.other, whole...)
+		}
+
+		if err != nil {
+			return tags, fmt.Errorf("parse_id3(): frame %q: %w", id, err)
+		}
+	}
+
+	tags.version = version
+	tags.original = b
+	tags.original_fields = tags.fields()
+
+	return tags, nil
+}
+
+
+func id3_text(content []byte) (string, error) {
+
+	// A text frame: an encoding byte, then the text. Only the first of several values (which
+	// v2.4 separates with nulls) is kept.
+
+	if len(content) < 1 {
+		return "", errors.New("empty frame")
+	}
+
+	text, _, err := id3_decode(content[0], content[1:])
+	return text, err
+}
+
+
+func id3_comment(content []byte) (string, error) {
+
+	// An encoding byte, a 3 letter language, a null-terminated description, then the comment.
+
+	if len(content) < 4 {
+		return "", errors.New("frame too short")
+	}
+
+	_, rest, err := id3_decode(content[0], content[4:])
+	if err != nil {
+		return "", err
+	}
+
+	text, _, err := id3_decode(content[0], rest)
+	return text, err
+}
+
+
+func id3_decode(encoding byte, b []byte) (string, []byte, error) {
+
+	// Decodes one null-terminated (or unterminated, at the end) string, returning what follows.
+
+	wide := encoding == 1 || encoding == 2
+
+	end, next := len(b), len(b)
+
+	for i := 0 ; i < len(b) ; i++ {
+		if wide {
+			if i % 2 == 0 && i + 1 < len(b) && b[i] == 0 && b[i + 1] == 0 {
+				end, next = i, i + 2
+				break
+			}
+		} else if b[i] == 0 {
+			end, next = i, i + 1
+			break
+		}
+	}
+
+	s, rest := b[:end], b[next:]
+
+	switch encoding {
+
+	case 0:									// Latin-1, whose bytes are the first 256 code points
+		runes := make([]rune, len(s))
+		for i, c := range s {
+			runes[i] = rune(c)
+		}
+		return string(runes), rest, nil
+
+	case 3:
+		if !utf8.Valid(s) {
+			return "", nil, errors.New("invalid UTF-8")
+		}
+		return string(s), rest, nil
+
+	case 1, 2:
+		big_endian := encoding == 2
+		if len(s) >= 2 && encoding == 1 {	// BOM
+			if s[0] == 0xfe && s[1] == 0xff {
+				big_endian = true
+			} else if s[0] != 0xff || s[1] != 0xfe {
+				return "", nil, errors.New("UTF-16 text without a BOM")
+			}
+			s = s[2:]
+		}
+		units := make([]uint16, len(s) / 2)
+		for i := range units {
+			if big_endian {
+				units[i] = binary.BigEndian.Uint16(s[i * 2:])
+			} else {
+				units[i] = binary.LittleEndian.Uint16(s[i * 2:])
+			}
+		}
+		return string(utf16.Decode(units)), rest, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown text encoding %d", encoding)
+}
+
+
+func id3_encode_text(s string) (byte, []byte) {
+
+	// Returns the v2.3 encoding byte and the encoded text, unterminated.
+
+	latin := make([]byte, 0, len(s))
+
+	for _, r := range s {
+		if r > 0xff {
+			units := utf16.Encode([]rune(s))
+			b := []byte{0xff, 0xfe}
+			for _, u := range units {
+				b = binary.LittleEndian.AppendUint16(b, u)
+			}
+			return 1, b
+		}
+		latin = append(latin, byte(r))
+	}
+
+	return 0, latin
+}
+
+
+func synchsafe(n uint32) []byte {
+	return []byte{byte(n >> 21) & 0x7f, byte(n >> 14) & 0x7f, byte(n >> 7) & 0x7f, byte(n) & 0x7f}
+}
+
+
+func unsynchsafe(b []byte) (uint32, bool) {
+
+	// Each byte holds 7 bits; the top bit being set means the value is malformed.
+
+	n := uint32(0)
+
+	for _, c := range b[:4] {
+		if c & 0x80 != 0 {
+			return 0, false
+		}
+		n = n << 7 | uint32(c)
+	}
+
+	return n, true
+}
@@ -0,0 +1,105 @@
+package wavmaker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func id3v24_tag() []byte {
+
+	// A v2.4 tag holding a UTF-8 title plus frames we don't interpret, and some padding.
+
+	frame := func(id string, body []byte) []byte {
+		return append(append(append([]byte(id), synchsafe(uint32(len(body)))...), 0, 0), body...)
+	}
+
+	var frames []byte
+	frames = append(frames, frame("TIT2", append([]byte{3}, "Épisode 1"...))...)
+	frames = append(frames, frame("APIC", append([]byte{0}, "image/png\x00\x03\x00PNGDATA"...))...)
+	frames = append(frames, frame("TXXX", append([]byte{3}, "key\x00value"...))...)
+	frames = append(frames, make([]byte, 20)...)
+
+	return append(append([]byte{'I', 'D', '3', 4, 0, 0}, synchsafe(uint32(len(frames)))...), frames...)
+}
+
+
+func id3_chunk(wav *WAV) []byte {
+	for _, chunk := range wav.trailing_chunks() {
+		if is_id3_chunk(chunk.ID) {
+			return chunk.Data
+		}
+	}
+	return nil
+}
+
+
+func TestID3RoundTripUnchanged(t *testing.T) {
+
+	wav := New(10)
+	wav.ExtraChunks = []RawChunk{{[4]byte{'i', 'd', '3', ' '}, id3v24_tag()}}
+
+	loaded, err := LoadBytes(wav.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID3.Title != "Épisode 1" {
+		t.Fatalf("title is %q", loaded.ID3.Title)
+	}
+
+	if !bytes.Equal(id3_chunk(loaded), id3v24_tag()) {
+		t.Fatalf("an unchanged tag wasn't written back exactly as loaded")
+	}
+}
+
+
+func TestID3RoundTripEdited(t *testing.T) {
+
+	wav := New(10)
+	wav.ExtraChunks = []RawChunk{{[4]byte{'i', 'd', '3', ' '}, id3v24_tag()}}
+
+	loaded, err := LoadBytes(wav.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded.ID3.Artist = "Someone"
+
+	tag := id3_chunk(loaded)
+
+	if tag[3] != 4 {
+		t.Fatalf("an edited v2.4 tag was written as v2.%d", tag[3])
+	}
+	if !bytes.Contains(tag, []byte("PNGDATA")) || !bytes.Contains(tag, []byte("key\x00value")) {
+		t.Fatalf("the APIC and TXXX frames were lost")
+	}
+
+	reloaded, err := LoadBytes(loaded.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.ID3.Title != "Épisode 1" || reloaded.ID3.Artist != "Someone" {
+		t.Fatalf("fields after the round trip: %q, %q", reloaded.ID3.Title, reloaded.ID3.Artist)
+	}
+	if !bytes.Equal(reloaded.ID3.other, loaded.ID3.other) {
+		t.Fatalf("the uninterpreted frames changed between saves")
+	}
+}
+
+
+func TestID3NewTag(t *testing.T) {
+
+	wav := New(10)
+	wav.ID3.Title = "Title"
+	wav.ID3.Comment = "日本語"		// Needs UTF-16
+
+	reloaded, err := LoadBytes(wav.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag := id3_chunk(wav) ; tag[3] != 3 {
+		t.Fatalf("a new tag was written as v2.%d", tag[3])
+	}
+	if reloaded.ID3.Title != "Title" || reloaded.ID3.Comment != "日本語" {
+		t.Fatalf("fields after the round trip: %q, %q", reloaded.ID3.Title, reloaded.ID3.Comment)
+	}
+}
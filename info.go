@@ -0,0 +1,52 @@
+package wavmaker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func is_info_chunk(chunk RawChunk) bool {
+
+	// A LIST chunk of the INFO kind. LIST chunks of other kinds (e.g. "adtl" for cue labels) aren't tags.
+
+	return chunk.ID == [4]byte{'L', 'I', 'S', 'T'} && len(chunk.Data) >= 4 && string(chunk.Data[:4]) == "INFO"
+}
+
+
+func parse_info(b []byte) (map[string]string, error) {
+
+	// Reads the tags of a LIST/INFO chunk into a map keyed by their IDs, e.g. "INAM" for the title
+	// and "IART" for the artist. Each is a null-terminated string, padded to an even length. The
+	// text has no declared encoding; in practice it's ASCII or UTF-8, so it's taken as is.
+
+	if len(b) < 4 || string(b[:4]) != "INFO" {
+		return nil, errors.New("parse_info(): not an INFO list")
+	}
+
+	tags := make(map[string]string)
+	b = b[4:]
+
+	for len(b) >= 8 {
+
+		id := string(b[:4])
+		size := binary.LittleEndian.Uint32(b[4:8])
+
+		if uint64(size) > uint64(len(b) - 8) {
+			return tags, fmt.Errorf("parse_info(): tag %q runs past the end of the list", id)
+		}
+
+		tags[id] = strings.TrimRight(string(b[8:8 + size]), "\x00")
+
+		b = b[8 + size:]
+		if size % 2 == 1 && len(b) > 0 {
+			b = b[1:]
+		}
+	}
+
+	return tags, nil
+}
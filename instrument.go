@@ -0,0 +1,107 @@
+package wavmaker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Instrument is the contents of an "inst" chunk, which tells samplers how to map the sound: the
+// note it was recorded at, a tuning and gain correction, and the key and velocity ranges it
+// should be used for. Set it with SetInstrument(), which checks the values. The loader doesn't:
+// a chunk with values out of range (say a velocity of 0) is kept as found, with a Warning, so
+// that it survives a load and save unchanged.
+
+type Instrument struct {
+	BaseNote uint8			// MIDI note, 0-127
+	FineTune int8			// Cents, -50 to 50
+	Gain int8				// dB, -64 to 64
+	LowNote uint8			// 0-127
+	HighNote uint8
+	LowVelocity uint8		// 1-127
+	HighVelocity uint8
+}
+
+const inst_chunk_size = 7
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) SetInstrument(inst *Instrument) error {
+
+	// Sets the instrument data that Save() writes, or with nil, removes it. Out of range values
+	// are rejected, leaving things as they were.
+
+	if inst == nil {
+		wav.instrument = nil
+		return nil
+	}
+
+	err := inst.check()
+	if err != nil {
+		return fmt.Errorf("SetInstrument(): %w", err)
+	}
+
+	copied := *inst
+	wav.instrument = &copied
+
+	return nil
+}
+
+
+func (wav *WAV) Instrument() (Instrument, bool) {
+
+	// Returns the instrument data, and whether there is any.
+
+	if wav.instrument == nil {
+		return Instrument{}, false
+	}
+	return *wav.instrument, true
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (inst *Instrument) check() error {
+
+	if inst.BaseNote > 127 || inst.LowNote > 127 || inst.HighNote > 127 {
+		return errors.New("notes must be 0-127")
+	}
+	if inst.LowNote > inst.HighNote {
+		return errors.New("low note was above high note")
+	}
+	if inst.FineTune < -50 || inst.FineTune > 50 {
+		return errors.New("fine tune must be -50 to 50 cents")
+	}
+	if inst.Gain < -64 || inst.Gain > 64 {
+		return errors.New("gain must be -64 to 64 dB")
+	}
+	if inst.LowVelocity < 1 || inst.LowVelocity > 127 || inst.HighVelocity < 1 || inst.HighVelocity > 127 {
+		return errors.New("velocities must be 1-127")
+	}
+	if inst.LowVelocity > inst.HighVelocity {
+		return errors.New("low velocity was above high velocity")
+	}
+
+	return nil
+}
+
+
+func (inst *Instrument) encode() []byte {
+	return []byte{inst.BaseNote, byte(inst.FineTune), byte(inst.Gain), inst.LowNote, inst.HighNote, inst.LowVelocity, inst.HighVelocity}
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func parse_inst(b []byte) (*Instrument, error) {
+
+	if len(b) < inst_chunk_size {
+		return nil, fmt.Errorf("parse_inst(): chunk is %d bytes, expected %d", len(b), inst_chunk_size)
+	}
+
+	// Only the length is checked here; see interpret_chunk() for the values.
+
+	return &Instrument{b[0], int8(b[1]), int8(b[2]), b[3], b[4], b[5], b[6]}, nil
+}
@@ -0,0 +1,89 @@
+package wavmaker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func inst_file(payload []byte) []byte {
+	return with_chunks(raw_wav(stereo16_fmt(), make([]byte, 40)), RawChunk{[4]byte{'i', 'n', 's', 't'}, payload})
+}
+
+
+func TestInstrumentSaveLoad(t *testing.T) {
+
+	inst := Instrument{BaseNote: 60, FineTune: -12, Gain: 3, LowNote: 48, HighNote: 72, LowVelocity: 1, HighVelocity: 127}
+
+	wav := New(10)
+	if err := wav.SetInstrument(&inst); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := LoadBytes(wav.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := again.Instrument() ; !ok || got != inst || len(again.Warnings) != 0 || len(again.ExtraChunks) != 0 {
+		t.Fatalf("got back %+v, %v, warnings %v", got, ok, again.Warnings)
+	}
+}
+
+
+func TestInstrumentOutOfRangeOnLoad(t *testing.T) {
+
+	// Values SetInstrument() would refuse are still loaded, with a warning, and saved back as
+	// they were rather than ending up in ExtraChunks.
+
+	payloads := [][]byte{
+		{60, 0, 0, 0, 127, 0, 127},			// Velocity 0
+		{60, 0, 0, 72, 48, 1, 127},			// Key range backwards
+		{200, 99, 0, 0, 127, 1, 127},		// Note and fine tune out of range
+	}
+
+	for _, payload := range payloads {
+
+		file := inst_file(payload)
+
+		wav, err := LoadBytes(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inst, ok := wav.Instrument()
+
+		if !ok || !bytes.Equal(inst.encode(), payload) || len(wav.ExtraChunks) != 0 {
+			t.Fatalf("inst chunk %v loaded as %+v, %v, extra chunks %v", payload, inst, ok, wav.ExtraChunks)
+		}
+		if len(wav.Warnings) != 1 {
+			t.Fatalf("inst chunk %v gave warnings %v", payload, wav.Warnings)
+		}
+		if !bytes.Equal(wav.Bytes(), file) {
+			t.Fatalf("inst chunk %v didn't survive saving", payload)
+		}
+
+		// But setting the same values is refused, leaving the loaded ones alone.
+
+		if err := wav.SetInstrument(&inst) ; err == nil {
+			t.Fatalf("SetInstrument() accepted %+v", inst)
+		}
+		if again, _ := wav.Instrument() ; again != inst {
+			t.Fatalf("a refused SetInstrument() changed the instrument")
+		}
+	}
+}
+
+
+func TestInstrumentShortChunk(t *testing.T) {
+
+	// Too short to be an inst chunk at all: skipped, with a warning, and kept in ExtraChunks.
+
+	wav, err := LoadBytes(inst_file([]byte{60, 0, 0, 0, 127}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := wav.Instrument() ; ok || len(wav.ExtraChunks) != 1 || len(wav.Warnings) != 1 {
+		t.Fatalf("a 5 byte inst chunk was used, or dropped")
+	}
+}
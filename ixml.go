@@ -0,0 +1,48 @@
+package wavmaker
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// IXMLInfo is the handful of iXML fields that location sound workflows lean on. Fields missing
+// from the XML are left empty.
+
+type IXMLInfo struct {
+	Project string `xml:"PROJECT" json:"project,omitempty"`
+	Scene string `xml:"SCENE" json:"scene,omitempty"`
+	Take string `xml:"TAKE" json:"take,omitempty"`
+	Tape string `xml:"TAPE" json:"tape,omitempty"`
+	TrackNames []string `xml:"TRACK_LIST>TRACK>NAME" json:"track_names,omitempty"`
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) ParseIXML() (IXMLInfo, error) {
+
+	// Reads the common fields out of wav.IXML. To change them, edit the XML itself, so that all
+	// the fields this doesn't know about survive.
+
+	var info IXMLInfo
+
+	if wav.IXML == "" {
+		return info, errors.New("ParseIXML(): no iXML")
+	}
+
+	// Recorders often pad the chunk with nulls or spaces after the XML, which the decoder never
+	// reaches, since it stops at the end of the root element.
+
+	err := xml.NewDecoder(strings.NewReader(wav.IXML)).Decode(&struct {
+		XMLName xml.Name `xml:"BWFXML"`
+		*IXMLInfo
+	}{IXMLInfo: &info})
+
+	if err != nil {
+		return info, fmt.Errorf("ParseIXML(): %w", err)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,90 @@
+package wavmaker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Shaped like the iXML a Sound Devices recorder writes, cut down.
+
+const recorder_ixml = `<?xml version="1.0" encoding="UTF-8"?>
+<BWFXML><IXML_VERSION>1.5</IXML_VERSION><PROJECT>Dailies</PROJECT><SCENE>12A</SCENE><TAKE>3</TAKE><TAPE>D001</TAPE>` +
+	`<TRACK_LIST><TRACK_COUNT>2</TRACK_COUNT><TRACK><CHANNEL_INDEX>1</CHANNEL_INDEX><NAME>Boom</NAME></TRACK>` +
+	`<TRACK><CHANNEL_INDEX>2</CHANNEL_INDEX><NAME>Lav</NAME></TRACK></TRACK_LIST></BWFXML>`
+
+
+func ixml_file(payload string) []byte {
+	return with_chunks(raw_wav(stereo16_fmt(), make([]byte, 40)), RawChunk{[4]byte{'i', 'X', 'M', 'L'}, []byte(payload)})
+}
+
+
+func check_ixml_round_trip(t *testing.T, payload string) {
+
+	file := ixml_file(payload)
+
+	wav, err := LoadBytes(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.IXML != payload {
+		t.Fatalf("loaded iXML was %q, expected %q", wav.IXML, payload)
+	}
+
+	saved := wav.Bytes()
+
+	if !bytes.Equal(saved, file) {
+		t.Fatalf("saving changed the file")
+	}
+	if binary.LittleEndian.Uint32(saved[4:8]) != uint32(len(saved) - 8) || len(saved) % 2 != 0 {
+		t.Fatalf("RIFF size or padding wrong after an iXML chunk of %d bytes", len(payload))
+	}
+
+	info, err := wav.ParseIXML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Project != "Dailies" || info.Scene != "12A" || info.Take != "3" || info.Tape != "D001" ||
+		len(info.TrackNames) != 2 || info.TrackNames[0] != "Boom" || info.TrackNames[1] != "Lav" {
+		t.Fatalf("ParseIXML() gave %+v", info)
+	}
+}
+
+
+func TestIXMLOddLength(t *testing.T) {
+
+	payload := recorder_ixml
+	if len(payload) % 2 == 0 {
+		payload += "\n"
+	}
+
+	check_ixml_round_trip(t, payload)
+}
+
+
+func TestIXMLTrailingNulls(t *testing.T) {
+
+	// Recorders reserve room for later edits by padding with nulls, which must survive.
+
+	check_ixml_round_trip(t, recorder_ixml + "\x00\x00\x00\x00\x00\x00\x00")
+}
+
+
+func TestIXMLStamped(t *testing.T) {
+
+	// Setting the field on a new WAV writes a chunk that loads back the same, odd length or not.
+
+	for _, payload := range []string{"<BWFXML/>", "<BWFXML></BWFXML>"} {
+
+		wav := New(10)
+		wav.IXML = payload
+
+		again, err := LoadBytes(wav.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.IXML != payload || len(again.ExtraChunks) != 0 {
+			t.Fatalf("stamped %q, got back %q", payload, again.IXML)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package wavmaker
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) RateCrush(effective_rate_hz float64) error {
+
+	// Imitates a lower sample rate by sample-and-hold, in place: each held value lasts for
+	// actual / effective frames on average, with the fractional part carried over so the timing
+	// is right on average. The real rate and length don't change. Rates at or above the actual
+	// one change nothing.
+
+	if !(effective_rate_hz > 0) {
+		return errors.New("RateCrush(): effective rate must be positive")
+	}
+
+	ratio := effective_rate_hz / float64(wav.FmtChunk.SampleRate)		// New samples per frame
+
+	if ratio >= 1 {
+		return nil
+	}
+
+	frames := wav.FrameCount()
+	if frames == 0 {
+		return nil
+	}
+
+	held_left, held_right := wav.Get(0)
+	phase := 0.0
+
+	for n := uint32(1) ; n < frames ; n++ {
+
+		phase += ratio
+
+		if phase >= 1 {
+			phase -= 1
+			held_left, held_right = wav.Get(n)
+		} else {
+			wav.Set(n, held_left, held_right)
+		}
+	}
+
+	return nil
+}
+
+
+func (wav *WAV) AddVinylNoise(crackle_density, crackle_amplitude, hiss_amplitude_db float64, seed int64) uint32 {
+
+	// Overlays record noise, in place: crackles (clicks a few frames long, decaying exponentially)
+	// at an average of crackle_density per second, with peaks up to crackle_amplitude (a fraction
+	// of full scale), plus softened white hiss at an RMS of hiss_amplitude_db dBFS. The same seed
+	// gives the same noise. A density of 0 and a hiss level of -Inf change nothing. Returns the
+	// number of samples clamped.
+
+	const crackle_decay = 0.5		// Per frame, so a crackle is gone in a handful of frames
+	const crackle_length = 12
+	const hiss_smoothing = 0.5		// One-pole low-pass coefficient; tames the harshest highs
+
+	hiss := math.Pow(10, hiss_amplitude_db / 20) * 32768
+
+	if !(crackle_density > 0 && crackle_amplitude > 0) && !(hiss > 0) {
+		return 0
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+
+	frames := wav.FrameCount()
+
+	// The one-pole filter reduces white noise power by a / (2 - a); undo that so hiss is the RMS.
+
+	hiss_scale := hiss * math.Sqrt((2 - hiss_smoothing) / hiss_smoothing)
+
+	crackle_chance := crackle_density / float64(wav.FmtChunk.SampleRate)
+
+	var hiss_state [2]float64
+	var crackle_level [2]float64
+	var crackle_left [2]int
+
+	clipped := uint32(0)
+
+	for n := uint32(0) ; n < frames ; n++ {
+
+		left, right := wav.Get(n)
+		vals := [2]int16{left, right}
+
+		if crackle_amplitude > 0 && rng.Float64() < crackle_chance {
+			for ch := 0 ; ch < 2 ; ch++ {
+				sign := 1.0
+				if rng.Intn(2) == 0 {
+					sign = -1
+				}
+				crackle_level[ch] = sign * crackle_amplitude * 32767 * (0.5 + rng.Float64() / 2)
+				crackle_left[ch] = crackle_length
+			}
+		}
+
+		for ch := 0 ; ch < 2 ; ch++ {
+
+			v := float64(vals[ch])
+
+			if hiss > 0 {
+				hiss_state[ch] += hiss_smoothing * (rng.NormFloat64() * hiss_scale - hiss_state[ch])
+				v += hiss_state[ch]
+			}
+
+			if crackle_left[ch] > 0 {
+				v += crackle_level[ch]
+				crackle_level[ch] *= crackle_decay
+				crackle_left[ch]--
+			}
+
+			var was_clipped bool
+			vals[ch], was_clipped = round_clamp(v)
+			if was_clipped {
+				clipped++
+			}
+		}
+
+		wav.Set(n, vals[0], vals[1])
+	}
+
+	return clipped
+}
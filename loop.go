@@ -0,0 +1,131 @@
+package wavmaker
+
+import (
+	"errors"
+	"math"
+)
+
+const loop_window = 256			// Frames compared around each candidate loop point
+const loop_candidates = 256		// Most candidate points considered
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) FindLoopPoints(min_loop_frames uint32) (uint32, uint32, float64, error) {
+
+	// Searches for start and end frames such that playing [start, end) over and over sounds
+	// continuous. Candidates are rising zero crossings (thinned out if there are many), and each
+	// pair is scored by the normalised cross-correlation of the audio around the two points,
+	// which matches slope as well as level. The score is 0 to 1; a poor score means there was
+	// no good loop, but the best one found is still returned.
+
+	frames := wav.FrameCount()
+
+	if min_loop_frames == 0 || min_loop_frames >= frames {
+		return 0, 0, 0, errors.New("FindLoopPoints(): minimum loop length must be positive and less than the length")
+	}
+
+	mono := make([]float64, frames)
+	for n := uint32(0) ; n < frames ; n++ {
+		left, right := wav.Get(n)
+		mono[n] = (float64(left) + float64(right)) / 2
+	}
+
+	var candidates []uint32
+
+	// Only points with a full window either side are considered, so that scores are comparable.
+
+	lo := uint32(loop_window / 2)
+	hi := frames - min(frames, loop_window / 2)
+
+	for n := lo ; n < hi ; n++ {
+		if mono[n - 1] < 0 && mono[n] >= 0 {
+			candidates = append(candidates, n)
+		}
+	}
+
+	if len(candidates) < 2 {		// No crossings to speak of (e.g. DC or silence), use an even grid
+		candidates = nil
+		for i := uint32(0) ; i <= loop_candidates && lo < hi ; i++ {
+			candidates = append(candidates, lo + uint32(uint64(hi - lo) * uint64(i) / loop_candidates))
+		}
+	}
+
+	candidates = thin_out(candidates, loop_candidates)
+
+	best_start, best_end, best_score := uint32(0), frames, -2.0
+
+	for _, start := range candidates {
+		for _, end := range candidates {
+
+			if end < start || end - start < min_loop_frames {
+				continue
+			}
+
+			score := loop_score(mono, start, end)
+
+			if score > best_score {
+				best_start, best_end, best_score = start, end, score
+			}
+		}
+	}
+
+	if best_score < -1 {		// No pair was long enough; fall back to the whole file
+		best_start, best_end, best_score = 0, frames, loop_score(mono, 0, frames)
+	}
+
+	return best_start, best_end, math.Max(0, best_score), nil
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func loop_score(mono []float64, start, end uint32) float64 {
+
+	// Compares the audio around start with the audio around end, -1 to 1. Offsets that would
+	// fall outside the data at either point are skipped (this only happens in the fallback case).
+
+	var dot, energy_a, energy_b float64
+
+	for offset := -loop_window / 2 ; offset < loop_window / 2 ; offset++ {
+
+		a := int64(start) + int64(offset)
+		b := int64(end) + int64(offset)
+
+		if a < 0 || b < 0 || a >= int64(len(mono)) || b >= int64(len(mono)) {
+			continue
+		}
+
+		dot += mono[a] * mono[b]
+		energy_a += mono[a] * mono[a]
+		energy_b += mono[b] * mono[b]
+	}
+
+	if energy_a == 0 && energy_b == 0 {
+		return 1		// Silence loops perfectly
+	}
+	if energy_a == 0 || energy_b == 0 {
+		return 0
+	}
+
+	return dot / math.Sqrt(energy_a * energy_b)
+}
+
+
+func thin_out(points []uint32, limit int) []uint32 {
+
+	// Picks at most limit evenly spaced entries, always keeping the first and last.
+
+	if len(points) <= limit {
+		return points
+	}
+
+	ret := make([]uint32, limit)
+
+	for i := range ret {
+		ret[i] = points[i * (len(points) - 1) / (limit - 1)]
+	}
+
+	return ret
+}
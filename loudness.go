@@ -0,0 +1,183 @@
+package wavmaker
+
+import (
+	"math"
+)
+
+// LoudnessMode selects how MatchLoudness() measures level.
+
+type LoudnessMode int
+
+const (
+	LOUDNESS_PEAK LoudnessMode = iota	// Sample peak, dBFS
+	LOUDNESS_RMS						// RMS of both channels together, dBFS
+	LOUDNESS_LUFS						// Integrated loudness per ITU-R BS.1770, LUFS
+)
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) LoudnessLUFS() float64 {
+
+	// Integrated loudness per ITU-R BS.1770: K-weighting, 400 ms blocks overlapping by 75%, an
+	// absolute gate at -70 LUFS and a relative gate 10 LU below the ungated level. A file shorter
+	// than one block is measured as a single block. -Inf for silence.
+
+	frames := wav.FrameCount()
+	if frames == 0 {
+		return math.Inf(-1)
+	}
+
+	channels := 2
+	if wav.FmtChunk.NumChannels == 1 {
+		channels = 1
+	}
+
+	rate := float64(wav.FmtChunk.SampleRate)
+
+	k_weighting := k_weighting_filters(rate)
+
+	// Running sums of the squared, K-weighted signal, so each block's mean square is a subtraction.
+
+	sums := make([][]float64, channels)
+
+	for ch := 0 ; ch < channels ; ch++ {
+
+		signal := make([]float64, frames)
+
+		for n := uint32(0) ; n < frames ; n++ {
+			left, right := wav.Get(n)
+			if ch == 0 {
+				signal[n] = float64(left) / 32768
+			} else {
+				signal[n] = float64(right) / 32768
+			}
+		}
+
+		for _, f := range k_weighting {
+			f.process(signal)
+		}
+
+		sums[ch] = make([]float64, frames + 1)
+		for n, v := range signal {
+			sums[ch][n + 1] = sums[ch][n] + v * v
+		}
+	}
+
+	block := min(frames, uint32(math.Round(rate * 0.4)))
+	hop := max(1, block / 4)
+
+	var powers []float64		// Per block, summed over channels
+
+	for start := uint32(0) ; start + block <= frames ; start += hop {
+		power := 0.0
+		for ch := 0 ; ch < channels ; ch++ {
+			power += (sums[ch][start + block] - sums[ch][start]) / float64(block)
+		}
+		powers = append(powers, power)
+	}
+
+	lufs := func(power float64) float64 {
+		return -0.691 + 10 * math.Log10(power)
+	}
+
+	gated_mean := func(threshold float64) float64 {
+		total := 0.0
+		count := 0
+		for _, power := range powers {
+			if lufs(power) > threshold {
+				total += power
+				count++
+			}
+		}
+		if count == 0 {
+			return 0
+		}
+		return total / float64(count)
+	}
+
+	ungated := gated_mean(-70)
+	if ungated == 0 {
+		return math.Inf(-1)
+	}
+
+	return lufs(gated_mean(lufs(ungated) - 10))
+}
+
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func MatchLoudness(wavs []*WAV, target float64, mode LoudnessMode) []float64 {
+
+	// Brings every WAV to the same level, in place: target is in dBFS for the peak and RMS modes,
+	// or LUFS. Returns the gain applied to each (as a multiplier; silent WAVs are left alone with
+	// a gain of 1). Where the gain would push samples past full scale, the WAV goes through the
+	// limiter as it's raised instead, and the logger says so; the reported gain is then the one
+	// applied before limiting.
+
+	const limit_lookahead_ms = 5
+	const limit_release_ms = 100
+
+	gains := make([]float64, len(wavs))
+
+	for i, wav := range wavs {
+
+		var level float64
+
+		switch mode {
+		case LOUDNESS_PEAK:
+			level = wav.PeakDB()
+		case LOUDNESS_RMS:
+			level = wav.RMSDB()
+		default:
+			level = wav.LoudnessLUFS()
+		}
+
+		gains[i] = 1
+		if math.IsInf(level, -1) {
+			continue
+		}
+
+		gain := math.Pow(10, (target - level) / 20)
+		gains[i] = gain
+
+		if wav.Peak() * gain * 32768 > 32767 {
+			get_logger()("MatchLoudness(): WAV %d would have clipped at %+.1f dB gain, limiting", i, to_db(gain))
+			wav.limit(gain, 0, limit_lookahead_ms, limit_release_ms)
+		} else {
+			wav.scale_range(0, wav.FrameCount(), func(n uint32) float64 {
+				return gain
+			})
+		}
+	}
+
+	return gains
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func k_weighting_filters(rate float64) []biquad {
+
+	// The BS.1770 pre-filter (a high shelf modelling the head) and RLB high-pass, designed for any
+	// sample rate from the analogue prototypes behind the 48 kHz coefficients in the standard.
+
+	shelf_k := math.Tan(math.Pi * 1681.9744509555319 / rate)
+	shelf_q := 0.7071752369554193
+	vh := math.Pow(10, 3.99984385397 / 20)
+	vb := math.Pow(vh, 0.4996667741545416)
+
+	hp_k := math.Tan(math.Pi * 38.13547087613982 / rate)
+	hp_q := 0.5003270373253953
+
+	return []biquad{
+		normalise_biquad(
+			vh + vb * shelf_k / shelf_q + shelf_k * shelf_k, 2 * (shelf_k * shelf_k - vh), vh - vb * shelf_k / shelf_q + shelf_k * shelf_k,
+			1 + shelf_k / shelf_q + shelf_k * shelf_k, 2 * (shelf_k * shelf_k - 1), 1 - shelf_k / shelf_q + shelf_k * shelf_k),
+		normalise_biquad(
+			1, -2, 1,
+			1 + hp_k / hp_q + hp_k * hp_k, 2 * (hp_k * hp_k - 1), 1 - hp_k / hp_q + hp_k * hp_k),
+	}
+}
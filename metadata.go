@@ -0,0 +1,241 @@
+package wavmaker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Metadata is a summary of a WAV without its audio data. The JSON field names are stable.
+// Peak and RMS are fractions of full scale, and are absent when only the header was read.
+// Info holds the LIST/INFO tags keyed by their IDs (e.g. "INAM" for the title, "IART" for the
+// artist); it, ID3 and IXML are absent when the file has no such tags.
+
+type Metadata struct {
+	SampleRate uint32 `json:"sample_rate"`
+	Channels uint16 `json:"channels"`
+	BitsPerSample uint16 `json:"bits_per_sample"`
+	Frames uint32 `json:"frames"`
+	Seconds float64 `json:"seconds"`
+	Peak *float64 `json:"peak,omitempty"`
+	RMS *float64 `json:"rms,omitempty"`
+	Info map[string]string `json:"info,omitempty"`
+	ID3 *ID3Tags `json:"id3,omitempty"`
+	IXML *IXMLInfo `json:"ixml,omitempty"`
+}
+
+const describe_max_tag_bytes = 16 << 20		// DescribeFile() skips tag chunks bigger than this
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) Metadata() Metadata {
+
+	peak := wav.Peak()
+	rms := wav.RMS()
+
+	meta := metadata_from_fmt(wav.FmtChunk, wav.DataChunk.Size)
+	meta.Peak = &peak
+	meta.RMS = &rms
+
+	wav.add_tags(&meta)
+
+	return meta
+}
+
+
+func (wav *WAV) MarshalJSON() ([]byte, error) {
+	return json.Marshal(wav.Metadata())
+}
+
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func DescribeFile(filename string) (Metadata, error) {
+
+	// Reads just enough of the file to describe it, seeking past the data chunk rather than loading it.
+	// The result describes the file as it is on disk, i.e. before any conversion Load() would do.
+
+	infile, err := os.Open(filename)
+	if infile != nil {
+		defer infile.Close()
+	}
+	if err != nil {
+		return Metadata{}, fmt.Errorf("DescribeFile() couldn't open '%s': %v", filename, err)
+	}
+
+	fmt_chunk, _, data_size, chunks, err := scan_chunks(infile, true)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("DescribeFile() couldn't parse '%s': %v", filename, err)
+	}
+
+	meta := metadata_from_fmt(fmt_chunk, data_size)
+
+	// Interpret the tag chunks as the loader would, via a WAV with no audio...
+
+	var wav WAV
+
+	for _, chunk := range chunks {
+		if !wav.interpret_chunk(chunk) {
+			wav.ExtraChunks = append(wav.ExtraChunks, chunk)
+		}
+	}
+
+	wav.add_tags(&meta)
+
+	return meta, nil
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) add_tags(meta *Metadata) {
+
+	// Fills in the tag fields of the Metadata. Malformed tags are left out rather than failing.
+
+	for _, chunk := range wav.ExtraChunks {
+		if is_info_chunk(chunk) {
+			info, _ := parse_info(chunk.Data)
+			for key, value := range info {
+				if meta.Info == nil {
+					meta.Info = make(map[string]string)
+				}
+				meta.Info[key] = value
+			}
+		}
+	}
+
+	if !wav.ID3.IsEmpty() {
+		tags := wav.ID3
+		meta.ID3 = &tags
+	}
+
+	if wav.IXML != "" {
+		ixml, err := wav.ParseIXML()
+		if err == nil {
+			meta.IXML = &ixml
+		}
+	}
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func scan_chunks(infile io.ReadSeeker, want_tags bool) (FmtChunk_Struct, int64, uint32, []RawChunk, error) {
+
+	// Finds the fmt chunk and the position and size of the data chunk, seeking past everything else.
+	// With want_tags, it carries on to the end of the file (tags often come after the data) and
+	// also returns the chunks that Metadata() draws tags from, unless they're implausibly large.
+
+	var buf [4]byte
+	var fmt_chunk FmtChunk_Struct
+	var data_offset int64
+	var data_size uint32
+	var got_fmt, got_data bool
+	var tags []RawChunk
+
+	var header struct {
+		Riff [4]byte
+		Size uint32
+		Wave [4]byte
+	}
+
+	err := binary.Read(infile, binary.LittleEndian, &header)
+	if err != nil {
+		return fmt_chunk, 0, 0, nil, fmt.Errorf("scan_chunks() couldn't read RIFF header: %v", err)
+	}
+	if header.Riff != [4]byte{'R', 'I', 'F', 'F'} || header.Wave != [4]byte{'W', 'A', 'V', 'E'} {
+		return fmt_chunk, 0, 0, nil, fmt.Errorf("scan_chunks() found no RIFF/WAVE header")
+	}
+
+	for want_tags || got_fmt == false || got_data == false {
+
+		err = binary.Read(infile, binary.LittleEndian, &buf)
+		if err != nil {
+			if got_fmt && got_data {		// The end of the file, or junk after the last chunk
+				break
+			}
+			return fmt_chunk, 0, 0, nil, fmt.Errorf("scan_chunks() couldn't read chunk's starting bytes: %v", err)
+		}
+
+		var skip int64
+
+		if buf == [4]byte{'f', 'm', 't', ' '} {
+			fmt_chunk, _, err = load_fmt(infile)
+			if err != nil {
+				return fmt_chunk, 0, 0, nil, err
+			}
+			got_fmt = true
+			continue
+		}
+
+		var size uint32
+		err = binary.Read(infile, binary.LittleEndian, &size)
+		if err != nil {
+			if got_fmt && got_data {
+				break
+			}
+			return fmt_chunk, 0, 0, nil, fmt.Errorf("scan_chunks() couldn't read '%s' chunk size: %v", buf, err)
+		}
+
+		skip = int64(size) + int64(size % 2)
+
+		if buf == [4]byte{'d', 'a', 't', 'a'} {
+			data_offset, err = infile.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return fmt_chunk, 0, 0, nil, fmt.Errorf("scan_chunks() couldn't find data chunk offset: %v", err)
+			}
+			data_size = size
+			got_data = true
+		} else if want_tags && is_tag_chunk(buf) && size <= describe_max_tag_bytes {
+			chunk := RawChunk{buf, make([]byte, size)}
+			_, err = io.ReadFull(infile, chunk.Data)
+			if err != nil {
+				if got_fmt && got_data {	// Truncated at the end; describe what there is
+					break
+				}
+				return fmt_chunk, 0, 0, nil, fmt.Errorf("scan_chunks() couldn't read '%s' chunk: %v", buf, err)
+			}
+			tags = append(tags, chunk)
+			skip = int64(size % 2)
+		}
+
+		if skip > 0 {
+			_, err = infile.Seek(skip, io.SeekCurrent)
+			if err != nil {
+				return fmt_chunk, 0, 0, nil, fmt.Errorf("scan_chunks() couldn't seek past '%s' chunk: %v", buf, err)
+			}
+		}
+	}
+
+	return fmt_chunk, data_offset, data_size, tags, nil
+}
+
+
+func is_tag_chunk(id [4]byte) bool {
+	return id == [4]byte{'L', 'I', 'S', 'T'} || is_id3_chunk(id) || id == [4]byte{'i', 'X', 'M', 'L'}
+}
+
+
+func metadata_from_fmt(fmt_chunk FmtChunk_Struct, data_size uint32) Metadata {
+
+	var meta Metadata
+
+	meta.SampleRate = fmt_chunk.SampleRate
+	meta.Channels = fmt_chunk.NumChannels
+	meta.BitsPerSample = fmt_chunk.BitsPerSample
+
+	if fmt_chunk.BlockAlign > 0 {
+		meta.Frames = data_size / uint32(fmt_chunk.BlockAlign)
+	}
+	if fmt_chunk.SampleRate > 0 {
+		meta.Seconds = float64(meta.Frames) / float64(fmt_chunk.SampleRate)
+	}
+
+	return meta
+}
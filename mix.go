@@ -0,0 +1,371 @@
+package wavmaker
+
+import (
+	"fmt"
+	"math"
+)
+
+// MixInput describes one file for MixFiles. The offset is OffsetFrames plus OffsetSeconds (either
+// can be left at zero). Volume is used exactly as Add uses it, so 0 means silence. Fadeout is the
+// number of frames at the end of the file to fade, again as in Add.
+
+type MixInput struct {
+	Filename string
+	OffsetFrames uint32
+	OffsetSeconds float64
+	Volume float64
+	Fadeout uint32
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (target *WAV) AddEnveloped(t_loc uint32, source *WAV, s_loc uint32, frames uint32, envelope func(frame_within_note uint32) float64) uint32 {
+
+	// Like Add(), but instead of a volume and fadeout, each source frame is multiplied by
+	// envelope(i), where i counts from 0 at s_loc. Clamping and the return value are as Add().
+
+	if !target.rates_match(source, "AddEnveloped") {
+		return 0
+	}
+
+	return target.mix_frames(t_loc, frames, true, func(i uint32) (int32, int32, bool) {
+
+		s := s_loc + i
+		if s < s_loc || s >= source.FrameCount() {
+			return 0, 0, false
+		}
+
+		source_left, source_right := source.Get(s)
+		gain := envelope(i)
+
+		return int32(float64(source_left) * gain), int32(float64(source_right) * gain), true
+	})
+}
+
+
+func (target *WAV) AddPanned(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, pan float64, fadeout uint32) uint32 {
+
+	// Like Add(), but with a constant-power pan from -1 (left) to +1 (right) applied to the
+	// source's two channels as they're mixed in. The law is scaled so that 0 is unity gain in
+	// both channels (and indeed this just calls Add()), while the hard positions send the near
+	// channel at +3 dB and the far one not at all.
+
+	if pan == 0 {
+		return target.Add(t_loc, source, s_loc, frames, volume, fadeout)
+	}
+
+	if !target.rates_match(source, "AddPanned") {
+		return 0
+	}
+
+	left_gain, right_gain := pan_gains(pan)
+
+	return target.mix_frames(t_loc, frames, true, func(i uint32) (int32, int32, bool) {
+
+		source_left, source_right, ok := source.faded_frame(s_loc, i, frames, fadeout)
+		if !ok {
+			return 0, 0, false
+		}
+
+		return int32(float64(source_left) * volume * left_gain), int32(float64(source_right) * volume * right_gain), true
+	})
+}
+
+
+func (target *WAV) AddResampled(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, rate float64, fadeout uint32) uint32 {
+
+	// Like Add(), but reading the source at the given rate, e.g. 2.0 plays it an octave up, using
+	// linear interpolation. The source position is worked out afresh for each output frame, so
+	// it doesn't drift. Frames and fadeout count output frames. A rate of exactly 1.0 is just
+	// Add(); rates of 0 or less mix nothing.
+
+	if rate == 1.0 {
+		return target.Add(t_loc, source, s_loc, frames, volume, fadeout)
+	}
+
+	if rate <= 0 || !target.rates_match(source, "AddResampled") {
+		return 0
+	}
+
+	source_frames := source.FrameCount()
+
+	return target.mix_frames(t_loc, frames, true, func(i uint32) (int32, int32, bool) {
+
+		pos := float64(s_loc) + float64(i) * rate
+		if pos >= float64(source_frames) {
+			return 0, 0, false
+		}
+
+		index := uint32(pos)
+		fraction := pos - float64(index)
+
+		next_index := index + 1
+		if next_index >= source_frames {
+			next_index = index
+		}
+
+		left_a, right_a := source.Get(index)
+		left_b, right_b := source.Get(next_index)
+
+		left  := float64(left_a)  + (float64(left_b)  - float64(left_a))  * fraction
+		right := float64(right_a) + (float64(right_b) - float64(right_a)) * fraction
+
+		frames_to_go := frames - i
+		if frames_to_go < fadeout {
+			fade_multiplier := float64(frames_to_go) / float64(fadeout)
+			left *= fade_multiplier
+			right *= fade_multiplier
+		}
+
+		return int32(left * volume), int32(right * volume), true
+	})
+}
+
+
+func (target *WAV) AddLooping(t_loc uint32, source *WAV, loop_start, loop_end uint32, frames uint32, volume float64, fadeout uint32) (uint32, error) {
+
+	// Like Add() from the start of the source, except that on reaching loop_end, playback jumps
+	// back to loop_start, repeating until frames frames have been mixed (or the target ends).
+	// The fadeout applies to the end of those frames, as in Add(). Returns the clip count.
+
+	if loop_start >= loop_end || loop_end > source.FrameCount() {
+		return 0, fmt.Errorf("AddLooping(): loop %d-%d is empty or not within 0-%d", loop_start, loop_end, source.FrameCount())
+	}
+
+	if target.FmtChunk.SampleRate != source.FmtChunk.SampleRate {
+		return 0, fmt.Errorf("AddLooping(): can't mix a %d Hz source into a %d Hz target", source.FmtChunk.SampleRate, target.FmtChunk.SampleRate)
+	}
+
+	loop_length := loop_end - loop_start
+
+	return target.mix_frames(t_loc, frames, true, func(i uint32) (int32, int32, bool) {
+
+		s := i
+		if s >= loop_end {
+			s = loop_start + (i - loop_start) % loop_length
+		}
+
+		source_left, source_right := source.Get(s)
+		source_left, source_right = apply_fadeout(source_left, source_right, i, frames, fadeout)
+
+		if volume == 1.0 {
+			return int32(source_left), int32(source_right), true
+		}
+
+		return int32(float64(source_left) * volume), int32(float64(source_right) * volume), true
+	}), nil
+}
+
+
+func (target *WAV) AddReversed(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, fadeout uint32) uint32 {
+
+	// Like Add(), but the source is read backwards starting at s_loc (which is played first),
+	// while the target is still written forwards. An s_loc at or beyond the end of the source
+	// means its last frame, so math.MaxUint32 reverses the whole thing.
+
+	if !target.rates_match(source, "AddReversed") {
+		return 0
+	}
+
+	if source.FrameCount() == 0 {
+		return 0
+	}
+
+	s_loc = min(s_loc, source.FrameCount() - 1)
+
+	return target.mix_frames(t_loc, frames, true, func(i uint32) (int32, int32, bool) {
+
+		if i > s_loc {
+			return 0, 0, false
+		}
+
+		source_left, source_right := source.Get(s_loc - i)
+		source_left, source_right = apply_fadeout(source_left, source_right, i, frames, fadeout)
+
+		if volume == 1.0 {
+			return int32(source_left), int32(source_right), true
+		}
+
+		return int32(float64(source_left) * volume), int32(float64(source_right) * volume), true
+	})
+}
+
+
+func (target *WAV) AddMono(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, pan float64, fadeout uint32) (uint32, error) {
+
+	// Mixes a mono source into the target, placing it with the same pan law as AddPanned(), so a
+	// pan of 0 puts the sample into both channels at full level. Errors if the source isn't mono.
+
+	if source.FmtChunk.NumChannels != 1 {
+		return 0, fmt.Errorf("AddMono(): source has %d channels", source.FmtChunk.NumChannels)
+	}
+
+	if target.FmtChunk.SampleRate != source.FmtChunk.SampleRate {
+		return 0, fmt.Errorf("AddMono(): can't mix a %d Hz source into a %d Hz target", source.FmtChunk.SampleRate, target.FmtChunk.SampleRate)
+	}
+
+	left_gain, right_gain := pan_gains(pan)
+
+	return target.mix_frames(t_loc, frames, true, func(i uint32) (int32, int32, bool) {
+
+		sample, _, ok := source.faded_frame(s_loc, i, frames, fadeout)		// Get() gives the mono sample twice
+		if !ok {
+			return 0, 0, false
+		}
+
+		return int32(float64(sample) * volume * left_gain), int32(float64(sample) * volume * right_gain), true
+	}), nil
+}
+
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func MixFiles(inputs []MixInput, output string) error {
+
+	// Loads each input, mixes them all together and saves the result. The output is as long as
+	// needed to hold every input. The mix is done at full precision and, if the sum would clip,
+	// the whole thing is scaled down just enough to fit, so stacked files never distort.
+
+	var mb MixBuffer
+
+	for i, input := range inputs {
+
+		wav, err := Load(input.Filename)
+		if err != nil {
+			return fmt.Errorf("MixFiles(): input %d (%s): %w", i, input.Filename, err)
+		}
+
+		offset_f := float64(input.OffsetFrames) + math.Round(input.OffsetSeconds * float64(wav.FmtChunk.SampleRate))
+		if input.OffsetSeconds < 0 || offset_f > math.MaxUint32 {
+			return fmt.Errorf("MixFiles(): input %d (%s): offset out of range", i, input.Filename)
+		}
+
+		err = mb.place(uint32(offset_f), wav, input.Volume, input.Volume, input.Fadeout)
+		if err != nil {
+			return fmt.Errorf("MixFiles(): input %d (%s): %w", i, input.Filename, err)
+		}
+	}
+
+	result, _, _ := mb.resolve(true)
+
+	err := result.Save(output)
+	if err != nil {
+		return fmt.Errorf("MixFiles(): %w", err)
+	}
+
+	return nil
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func pan_gains(pan float64) (float64, float64) {
+
+	// Constant-power (sin/cos) law, times sqrt 2 so the centre is unity.
+
+	if pan == 0 {
+		return 1, 1		// Exactly, rather than via sin and cos
+	}
+
+	pan = max(-1, min(1, pan))
+	angle := (pan + 1) * math.Pi / 4
+
+	return math.Cos(angle) * math.Sqrt2, math.Sin(angle) * math.Sqrt2
+}
+
+
+func apply_fadeout(left, right int16, i uint32, frames uint32, fadeout uint32) (int16, int16) {
+
+	// Add()'s fadeout: frame i of frames is scaled down if it's among the final fadeout frames.
+
+	frames_to_go := frames - i
+	if frames_to_go < fadeout {
+		fade_multiplier := float64(frames_to_go) / float64(fadeout)
+
+		left  = int16(fade_multiplier * float64(left))
+		right = int16(fade_multiplier * float64(right))
+	}
+
+	return left, right
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (target *WAV) mix_frames(t_loc uint32, frames uint32, additive bool, next func(i uint32) (int32, int32, bool)) uint32 {
+
+	// The general mixing loop behind the Add family. next(i) gives the contribution for the i'th
+	// frame (already scaled by volume, fades, pan, etc), or false once the source is exhausted.
+	// Mixing stops at that point, at the end of the target, or after frames frames. As in the
+	// original Insert(), at least one frame is attempted even if frames is 0. Returns the number
+	// of samples clamped.
+
+	clipped := uint32(0)
+
+	for i := uint32(0) ; ; i++ {
+
+		t := t_loc + i
+		if t < t_loc || t >= target.FrameCount() {
+			break
+		}
+
+		source_left, source_right, ok := next(i)
+		if !ok {
+			break
+		}
+
+		target_left, target_right := int16(0), int16(0)
+		if additive {
+			target_left, target_right = target.Get(t)
+		}
+
+		new_left_32  := int32(target_left)  + source_left
+		new_right_32 := int32(target_right) + source_right
+
+		if new_left_32  < -32768 { new_left_32  = -32768 ; clipped++ }
+		if new_left_32  >  32767 { new_left_32  =  32767 ; clipped++ }
+		if new_right_32 < -32768 { new_right_32 = -32768 ; clipped++ }
+		if new_right_32 >  32767 { new_right_32 =  32767 ; clipped++ }
+
+		target.Set(t, int16(new_left_32), int16(new_right_32))
+
+		if i + 1 >= frames {
+			break
+		}
+	}
+
+	return clipped
+}
+
+
+func (target *WAV) rates_match(source *WAV, caller string) bool {
+
+	if target.FmtChunk.SampleRate != source.FmtChunk.SampleRate {
+		target.report(problem_rate_mismatch, "%s() refused to mix a %d Hz source into a %d Hz target",
+			caller, source.FmtChunk.SampleRate, target.FmtChunk.SampleRate)
+		return false
+	}
+
+	return true
+}
+
+
+func (source *WAV) faded_frame(s_loc uint32, i uint32, frames uint32, fadeout uint32) (int16, int16, bool) {
+
+	// Frame s_loc + i of the source, with Add()'s fadeout over the last fadeout of frames frames
+	// applied. False if that's past the end of the source.
+
+	s := s_loc + i
+	if s < s_loc || s >= source.FrameCount() {
+		return 0, 0, false
+	}
+
+	source_left, source_right := source.Get(s)
+	source_left, source_right = apply_fadeout(source_left, source_right, i, frames, fadeout)
+
+	return source_left, source_right, true
+}
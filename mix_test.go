@@ -0,0 +1,55 @@
+package wavmaker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAddReversedPalindrome(t *testing.T) {
+
+	// A palindrome sounds the same either way, so Add() and AddReversed() should give identical
+	// results, with and without a fadeout and volume change.
+
+	const frames = 999
+
+	source := New(frames)
+	for n := uint32(0) ; n < (frames + 1) / 2 ; n++ {
+		left, right := int16(n * 53), -int16(n * 31)
+		source.Set(n, left, right)
+		source.Set(frames - 1 - n, left, right)
+	}
+
+	for _, volume := range []float64{1, 0.6} {
+		for _, fadeout := range []uint32{0, 300} {
+
+			forward := test_wav(2000)
+			reversed := test_wav(2000)
+
+			forward.Add(100, source, 0, frames, volume, fadeout)
+			reversed.AddReversed(100, source, frames - 1, frames, volume, fadeout)
+
+			if !bytes.Equal(forward.DataChunk.Data, reversed.DataChunk.Data) {
+				t.Fatalf("volume %v, fadeout %d: mixing a palindrome reversed gave a different result", volume, fadeout)
+			}
+		}
+	}
+}
+
+
+func TestAddReversedOrder(t *testing.T) {
+
+	// Not a palindrome: the target gets the source's frames last to first.
+
+	source := test_wav(50)
+	target := New(50)
+
+	target.AddReversed(0, source, 1 << 31, 50, 1, 0)		// Past the end means from the last frame
+
+	for n := uint32(0) ; n < 50 ; n++ {
+		left, right := target.Get(n)
+		want_left, want_right := source.Get(49 - n)
+		if left != want_left || right != want_right {
+			t.Fatalf("frame %d is %d, %d, expected source frame %d's %d, %d", n, left, right, 49 - n, want_left, want_right)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package wavmaker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MixBuffer accumulates stereo audio without clamping, so that a dense mix can be scaled to fit
+// (or clamped) once, at the end. It grows as sources are added. The zero value is ready to use,
+// and takes its sample rate from the first source. MixFiles, Mixer and Sequence are built on it.
+
+type MixBuffer struct {
+	rate uint32			// 0 until the first source is placed
+	data []int32		// Interleaved stereo
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (mb *MixBuffer) Add(t_loc uint32, source *WAV, volume float64, fadeout uint32) error {
+
+	// Mixes in the whole source starting at frame t_loc, with Add()'s volume and fadeout.
+	// Errors if the source's sample rate differs from earlier ones.
+
+	err := mb.place(t_loc, source, volume, volume, fadeout)
+	if err != nil {
+		return fmt.Errorf("MixBuffer.Add(): %w", err)
+	}
+
+	return nil
+}
+
+
+func (mb *MixBuffer) AddPanned(t_loc uint32, source *WAV, volume float64, pan float64, fadeout uint32) error {
+
+	left_gain, right_gain := pan_gains(pan)
+
+	err := mb.place(t_loc, source, volume * left_gain, volume * right_gain, fadeout)
+	if err != nil {
+		return fmt.Errorf("MixBuffer.AddPanned(): %w", err)
+	}
+
+	return nil
+}
+
+
+func (mb *MixBuffer) Frames() uint32 {
+	return uint32(len(mb.data) / 2)
+}
+
+
+func (mb *MixBuffer) Resolve(normalize bool) (*WAV, int) {
+
+	// Converts the mix to a new 16-bit stereo WAV. With normalize, a mix that's too loud is scaled
+	// down so the peak just fits, and the count is always 0. Without it, out of range samples are
+	// clamped, and the count says how many were.
+
+	result, clipped, _ := mb.resolve(normalize)
+	return result, int(clipped)
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (mb *MixBuffer) place(offset uint32, source *WAV, left_volume, right_volume float64, fadeout uint32) error {
+
+	// Adds the whole source at the given frame, with Add()'s volume and fadeout arithmetic (each
+	// channel having its own volume, which is how panning gets in).
+
+	if mb.rate == 0 {
+		mb.rate = source.FmtChunk.SampleRate
+	} else if source.FmtChunk.SampleRate != mb.rate {
+		return errors.New("sample rate differs from earlier sources")
+	}
+
+	frames := source.FrameCount()
+
+	if uint64(offset) + uint64(frames) > math.MaxUint32 / 4 {
+		return errors.New("mix would exceed the maximum WAV size")
+	}
+
+	end := offset + frames
+
+	if uint32(len(mb.data)) < end * 2 {
+		mb.data = append(mb.data, make([]int32, int(end * 2) - len(mb.data))...)
+	}
+
+	mix := mb.data[offset * 2:]
+
+	for s := uint32(0) ; s < frames ; s++ {
+
+		left, right := source.Get(s)
+		left, right = apply_fadeout(left, right, s, frames, fadeout)
+
+		if left_volume == 1.0 {
+			mix[s * 2] += int32(left)
+		} else {
+			mix[s * 2] += int32(float64(left) * left_volume)
+		}
+
+		if right_volume == 1.0 {
+			mix[s * 2 + 1] += int32(right)
+		} else {
+			mix[s * 2 + 1] += int32(float64(right) * right_volume)
+		}
+	}
+
+	return nil
+}
+
+
+func (mb *MixBuffer) resolve(normalize bool) (*WAV, uint32, float64) {
+
+	// Converts to a 16-bit stereo WAV. If normalize is set and the mix is too loud, everything is
+	// scaled down so the peak just fits; otherwise out of range samples are clamped. Returns the
+	// WAV, the number of samples clamped, and the scale applied (1.0 if none).
+
+	// The two sides are checked separately, since -32768 fits but 32768 doesn't.
+
+	lowest, highest := int32(0), int32(0)
+
+	for _, v := range mb.data {
+		lowest = min(lowest, v)
+		highest = max(highest, v)
+	}
+
+	scale := 1.0
+	if normalize && highest > 32767 {
+		scale = 32767 / float64(highest)
+	}
+	if normalize && lowest < -32768 {
+		scale = min(scale, -32768 / float64(lowest))
+	}
+
+	rate := mb.rate
+	if rate == 0 {
+		rate = PREFERRED_FREQ
+	}
+
+	result, err := NewWithFormat(uint32(len(mb.data) / 2), rate, 2)
+	if err != nil {
+		panic("failed to create a valid WAV")		// Can't happen; place() checked the size
+	}
+
+	clipped := uint32(0)
+
+	for n := 0 ; n < len(mb.data) ; n += 2 {
+
+		left  := mb.data[n]
+		right := mb.data[n + 1]
+
+		if scale != 1.0 {
+			left  = int32(float64(left)  * scale)
+			right = int32(float64(right) * scale)
+		}
+
+		if left  < -32768 { left  = -32768 ; clipped++ }
+		if left  >  32767 { left  =  32767 ; clipped++ }
+		if right < -32768 { right = -32768 ; clipped++ }
+		if right >  32767 { right =  32767 ; clipped++ }
+
+		result.Set(uint32(n / 2), int16(left), int16(right))
+	}
+
+	return result, clipped, scale
+}
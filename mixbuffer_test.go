@@ -0,0 +1,98 @@
+package wavmaker
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func full_scale_wav() *WAV {
+
+	// Noise that hits both extremes, so any mistake about which of them fits in 16 bits shows.
+
+	wav := noise_wav(5000, 41)
+	wav.Set(0, -32768, 32767)
+	wav.Set(1, 32767, -32768)
+	wav.Set(2, 20000, -20000)
+
+	return wav
+}
+
+
+func TestMixBufferSingleInputIsIdentity(t *testing.T) {
+
+	source := full_scale_wav()
+
+	for _, normalize := range []bool{true, false} {
+
+		var mb MixBuffer
+		if err := mb.Add(0, source, 1, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		result, clipped := mb.Resolve(normalize)
+
+		if clipped != 0 || !bytes.Equal(result.DataChunk.Data, source.DataChunk.Data) {
+			t.Fatalf("normalize %v: one input at volume 1 didn't come out unchanged (%d clipped)", normalize, clipped)
+		}
+	}
+}
+
+
+func TestMixBufferNormalizesEachSide(t *testing.T) {
+
+	// Twice full scale: whichever side is over decides the scale, and the result just fits.
+
+	var mb MixBuffer
+	mb.Add(0, full_scale_wav(), 1, 0)
+	mb.Add(0, full_scale_wav(), 1, 0)
+
+	result, _ := mb.Resolve(true)
+
+	if left, right := result.Get(0); left > -32767 || right < 32766 {
+		t.Fatalf("the loudest frame became %d, %d, expected it at (nearly) full scale", left, right)
+	}
+}
+
+
+func TestMixFilesSingleInputIsIdentity(t *testing.T) {
+
+	source := full_scale_wav()
+	dir := t.TempDir()
+
+	if err := source.Save(filepath.Join(dir, "in.wav")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := MixFiles([]MixInput{{Filename: filepath.Join(dir, "in.wav"), Volume: 1}}, filepath.Join(dir, "out.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Load(filepath.Join(dir, "out.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Equal(source) {
+		t.Fatalf("mixing one file at volume 1 changed it")
+	}
+}
+
+
+func TestMixerRenderSingleTrackNoWarning(t *testing.T) {
+
+	source := full_scale_wav()
+
+	var m Mixer
+	m.AddTrack("only").Place(0, source, 1)
+
+	result, err := m.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Warnings) != 0 || !result.Equal(source) {
+		t.Fatalf("one full scale track was changed or warned about: %v", result.Warnings)
+	}
+}
@@ -0,0 +1,107 @@
+package wavmaker
+
+import (
+	"fmt"
+)
+
+// Mixer is a simple multitrack mixer. Each Track holds sample placements plus its own gain, pan
+// and mute; Render() sums the lot at full precision and only then converts to 16 bits, scaling
+// the whole mix down (and saying so in the result's Warnings) if it would otherwise clip.
+
+type Mixer struct {
+	tracks []*Track
+}
+
+type Track struct {
+	Name string
+	Gain float64			// Linear; AddTrack() sets this to 1
+	Pan float64				// -1 to +1, using the same law as AddPanned()
+	Mute bool
+	events []track_event
+}
+
+type track_event struct {
+	at uint32
+	sample *WAV
+	volume float64
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (m *Mixer) AddTrack(name string) *Track {
+
+	// Returns the track with this name, creating it if needed.
+
+	for _, track := range m.tracks {
+		if track.Name == name {
+			return track
+		}
+	}
+
+	track := &Track{Name: name, Gain: 1}
+	m.tracks = append(m.tracks, track)
+
+	return track
+}
+
+
+func (m *Mixer) Track(name string) *Track {
+
+	// Returns the named track, or nil.
+
+	for _, track := range m.tracks {
+		if track.Name == name {
+			return track
+		}
+	}
+
+	return nil
+}
+
+
+func (t *Track) Place(at_frame uint32, sample *WAV, volume float64) {
+
+	// Schedules the whole sample to start at the given frame. Placements can be made in any
+	// order. The sample is used at render time, so it shouldn't be modified in between.
+
+	t.events = append(t.events, track_event{at_frame, sample, volume})
+}
+
+
+func (m *Mixer) Render() (*WAV, error) {
+
+	// Mixes every unmuted track into a new 16-bit stereo WAV, long enough for the latest event to
+	// finish. All samples must share a sample rate, which the result takes. Rendering doesn't
+	// change the Mixer, so rendering twice gives the same result.
+
+	var mb MixBuffer
+
+	for _, track := range m.tracks {
+
+		if track.Mute {
+			continue
+		}
+
+		left_gain, right_gain := pan_gains(track.Pan)
+
+		for i, ev := range track.events {
+			err := mb.place(ev.at, ev.sample, ev.volume * track.Gain * left_gain, ev.volume * track.Gain * right_gain, 0)
+			if err != nil {
+				return nil, fmt.Errorf("Render(): track '%s' event %d: %w", track.Name, i, err)
+			}
+		}
+	}
+
+	result, _, scale := mb.resolve(true)
+
+	// Callers can't be expected to watch the log, so the scaling is also noted on the result.
+
+	if scale != 1.0 {
+		warning := fmt.Errorf("Render(): mix would have clipped, scaled down by %.1f dB", -to_db(scale))
+		result.Warnings = append(result.Warnings, warning)
+		get_logger()("%v", warning)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package wavmaker
+
+func LoadMapped(filename string) (*WAV, func() error, error) {
+
+	// Memory mapping isn't supported on this platform, so this is just Load(). See mmap_unix.go.
+
+	wav, err := Load(filename)
+	return wav, func() error { return nil }, err
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package wavmaker
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+func LoadMapped(filename string) (*WAV, func() error, error) {
+
+	// For analysis of huge files. If the file is already 16-bit stereo PCM at PREFERRED_FREQ, the
+	// returned WAV's DataChunk.Data points straight at the memory-mapped file rather than a copy.
+	// Otherwise this just does a normal Load(). Either way, call the returned func when done.
+	// A mapped WAV has no ExtraChunks, since only the fmt and data chunks are looked at.
+	//
+	// A mapped WAV is copy-on-write: the first method that modifies it copies the data into
+	// ordinary memory first. Writing to DataChunk.Data directly will crash. After the unmap func
+	// is called, a WAV that is still mapped must not be used at all (Copy() it first if needed).
+
+	nothing := func() error { return nil }
+
+	infile, err := os.Open(filename)
+	if infile != nil {
+		defer infile.Close()		// The mapping survives the file being closed
+	}
+	if err != nil {
+		return nil, nothing, fmt.Errorf("LoadMapped() couldn't open '%s': %v", filename, err)
+	}
+
+	fmt_chunk, offset, size, _, err := scan_chunks(infile, false)
+	if err != nil {
+		return nil, nothing, fmt.Errorf("LoadMapped() couldn't parse '%s': %v", filename, err)
+	}
+
+	info, err := infile.Stat()
+	if err != nil {
+		return nil, nothing, fmt.Errorf("LoadMapped() couldn't stat '%s': %v", filename, err)
+	}
+
+	canonical := fmt_chunk == FmtChunk_Struct{16, 1, 2, PREFERRED_FREQ, PREFERRED_FREQ * 4, 4, 16}
+
+	if !canonical || size == 0 || size % 4 != 0 || offset + int64(size) > info.Size() {
+		wav, err := Load(filename)
+		return wav, nothing, err
+	}
+
+	mapped, err := syscall.Mmap(int(infile.Fd()), 0, int(offset + int64(size)), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nothing, fmt.Errorf("LoadMapped() couldn't map '%s': %v", filename, err)
+	}
+
+	var once sync.Once
+	var unmap_err error
+
+	unmap := func() error {
+		once.Do(func() {
+			unmap_err = syscall.Munmap(mapped)
+		})
+		return unmap_err
+	}
+
+	var wav WAV
+
+	wav.FmtChunk = fmt_chunk
+	wav.DataChunk.Size = size
+	wav.DataChunk.Data = mapped[offset : offset + int64(size)]
+	wav.borrowed = true
+
+	return &wav, unmap, nil
+}
@@ -0,0 +1,71 @@
+package wavmaker
+
+import (
+	"fmt"
+	"math"
+)
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) RingModulate(carrier_hz float64, mix float64) error {
+
+	// Multiplies the audio by a sine carrier, in place, blending the result with the dry signal
+	// by mix (0 is dry, 1 is fully modulated). Both channels use the same carrier phase. Since
+	// the carrier never exceeds 1, the output can't exceed the input level.
+
+	return wav.ring_modulate(carrier_hz, mix, false, "RingModulate")
+}
+
+
+func (wav *WAV) RingModulateQuadrature(carrier_hz float64, mix float64) error {
+
+	// As RingModulate, but the right channel's carrier is 90 degrees ahead of the left's, which
+	// gives a swirling stereo effect.
+
+	return wav.ring_modulate(carrier_hz, mix, true, "RingModulateQuadrature")
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) ring_modulate(carrier_hz float64, mix float64, quadrature bool, caller string) error {
+
+	nyquist := float64(wav.FmtChunk.SampleRate) / 2
+
+	if !(carrier_hz > 0 && carrier_hz <= nyquist) {
+		return fmt.Errorf("%s(): carrier frequency must be above 0 and at most %v Hz", caller, nyquist)
+	}
+
+	mix = max(0, min(1, mix))
+
+	if mix == 0 {
+		return nil
+	}
+
+	frames := wav.FrameCount()
+	omega := 2 * math.Pi * carrier_hz / float64(wav.FmtChunk.SampleRate)
+
+	right_offset := 0.0
+	if quadrature {
+		right_offset = math.Pi / 2
+	}
+
+	for n := uint32(0) ; n < frames ; n++ {
+
+		phase := omega * float64(n)		// From n each time, so no drift
+
+		left_gain  := (1 - mix) + mix * math.Sin(phase)
+		right_gain := (1 - mix) + mix * math.Sin(phase + right_offset)
+
+		left, right := wav.Get(n)
+
+		new_left, _  := scale_sample(left, left_gain)
+		new_right, _ := scale_sample(right, right_gain)
+
+		wav.Set(n, new_left, new_right)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package wavmaker
+
+import (
+	"math"
+	"math/rand"
+)
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func NewGaussianNoise(seconds float64, level_dbfs float64, seed int64) *WAV {
+
+	// Returns a new WAV (at the preferred rate, stereo) of normally distributed white noise with
+	// an RMS of level_dbfs, independent in each channel. The same seed gives the same noise.
+	// Samples beyond full scale are clamped, which at -12 dBFS happens to about 1 in 15,000 and
+	// at -20 dBFS effectively never.
+
+	wav := new_seconds(seconds)
+	rng := rand.New(rand.NewSource(seed))
+
+	sigma := 32768 * math.Pow(10, level_dbfs / 20)
+
+	for n := uint32(0) ; n < wav.FrameCount() ; n++ {
+		left, _ := round_clamp(rng.NormFloat64() * sigma)
+		right, _ := round_clamp(rng.NormFloat64() * sigma)
+		wav.Set(n, left, right)
+	}
+
+	return wav
+}
+
+
+func NewBrownNoise(seconds float64, amplitude float64, seed int64) *WAV {
+
+	// Returns a new WAV (at the preferred rate, stereo) of brown noise, independent in each channel
+	// and peak normalised to amplitude (a fraction of full scale). The noise is integrated white
+	// noise, falling at 6 dB per octave, except that the integrator leaks slightly so the signal
+	// is pulled back towards zero rather than wandering off; below about 10 Hz the spectrum is flat.
+
+	const leak_hz = 10
+
+	wav := new_seconds(seconds)
+	rng := rand.New(rand.NewSource(seed))
+
+	frames := wav.FrameCount()
+	leak := 1 - 2 * math.Pi * leak_hz / PREFERRED_FREQ
+
+	var signals [2][]float64
+	peak := 0.0
+
+	for n := uint32(0) ; n < frames ; n++ {
+		for ch := 0 ; ch < 2 ; ch++ {
+			if n == 0 {
+				signals[ch] = make([]float64, frames)
+			} else {
+				signals[ch][n] = signals[ch][n - 1] * leak
+			}
+			signals[ch][n] += rng.NormFloat64()
+			peak = math.Max(peak, math.Abs(signals[ch][n]))
+		}
+	}
+
+	if peak == 0 {
+		return wav
+	}
+
+	scale := math.Max(0, math.Min(1, amplitude)) * 32767 / peak
+
+	for n := uint32(0) ; n < frames ; n++ {
+		left, _ := round_clamp(signals[0][n] * scale)
+		right, _ := round_clamp(signals[1][n] * scale)
+		wav.Set(n, left, right)
+	}
+
+	return wav
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func new_seconds(seconds float64) *WAV {
+
+	// A silent WAV from New(), the given length at the preferred rate. Negative lengths give an
+	// empty WAV; impossible ones are capped at the largest WAV that can exist.
+
+	frames := math.Round(seconds * PREFERRED_FREQ)
+
+	if !(frames > 0) { frames = 0 }			// Including NaN
+	if frames > math.MaxUint32 / 4 { frames = math.MaxUint32 / 4 }
+
+	return New(uint32(frames))
+}
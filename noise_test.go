@@ -0,0 +1,184 @@
+package wavmaker
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func channel_rms(wav *WAV, start, end uint32) (float64, float64) {
+
+	// RMS of each channel over the frames, as a fraction of full scale (32768).
+
+	var ll, rr float64
+
+	for n := start ; n < end ; n++ {
+		left, right := wav.Get(n)
+		ll += float64(left) * float64(left)
+		rr += float64(right) * float64(right)
+	}
+
+	count := float64(end - start)
+
+	return math.Sqrt(ll / count) / 32768, math.Sqrt(rr / count) / 32768
+}
+
+
+func TestGaussianNoiseLevel(t *testing.T) {
+
+	for _, level := range []float64{-40, -20, -12, -6} {
+		for seed := int64(1) ; seed <= 3 ; seed++ {
+
+			wav := NewGaussianNoise(2, level, seed)
+			left, right := channel_rms(wav, 0, wav.FrameCount())
+
+			for _, rms := range []float64{left, right} {
+				if got := to_db(rms) ; math.Abs(got - level) > 0.5 {
+					t.Errorf("level %v, seed %d: measured RMS %.2f dBFS", level, seed, got)
+				}
+			}
+		}
+	}
+}
+
+
+func TestGaussianNoiseDeterministic(t *testing.T) {
+
+	// Same seed, same noise; different seed, different noise; and the channels independent.
+
+	a := NewGaussianNoise(1, -20, 99)
+	b := NewGaussianNoise(1, -20, 99)
+	c := NewGaussianNoise(1, -20, 100)
+
+	if !bytes.Equal(a.DataChunk.Data, b.DataChunk.Data) {
+		t.Fatalf("the same seed gave different noise")
+	}
+	if bytes.Equal(a.DataChunk.Data, c.DataChunk.Data) {
+		t.Fatalf("different seeds gave the same noise")
+	}
+	if corr := a.PhaseCorrelation() ; math.Abs(corr) > 0.05 {
+		t.Fatalf("the channels have a correlation of %.3f", corr)
+	}
+}
+
+
+func band_power_db(wav *WAV, freqs []float64) []float64 {
+
+	// Averaged periodogram of the left channel (Hann windowed blocks of 8192, half overlapped),
+	// summed over a third of an octave around each frequency, in dB.
+
+	const size = 8192
+
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5 * math.Cos(2 * math.Pi * float64(i) / size)
+	}
+
+	power := make([]float64, size / 2)
+	buf := make([]complex128, size)
+
+	for start := uint32(0) ; start + size <= wav.FrameCount() ; start += size / 2 {
+		for i := range buf {
+			left, _ := wav.Get(start + uint32(i))
+			buf[i] = complex(float64(left) * window[i], 0)
+		}
+		fft(buf, false)
+		for k := range power {
+			power[k] += real(buf[k]) * real(buf[k]) + imag(buf[k]) * imag(buf[k])
+		}
+	}
+
+	bin_hz := float64(wav.FmtChunk.SampleRate) / size
+	var ret []float64
+
+	for _, freq := range freqs {
+		sum := 0.0
+		for k := int(freq * math.Pow(2, -1.0 / 6) / bin_hz) ; k <= int(freq * math.Pow(2, 1.0 / 6) / bin_hz) ; k++ {
+			sum += power[k]
+		}
+		ret = append(ret, 10 * math.Log10(sum))
+	}
+
+	return ret
+}
+
+
+func TestBrownNoiseSlope(t *testing.T) {
+
+	// Power per third-octave band should fall by 6 dB per octave, less the 3 dB per octave that
+	// the bands widen by, i.e. 3 dB per octave; fitted by least squares over 100 Hz to 6400 Hz,
+	// well above the leak.
+
+	freqs := []float64{100, 200, 400, 800, 1600, 3200, 6400}
+	bands := band_power_db(NewBrownNoise(20, 0.5, 5), freqs)
+
+	var sx, sy, sxx, sxy float64
+
+	for i, db := range bands {
+		x := float64(i)		// Octaves above 100 Hz
+		sx += x ; sy += db ; sxx += x * x ; sxy += x * db
+	}
+
+	n := float64(len(bands))
+	slope := (n * sxy - sx * sy) / (n * sxx - sx * sx) - 10 * math.Log10(2)		// Back to per-Hz density
+
+	if slope > -5.5 || slope < -6.5 {
+		t.Fatalf("spectrum falls at %.2f dB per octave, expected about -6 (bands %.1f)", slope, bands)
+	}
+}
+
+
+func TestBrownNoiseLongRender(t *testing.T) {
+
+	// Ten minutes, at full amplitude: only the peak itself should touch full scale, the level
+	// shouldn't wander (each minute within 3 dB of the whole), and there should be no lasting DC
+	// offset, over the whole or any 10 seconds of it.
+
+	if testing.Short() {
+		t.Skip("renders ten minutes of noise")
+	}
+
+	wav := NewBrownNoise(600, 1, 7)
+	frames := wav.FrameCount()
+
+	full_scale := 0
+	var total [2]float64
+
+	for start := uint32(0) ; start < frames ; start += 10 * PREFERRED_FREQ {
+
+		var sum [2]float64
+
+		for n := start ; n < start + 10 * PREFERRED_FREQ ; n++ {
+			left, right := wav.Get(n)
+			sum[0] += float64(left)
+			sum[1] += float64(right)
+			if left >= 32767 || left <= -32767 { full_scale++ }
+			if right >= 32767 || right <= -32767 { full_scale++ }
+		}
+
+		for ch := 0 ; ch < 2 ; ch++ {
+			if mean := sum[ch] / (10 * PREFERRED_FREQ) / 32768 ; math.Abs(mean) > 0.05 {
+				t.Errorf("channel %d has a mean of %.3f over the 10 seconds from frame %d", ch, mean, start)
+			}
+			total[ch] += sum[ch]
+		}
+	}
+
+	if full_scale > 2 {
+		t.Errorf("%d samples were at full scale", full_scale)
+	}
+	for ch := 0 ; ch < 2 ; ch++ {
+		if mean := total[ch] / float64(frames) / 32768 ; math.Abs(mean) > 0.005 {
+			t.Errorf("channel %d has a mean of %.4f overall", ch, mean)
+		}
+	}
+
+	whole_left, whole_right := channel_rms(wav, 0, frames)
+
+	for start := uint32(0) ; start < frames ; start += 60 * PREFERRED_FREQ {
+		left, right := channel_rms(wav, start, start + 60 * PREFERRED_FREQ)
+		if math.Abs(to_db(left / whole_left)) > 3 || math.Abs(to_db(right / whole_right)) > 3 {
+			t.Errorf("the minute from frame %d has RMS %.3f, %.3f against %.3f, %.3f overall", start, left, right, whole_left, whole_right)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package wavmaker
+
+import (
+	"errors"
+	"math"
+)
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) EstimateBPM(min_bpm, max_bpm float64) (float64, float64, error) {
+
+	// Guesses the tempo by autocorrelating an onset-strength envelope, looking only at periods
+	// inside the given range. Returns the tempo and a confidence from 0 to 1; material with no
+	// clear pulse gives a low confidence rather than an error. The autocorrelation isn't
+	// normalised by overlap, so a period and its multiples don't tie: the shortest one wins,
+	// which resolves most octave ambiguity in favour of the faster tempo within the range.
+
+	if min_bpm <= 0 || max_bpm <= min_bpm {
+		return 0, 0, errors.New("EstimateBPM(): need 0 < min_bpm < max_bpm")
+	}
+	if wav.FmtChunk.SampleRate == 0 {
+		return 0, 0, errors.New("EstimateBPM(): sample rate was 0")
+	}
+
+	hop := max(wav.FmtChunk.SampleRate / 200, 1)		// About 5 ms
+	env_rate := float64(wav.FmtChunk.SampleRate) / float64(hop)
+
+	env := wav.onset_envelope(hop)
+
+	min_lag := int(math.Floor(60 * env_rate / max_bpm))
+	max_lag := int(math.Ceil(60 * env_rate / min_bpm))
+
+	if min_lag < 1 {
+		min_lag = 1
+	}
+	if max_lag + 1 >= len(env) / 2 {
+		return 0, 0, errors.New("EstimateBPM(): audio too short for the tempo range")
+	}
+
+	// Remove the mean, so that a steady level doesn't correlate with itself...
+
+	mean := 0.0
+	for _, v := range env {
+		mean += v
+	}
+	mean /= float64(len(env))
+
+	for i := range env {
+		env[i] -= mean
+	}
+
+	autocorr := func(lag int) float64 {
+		sum := 0.0
+		for i := 0 ; i + lag < len(env) ; i++ {
+			sum += env[i] * env[i + lag]
+		}
+		return sum
+	}
+
+	energy := autocorr(0)
+	if energy <= 0 {
+		return 0, 0, nil		// Silence, or perfectly steady
+	}
+
+	// Compute one lag either side of the range too, for the interpolation below.
+
+	scores := make([]float64, max_lag + 2)
+	for lag := min_lag - 1 ; lag <= max_lag + 1 ; lag++ {
+		scores[lag] = autocorr(lag)
+	}
+
+	best := min_lag
+	for lag := min_lag ; lag <= max_lag ; lag++ {
+		if scores[lag] > scores[best] {
+			best = lag
+		}
+	}
+
+	// Parabolic interpolation around the best lag gives a sub-hop period.
+
+	period := float64(best)
+
+	a, b, c := scores[best - 1], scores[best], scores[best + 1]
+	if denom := a - 2 * b + c ; denom < 0 {
+		period += 0.5 * (a - c) / denom
+	}
+
+	bpm := 60 * env_rate / period
+	bpm = math.Max(min_bpm, math.Min(max_bpm, bpm))
+
+	confidence := math.Max(0, math.Min(1, scores[best] / energy))
+
+	return bpm, confidence, nil
+}
+
+
+func (wav *WAV) DetectOnsets(sensitivity float64) []uint32 {
+
+	// Returns the frames where transients begin. Sensitivity runs from 0 (only the most obvious
+	// hits) to 1 (anything that gets louder at all). Detections are at least 30 ms apart; within
+	// that, the strongest wins.
+
+	if wav.FmtChunk.SampleRate == 0 {
+		return nil
+	}
+
+	sensitivity = math.Max(0, math.Min(1, sensitivity))
+
+	hop := max(wav.FmtChunk.SampleRate / 400, 1)		// About 2.5 ms
+	min_gap := int(wav.FmtChunk.SampleRate * 30 / 1000 / hop)
+
+	env := wav.onset_envelope(hop)
+
+	if len(env) == 0 {
+		return nil
+	}
+
+	mean := 0.0
+	for _, v := range env {
+		mean += v
+	}
+	mean /= float64(len(env))
+
+	variance := 0.0
+	for _, v := range env {
+		variance += (v - mean) * (v - mean)
+	}
+	std := math.Sqrt(variance / float64(len(env)))
+
+	threshold := math.Max(mean + std * 4 * (1 - sensitivity), 0.0001)		// Floor is about -80 dB, so silence finds nothing
+
+	var ret []uint32
+	last := -min_gap - 1
+
+	for i, v := range env {
+
+		if v < threshold {
+			continue
+		}
+
+		// Must be the biggest value within min_gap either side (ties go to the earlier one)...
+
+		is_peak := true
+
+		for j := max(0, i - min_gap) ; j <= min(len(env) - 1, i + min_gap) ; j++ {
+			if env[j] > v || (env[j] == v && j < i) {
+				is_peak = false
+				break
+			}
+		}
+
+		if !is_peak || i - last <= min_gap {
+			continue
+		}
+
+		ret = append(ret, wav.onset_start(uint32(i), hop))
+		last = i
+	}
+
+	return ret
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) onset_envelope(hop uint32) []float64 {
+
+	// Splits the audio into blocks of hop frames and returns, for each, how much louder (in RMS
+	// terms, channels mixed) it is than the block before. Decreases are zeroed, so this only
+	// responds to things starting. Entry 0 is measured against silence.
+
+	frames := wav.FrameCount()
+	blocks := frames / hop
+
+	env := make([]float64, blocks)
+	previous := 0.0
+
+	for b := uint32(0) ; b < blocks ; b++ {
+
+		sum := 0.0
+
+		for n := b * hop ; n < (b + 1) * hop ; n++ {
+			left, right := wav.Get(n)
+			mono := (float64(left) + float64(right)) / 2
+			sum += mono * mono
+		}
+
+		rms := math.Sqrt(sum / float64(hop)) / 32768
+
+		env[b] = math.Max(0, rms - previous)
+		previous = rms
+	}
+
+	return env
+}
+
+
+func (wav *WAV) onset_start(block uint32, hop uint32) uint32 {
+
+	// The envelope only knows which block got louder. The attack may have started in the block
+	// before, so search both for the first frame reaching half the peak level.
+
+	start := (max(block, 1) - 1) * hop
+	end := (block + 1) * hop
+
+	peak := 0.0
+
+	for n := start ; n < end ; n++ {
+		left, right := wav.Get(n)
+		peak = math.Max(peak, math.Abs((float64(left) + float64(right)) / 2))
+	}
+
+	for n := start ; n < end ; n++ {
+		left, right := wav.Get(n)
+		if math.Abs((float64(left) + float64(right)) / 2) >= peak / 2 {
+			return n
+		}
+	}
+
+	return block * hop
+}
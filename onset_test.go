@@ -0,0 +1,94 @@
+package wavmaker
+
+import (
+	"math"
+	"testing"
+)
+
+func click_track(frames uint32, positions []uint32) *WAV {
+
+	// Short clicks (a decaying 2 kHz burst, about 10 ms) starting at the given frames.
+
+	wav := New(frames)
+	wav.Policy = POLICY_PANIC
+
+	for _, pos := range positions {
+		for i := uint32(0) ; i < 441 && pos + i < frames ; i++ {
+			val := int16(20000 * math.Exp(-float64(i) / 80) * math.Sin(2 * math.Pi * 2000 * float64(i) / PREFERRED_FREQ))
+			wav.Set(pos + i, val, val)
+		}
+	}
+
+	return wav
+}
+
+
+func TestEstimateBPMClickTrack(t *testing.T) {
+
+	// 120 BPM is a click every 22050 frames. Ranges that allow 60 or 240 as well mustn't pick them.
+
+	var positions []uint32
+	for pos := uint32(0) ; pos < 20 * PREFERRED_FREQ ; pos += 22050 {
+		positions = append(positions, pos)
+	}
+
+	wav := click_track(20 * PREFERRED_FREQ, positions)
+
+	for _, r := range [][2]float64{{60, 180}, {90, 150}, {100, 250}} {
+
+		bpm, confidence, err := wav.EstimateBPM(r[0], r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(bpm - 120) > 0.5 {
+			t.Errorf("range %v: estimated %.2f BPM, expected 120", r, bpm)
+		}
+		if confidence < 0.5 {
+			t.Errorf("range %v: confidence only %.2f", r, confidence)
+		}
+	}
+}
+
+
+func TestEstimateBPMArrhythmic(t *testing.T) {
+
+	// Noise has no pulse; the confidence should say so.
+
+	_, confidence, err := noise_wav(20 * PREFERRED_FREQ, 6).EstimateBPM(60, 180)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confidence > 0.2 {
+		t.Fatalf("confidence %.2f for white noise", confidence)
+	}
+}
+
+
+func TestDetectOnsetsClicks(t *testing.T) {
+
+	// Irregularly spaced clicks, the closest 50 ms apart; each should be found within 3 ms, and
+	// nothing else.
+
+	positions := []uint32{1000, 12345, 14550, 30000, 52000, 54205, 80001, 95000}
+	wav := click_track(2 * PREFERRED_FREQ + 10000, positions)
+
+	const tolerance = 3 * PREFERRED_FREQ / 1000
+
+	for _, sensitivity := range []float64{0.2, 0.5, 0.8} {
+
+		onsets := wav.DetectOnsets(sensitivity)
+
+		if len(onsets) != len(positions) {
+			t.Fatalf("sensitivity %v: found %d onsets, expected %d: %v", sensitivity, len(onsets), len(positions), onsets)
+		}
+		for i, pos := range positions {
+			if diff := int64(onsets[i]) - int64(pos) ; diff < -tolerance || diff > tolerance {
+				t.Errorf("sensitivity %v: click at %d detected at %d", sensitivity, pos, onsets[i])
+			}
+		}
+	}
+
+	if onsets := New(PREFERRED_FREQ).DetectOnsets(1) ; len(onsets) != 0 {
+		t.Fatalf("found onsets in silence: %v", onsets)
+	}
+}
@@ -0,0 +1,104 @@
+package wavmaker
+
+import (
+	"encoding/binary"
+)
+
+// MinMax is the range of sample values in one overview column, as fractions of full scale
+// (the same scale as ToFloat64).
+
+type MinMax struct {
+	Min float64
+	Max float64
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) Overview(columns uint32) []MinMax {
+
+	// Min/max pairs of the mono sum for the whole file, one per column, as for drawing a waveform.
+
+	mono, _, _ := wav.overview(0, wav.FrameCount(), columns)
+	return mono
+}
+
+
+func (wav *WAV) OverviewStereo(columns uint32) ([]MinMax, []MinMax) {
+	_, left, right := wav.overview(0, wav.FrameCount(), columns)
+	return left, right
+}
+
+
+func (wav *WAV) OverviewRange(start, end uint32, columns uint32) []MinMax {
+
+	// As Overview, but for frames [start, end) only, e.g. when zoomed in. The range is clamped.
+
+	end = min(end, wav.FrameCount())
+	start = min(start, end)
+
+	mono, _, _ := wav.overview(start, end, columns)
+	return mono
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) overview(start, end uint32, columns uint32) ([]MinMax, []MinMax, []MinMax) {
+
+	// Column i covers frames from start + i * length / columns up to the next column's start.
+	// When there are more columns than frames, columns that would be empty just show the frame
+	// they fall on, so the picture is stretched rather than gappy.
+
+	mono := make([]MinMax, columns)
+	left := make([]MinMax, columns)
+	right := make([]MinMax, columns)
+
+	length := uint64(end - start)
+
+	if length == 0 {
+		return mono, left, right
+	}
+
+	fast := wav.fast_16_stereo()
+	data := wav.DataChunk.Data
+
+	for col := uint64(0) ; col < uint64(columns) ; col++ {
+
+		first := uint32(uint64(start) + col * length / uint64(columns))
+		last := uint32(uint64(start) + (col + 1) * length / uint64(columns))
+
+		if last <= first {
+			last = first + 1
+		}
+
+		mono_min, mono_max := int32(32767), int32(-32768)
+		left_min, left_max := int16(32767), int16(-32768)
+		right_min, right_max := int16(32767), int16(-32768)
+
+		for n := first ; n < last ; n++ {
+
+			var l, r int16
+
+			if fast {
+				l = int16(binary.LittleEndian.Uint16(data[n * 4:]))
+				r = int16(binary.LittleEndian.Uint16(data[n * 4 + 2:]))
+			} else {
+				l, r = wav.Get(n)
+			}
+
+			m := (int32(l) + int32(r)) / 2
+
+			mono_min, mono_max = min(mono_min, m), max(mono_max, m)
+			left_min, left_max = min(left_min, l), max(left_max, l)
+			right_min, right_max = min(right_min, r), max(right_max, r)
+		}
+
+		mono[col] = MinMax{sample_to_float(int16(mono_min)), sample_to_float(int16(mono_max))}
+		left[col] = MinMax{sample_to_float(left_min), sample_to_float(left_max)}
+		right[col] = MinMax{sample_to_float(right_min), sample_to_float(right_max)}
+	}
+
+	return mono, left, right
+}
@@ -0,0 +1,111 @@
+package wavmaker
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Below this many frames, splitting the work isn't worth the goroutines.
+
+const parallel_min_frames = 65536
+
+var parallelism atomic.Int32		// 0 means use GOMAXPROCS
+
+
+func SetParallelism(n int) {
+
+	// Sets how many goroutines whole-file operations may split their work across. Results are
+	// identical either way; 1 forces everything onto the calling goroutine, 0 restores the
+	// default of GOMAXPROCS.
+
+	if n < 0 {
+		n = 0
+	}
+	parallelism.Store(int32(n))
+}
+
+
+func parallel_frames(total uint32, fn func(start, end uint32) error) error {
+
+	// Calls fn over consecutive frame ranges that cover [0, total), concurrently where worthwhile.
+	// fn must only write to its own range. Returns the first error any call produced.
+
+	workers := parallel_workers(total / parallel_min_frames)
+
+	if workers <= 1 {
+		return fn(0, total)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+
+	chunk := (total + workers - 1) / workers
+
+	for w := uint32(0) ; w < workers ; w++ {
+
+		start := w * chunk
+		end := start + chunk
+		if end > total {
+			end = total
+		}
+		if start >= end {
+			break
+		}
+
+		wg.Add(1)
+		go func(w, start, end uint32) {
+			defer wg.Done()
+			errs[w] = fn(start, end)
+		}(w, start, end)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+
+func parallel_channels(channels int, frames uint32, fn func(ch int)) {
+
+	// Calls fn for each channel, concurrently if the channels are long enough to be worth it
+	// and parallelism allows. fn must only touch its own channel's data.
+
+	if parallel_workers(frames / parallel_min_frames) <= 1 {
+		for ch := 0 ; ch < channels ; ch++ {
+			fn(ch)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+
+	for ch := 0 ; ch < channels ; ch++ {
+		wg.Add(1)
+		go func(ch int) {
+			defer wg.Done()
+			fn(ch)
+		}(ch)
+	}
+
+	wg.Wait()
+}
+
+
+func parallel_workers(limit uint32) uint32 {
+
+	// How many goroutines to use, per SetParallelism(), but no more than limit.
+
+	workers := uint32(parallelism.Load())
+	if workers == 0 {
+		workers = uint32(runtime.GOMAXPROCS(0))
+	}
+
+	return min(workers, limit)
+}
@@ -0,0 +1,102 @@
+package wavmaker
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// The operations built on parallel_frames() or parallel_channels(), each run against the same
+// source. The in place ones work on a copy, and clip counts go in the first frame.
+
+var parallel_ops = []struct {
+	name string
+	run func(wav *WAV) *WAV
+}{
+	{"Stretched", func(wav *WAV) *WAV { return wav.Stretched(wav.FrameCount() * 11 / 10) }},
+	{"Repitched", func(wav *WAV) *WAV { return wav.Repitched(-3) }},
+	{"Resampled", func(wav *WAV) *WAV {
+		result, _ := wav.Resampled(48000)
+		return result
+	}},
+	{"Peak", func(wav *WAV) *WAV {
+		result := New(1)
+		result.Set(0, int16(wav.Peak() * 32767), 0)
+		return result
+	}},
+	{"Normalize", func(wav *WAV) *WAV { return wav.Copy().Normalize(0.7) }},
+	{"SetChannelGains", func(wav *WAV) *WAV {
+		result := wav.Copy()
+		left, right := result.SetChannelGains(1.9, 0.3)
+		result.Set(0, int16(left), int16(right))
+		return result
+	}},
+	{"ReverseRange", func(wav *WAV) *WAV {
+		result := wav.Copy()
+		result.ReverseRange(17, wav.FrameCount() - 4)
+		return result
+	}},
+	{"EQ3", func(wav *WAV) *WAV {
+		result := wav.Copy()
+		clipped, _ := result.EQ3(9, -3, 9, 200, 4000)
+		result.Set(0, int16(clipped), 0)
+		return result
+	}},
+	{"FilterSweep", func(wav *WAV) *WAV {
+		result := wav.Copy()
+		clipped, _ := result.FilterSweep(100, 10000, 8, true)
+		result.Set(0, int16(clipped), 0)
+		return result
+	}},
+	{"Notch (mono)", func(wav *WAV) *WAV {
+		result, _ := NewWithFormat(wav.FrameCount(), 44100, 1)
+		for n := uint32(0) ; n < wav.FrameCount() ; n++ {
+			left, right := wav.Get(n)
+			result.Set(n, left, right)
+		}
+		result.Notch(1000, 2)
+		return result
+	}},
+}
+
+
+func TestParallelMatchesSerial(t *testing.T) {
+
+	defer SetParallelism(0)
+
+	source := noise_wav(parallel_min_frames * 5 + 123, 6)		// Enough for several workers, unevenly split
+
+	for _, op := range parallel_ops {
+
+		SetParallelism(1)
+		serial := op.run(source)
+
+		for _, workers := range []int{2, 3, 8} {
+			SetParallelism(workers)
+			if !op.run(source).Equal(serial) {
+				t.Fatalf("%s with %d workers differs from the serial result", op.name, workers)
+			}
+		}
+	}
+}
+
+
+func BenchmarkParallel(b *testing.B) {
+
+	// Scaling on a 10 minute buffer; compare the workers=1 results with the others.
+
+	defer SetParallelism(0)
+
+	source := noise_wav(PREFERRED_FREQ * 600, 7)
+
+	for _, op := range parallel_ops {
+		for workers := 1 ; workers <= runtime.GOMAXPROCS(0) ; workers *= 2 {
+			b.Run(fmt.Sprintf("%s/workers=%d", op.name, workers), func(b *testing.B) {
+				SetParallelism(workers)
+				for i := 0 ; i < b.N ; i++ {
+					op.run(source)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package wavmaker
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func pink_noise(rate uint32, seconds float64, rms_dbfs float64, seed int64) *WAV {
+
+	// Stereo pink noise with the given RMS, from white noise through Paul Kellet's refined filter
+	// (within 0.05 dB of -3 dB/octave from 10 Hz up, at 44100 Hz). Levels are sine-referenced,
+	// as in the ReplayGain calibration, so 0 dBFS is the RMS of a full scale sine.
+
+	frames := uint32(seconds * float64(rate))
+	wav, _ := NewWithFormat(frames, rate, 2)
+	rng := rand.New(rand.NewSource(seed))
+
+	var signals [2][]float64
+	sum := 0.0
+
+	for ch := 0 ; ch < 2 ; ch++ {
+
+		var b [7]float64
+		signals[ch] = make([]float64, frames)
+
+		for n := range signals[ch] {
+			white := rng.NormFloat64()
+			b[0] = 0.99886 * b[0] + white * 0.0555179
+			b[1] = 0.99332 * b[1] + white * 0.0750759
+			b[2] = 0.96900 * b[2] + white * 0.1538520
+			b[3] = 0.86650 * b[3] + white * 0.3104856
+			b[4] = 0.55000 * b[4] + white * 0.5329522
+			b[5] = -0.7616 * b[5] - white * 0.0168980
+			signals[ch][n] = b[0] + b[1] + b[2] + b[3] + b[4] + b[5] + b[6] + white * 0.5362
+			b[6] = white * 0.115926
+			sum += signals[ch][n] * signals[ch][n]
+		}
+	}
+
+	scale := 32767 / math.Sqrt2 * math.Pow(10, rms_dbfs / 20) / math.Sqrt(sum / float64(2 * frames))
+
+	for n := uint32(0) ; n < frames ; n++ {
+		left, _ := round_clamp(signals[0][n] * scale)
+		right, _ := round_clamp(signals[1][n] * scale)
+		wav.Set(n, left, right)
+	}
+
+	return wav
+}
+
+
+func reference_replaygain(wav *WAV) float64 {
+
+	// A transcription of the reference implementation (gain_analysis.c) for comparison, kept close
+	// to the C: the coefficient tables interleaved as they are there, the filters written out as
+	// sums over the sample history, and the percentile found by walking a histogram.
+
+	ab_yule := map[uint32][21]float64{
+		44100: {0.05418656406430, -3.47845948550071, -0.02911007808948, 6.36317777566148, -0.00848709379851, -8.54751527471874,
+			-0.00851165645469, 9.47693607801280, -0.00834990904936, -8.81498681370155, 0.02245293253339, 6.85401540936998,
+			-0.02596338512915, -4.39470996079559, 0.01624864962975, 2.19611684890774, -0.00240879051584, -0.75104302451432,
+			0.00674613682247, 0.13149317958808, -0.00187763777362},
+		48000: {0.03857599435200, -3.84664617118067, -0.02160367184185, 7.81501653005538, -0.00123395316851, -11.34170355132042,
+			-0.00009291677959, 13.05504219327545, -0.01655260341619, -12.28759895145294, 0.02161526843274, 9.48293806319790,
+			-0.02074045215285, -5.87257861775999, 0.00594298065125, 2.75465861874613, 0.00306428023191, -0.86984376593551,
+			0.00012025322027, 0.13919314567432, 0.00288463683916},
+	}
+	ab_butter := map[uint32][5]float64{
+		44100: {0.98500175787242, -1.96977855582618, -1.97000351574484, 0.97022847566350, 0.98500175787242},
+		48000: {0.98621192462708, -1.97223372919527, -1.97242384925416, 0.97261396931306, 0.98621192462708},
+	}
+
+	const history = 10
+
+	frames := int(wav.FrameCount())
+	yule, butter := ab_yule[wav.FmtChunk.SampleRate], ab_butter[wav.FmtChunk.SampleRate]
+
+	var out [2][]float64
+
+	for ch := 0 ; ch < 2 ; ch++ {
+
+		in := make([]float64, history + frames)
+		step := make([]float64, history + frames)
+		out[ch] = make([]float64, history + frames)
+
+		for n := 0 ; n < frames ; n++ {
+			left, right := wav.Get(uint32(n))
+			in[history + n] = float64(left)
+			if ch == 1 {
+				in[history + n] = float64(right)
+			}
+		}
+
+		for i := history ; i < history + frames ; i++ {
+			y := in[i] * yule[0]
+			for k := 1 ; k <= 10 ; k++ {
+				y += - step[i - k] * yule[2 * k - 1] + in[i - k] * yule[2 * k]
+			}
+			step[i] = y
+		}
+
+		for i := history ; i < history + frames ; i++ {
+			out[ch][i] = step[i] * butter[0] - out[ch][i - 1] * butter[1] + step[i - 1] * butter[2] - out[ch][i - 2] * butter[3] + step[i - 2] * butter[4]
+		}
+	}
+
+	block := int(math.Ceil(float64(wav.FmtChunk.SampleRate) * 0.05))
+	histogram := make([]int, 100 * 120)
+	elems := 0
+
+	for start := history ; start + block <= history + frames ; start += block {
+		var lsum, rsum float64
+		for i := start ; i < start + block ; i++ {
+			lsum += out[0][i] * out[0][i]
+			rsum += out[1][i] * out[1][i]
+		}
+		ival := int(100 * 10 * math.Log10((lsum + rsum) / float64(block) * 0.5 + 1e-37))
+		ival = max(0, min(len(histogram) - 1, ival))
+		histogram[ival]++
+		elems++
+	}
+
+	upper := int(math.Ceil(float64(elems) * (1 - 0.95)))
+	i := len(histogram)
+
+	for i > 0 {
+		i--
+		upper -= histogram[i]
+		if upper <= 0 {
+			break
+		}
+	}
+
+	return 64.82 - float64(i) / 100
+}
+
+
+func TestReplayGainPinkNoise(t *testing.T) {
+
+	// Within 0.5 dB of the reference implementation. (In fact they should agree to the 0.01 dB
+	// step, bar rounding.) The calibration is also checked: pink noise at -20 dBFS is defined as
+	// 83 dB SPL, 6 dB below the ReplayGain target, so should get about +6 dB.
+
+	for _, rate := range []uint32{44100, 48000} {
+		for seed := int64(1) ; seed <= 3 ; seed++ {
+
+			wav := pink_noise(rate, 20, -20, seed)
+
+			gain, peak, err := wav.ReplayGain()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := reference_replaygain(wav) ; math.Abs(gain - want) > 0.5 {
+				t.Errorf("%d Hz, seed %d: gain %.2f dB, the reference gives %.2f", rate, seed, gain, want)
+			}
+			if math.Abs(gain - 6) > 1 {
+				t.Errorf("%d Hz, seed %d: gain %.2f dB for -20 dBFS pink noise, expected about +6", rate, seed, gain)
+			}
+			if peak != wav.Peak() {
+				t.Errorf("%d Hz, seed %d: peak %v is not Peak()'s %v", rate, seed, peak, wav.Peak())
+			}
+		}
+	}
+}
+
+
+func TestReplayGainOtherRates(t *testing.T) {
+
+	// Unsupported rates are refused. The documented workaround, resampling first, lands within
+	// 0.5 dB for pink noise.
+
+	wav := pink_noise(44100, 20, -20, 1)
+	want, _, _ := wav.ReplayGain()
+
+	for _, rate := range []uint32{22050, 32000, 96000} {
+
+		other, err := wav.Resampled(rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := other.ReplayGain() ; err == nil {
+			t.Fatalf("%d Hz was accepted", rate)
+		}
+
+		back, err := other.Resampled(44100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gain, _, _ := back.ReplayGain() ; math.Abs(gain - want) > 0.5 {
+			t.Errorf("via %d Hz: gain %.2f dB, expected %.2f", rate, gain, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package wavmaker
+
+import (
+	"errors"
+)
+
+// Snapshot is a saved state of a WAV, from Snapshot(), for Restore() to go back to. It's cheap to
+// take: the audio isn't copied, but shared with the WAV until one of them is next written to, at
+// which point that side copies it (like a memory-mapped WAV's data). So a snapshot costs nothing
+// until the WAV changes, and then one copy of the audio however many snapshots share it. The
+// metadata (format, chunks, tags) is small and copied outright.
+//
+// The copying is done by the WAV's own methods, so it only works if the audio is changed through
+// them. Writing to wav.DataChunk.Data directly bypasses it, and so writes into the buffer the
+// snapshots share, corrupting every one of them (just as it would write into a memory-mapped
+// file). Call wav.Copy() first, or go through Set() and the like.
+//
+// A snapshot of a memory-mapped WAV shares the mapping, so it can't be restored once that's been
+// unmapped.
+
+type Snapshot struct {
+	state WAV			// Never written to; its DataChunk.Data is shared
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) Snapshot() *Snapshot {
+
+	// Counts as modifying the WAV for concurrency purposes, since it marks the data as shared.
+
+	snap := &Snapshot{wav.copy_metadata()}
+	snap.state.DataChunk.Data = wav.DataChunk.Data
+
+	wav.borrowed = true
+
+	return snap
+}
+
+
+func (wav *WAV) Restore(snap *Snapshot) error {
+
+	// Puts the WAV back as it was when the snapshot was taken: audio, format and metadata. The
+	// Policy, and any recorded problem, are left alone. A snapshot can be restored any number of
+	// times, and onto a different WAV from the one it was taken of.
+
+	if snap == nil {
+		return errors.New("Restore(): nil snapshot")
+	}
+
+	state := snap.state.copy_metadata()
+	state.DataChunk.Data = snap.state.DataChunk.Data
+
+	wav.FmtChunk = state.FmtChunk
+	wav.FmtExtension = state.FmtExtension
+	wav.DataChunk = state.DataChunk
+	wav.ExtraChunks = state.ExtraChunks
+	wav.ID3 = state.ID3
+	wav.IXML = state.IXML
+	wav.ACID = state.ACID
+	wav.instrument = state.instrument
+
+	wav.borrowed = true
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package wavmaker
+
+import (
+	"fmt"
+	"math"
+)
+
+// Remainder says what SplitEvery does with a final piece shorter than the rest.
+
+type Remainder int
+
+const (
+	REMAINDER_DROP Remainder = iota		// Discard it
+	REMAINDER_KEEP						// Return it, short
+	REMAINDER_PAD						// Extend it with silence to the full length
+)
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) SecondsToFrames(seconds float64) uint32 {
+
+	// Rounds to the nearest frame. Negative times give 0; huge ones are capped.
+
+	f := math.Round(seconds * float64(wav.FmtChunk.SampleRate))
+
+	if f < 0 { f = 0 }
+	if f > math.MaxUint32 { f = math.MaxUint32 }
+
+	return uint32(f)
+}
+
+
+func (wav *WAV) FramesToSeconds(frames uint32) float64 {
+
+	if wav.FmtChunk.SampleRate == 0 {
+		return 0
+	}
+
+	return float64(frames) / float64(wav.FmtChunk.SampleRate)
+}
+
+
+func (wav *WAV) SplitEvery(frames uint32, remainder Remainder) ([]*WAV, error) {
+
+	// Chops the audio into consecutive pieces of the given length, each an independent WAV in the
+	// same format. A length of 0 gives no pieces. The only error is a REMAINDER_PAD piece that would
+	// be too big to exist.
+
+	var ret []*WAV
+
+	if frames == 0 {
+		return ret, nil
+	}
+
+	total := wav.FrameCount()
+
+	for start := uint32(0) ; start < total ; start += frames {
+
+		end := start + frames
+
+		if end > total || end < start {		// Second test is for uint wrap-around
+
+			if remainder == REMAINDER_DROP {
+				break
+			}
+
+			piece := wav.frames_copy(start, total)
+
+			if remainder == REMAINDER_PAD {
+				if uint64(frames) * uint64(wav.FmtChunk.BlockAlign) > math.MaxUint32 {
+					return nil, fmt.Errorf("SplitEvery(): padding the last piece to %d frames would make it too large", frames)
+				}
+				padded := wav.blank_copy(frames)
+				copy(padded.DataChunk.Data, piece.DataChunk.Data)
+				piece = padded
+			}
+
+			ret = append(ret, piece)
+			break
+		}
+
+		ret = append(ret, wav.frames_copy(start, end))
+	}
+
+	return ret, nil
+}
+
+
+func (wav *WAV) SplitEverySeconds(seconds float64, remainder Remainder) ([]*WAV, error) {
+	return wav.SplitEvery(wav.SecondsToFrames(seconds), remainder)
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) frames_copy(start, end uint32) *WAV {
+
+	// A new WAV holding frames [start, end), which the caller must have checked are in range.
+
+	stride := uint32(wav.FmtChunk.BlockAlign)
+
+	new_wav := wav.blank_copy(end - start)
+	copy(new_wav.DataChunk.Data, wav.DataChunk.Data[start * stride:end * stride])
+
+	return new_wav
+}
@@ -0,0 +1,119 @@
+package wavmaker
+
+import (
+	"errors"
+)
+
+// The most wet gain HaasWiden() allows, which keeps dual mono material mono compatible (see there).
+
+const HAAS_MAX_WET_GAIN = 0.7
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) ToMidSide() *WAV {
+
+	// Converts in place from left/right to mid/side: the mid (L + R) / 2 goes in the left slot and
+	// the side (L - R) / 2 in the right. The halving means this can't clip. FromMidSide() undoes
+	// it, to within 1 LSB. Mono WAVs are left alone.
+
+	if wav.FmtChunk.NumChannels != 2 || wav.Err() != nil {
+		return wav
+	}
+
+	frames := wav.FrameCount()
+
+	for n := uint32(0) ; n < frames ; n++ {
+		left, right := wav.Get(n)
+		mid  := (int32(left) + int32(right)) / 2
+		side := (int32(left) - int32(right)) / 2
+		wav.Set(n, int16(mid), int16(side))
+	}
+
+	return wav
+}
+
+
+func (wav *WAV) FromMidSide() uint32 {
+
+	// The inverse of ToMidSide(), returning the number of samples clamped (only possible if the
+	// mid/side data was processed to be louder). Mono WAVs are left alone.
+
+	if wav.FmtChunk.NumChannels != 2 {
+		return 0
+	}
+
+	clipped := uint32(0)
+	frames := wav.FrameCount()
+
+	for n := uint32(0) ; n < frames ; n++ {
+
+		mid, side := wav.Get(n)
+
+		left  := int32(mid) + int32(side)
+		right := int32(mid) - int32(side)
+
+		if left  < -32768 { left  = -32768 ; clipped++ }
+		if left  >  32767 { left  =  32767 ; clipped++ }
+		if right < -32768 { right = -32768 ; clipped++ }
+		if right >  32767 { right =  32767 ; clipped++ }
+
+		wav.Set(n, int16(left), int16(right))
+	}
+
+	return clipped
+}
+
+
+func (wav *WAV) HaasWiden(delay_ms float64, wet_gain float64) (uint32, error) {
+
+	// A Haas-effect widener, in place: the left channel, delayed by 5 to 35 ms and scaled by
+	// wet_gain (clamped to 0-HAAS_MAX_WET_GAIN), is added to the right. The delayed copy fades in
+	// over its first delay period, so there's no pop where the delay line starts. Returns the
+	// number of samples clamped.
+	//
+	// Mono compatibility: for dual mono input, PhaseCorrelation() afterwards is at least
+	// sqrt(1 - wet_gain^2), whatever the material (barring clamping). With x the input and y the
+	// delayed copy, it's (1 + g r) / sqrt(1 + 2 g r + g^2), where g is wet_gain scaled by how
+	// much of x's energy y has, and r is their correlation; that's smallest, at sqrt(1 - g^2),
+	// when r = -g. So the cap on wet_gain keeps it at 0.71 or more. Typical material, which isn't
+	// correlated with itself 5 ms later like that, does better: about 0.82 for noise.
+
+	if wav.FmtChunk.NumChannels != 2 {
+		return 0, errors.New("HaasWiden(): needs a stereo WAV")
+	}
+	if !(delay_ms >= 5 && delay_ms <= 35) {
+		return 0, errors.New("HaasWiden(): delay must be between 5 and 35 ms")
+	}
+
+	wet_gain = max(0, min(HAAS_MAX_WET_GAIN, wet_gain))
+
+	delay := uint32(delay_ms * float64(wav.FmtChunk.SampleRate) / 1000)
+	frames := wav.FrameCount()
+
+	if delay == 0 || wet_gain == 0 {
+		return 0, nil
+	}
+
+	clipped := uint32(0)
+
+	for i := delay ; i < frames ; i++ {
+
+		delayed_left, _ := wav.Get(i - delay)
+		left, right := wav.Get(i)
+
+		gain := wet_gain
+		if i - delay < delay {
+			gain *= float64(i - delay) / float64(delay)
+		}
+
+		new_right := int32(right) + int32(float64(delayed_left) * gain)
+
+		if new_right < -32768 { new_right = -32768 ; clipped++ }
+		if new_right >  32767 { new_right =  32767 ; clipped++ }
+
+		wav.Set(i, left, int16(new_right))
+	}
+
+	return clipped, nil
+}
@@ -0,0 +1,96 @@
+package wavmaker
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaasWidenMonoCompatible(t *testing.T) {
+
+	// Dual mono in, correlation at least sqrt(1 - g^2) out. The worst case is a sine whose phase
+	// moves by acos(-g) over the delay, which should land right on the bound; noise does better.
+
+	delay_ms := 10.0
+	delay_seconds := delay_ms / 1000
+
+	for _, wet_gain := range []float64{0.2, 0.5, 0.7, 1.0} {
+
+		g := min(wet_gain, HAAS_MAX_WET_GAIN)
+		bound := math.Sqrt(1 - g * g)
+		worst_freq := math.Acos(-g) / (2 * math.Pi * delay_seconds)
+
+		for _, freq := range []float64{0, worst_freq, 130, 440, 2000} {
+
+			var wav *WAV
+			if freq == 0 {
+				wav = noise_wav(PREFERRED_FREQ, 5)
+				wav.Normalize(0.25)
+			} else {
+				wav = New(PREFERRED_FREQ)
+				for n := uint32(0) ; n < PREFERRED_FREQ ; n++ {
+					val := int16(10000 * math.Sin(2 * math.Pi * freq * float64(n) / PREFERRED_FREQ))
+					wav.Set(n, val, val)
+				}
+			}
+			for n := uint32(0) ; n < wav.FrameCount() ; n++ {
+				left, _ := wav.Get(n)
+				wav.Set(n, left, left)
+			}
+
+			clipped, err := wav.HaasWiden(delay_ms, wet_gain)
+			if err != nil || clipped != 0 {
+				t.Fatalf("HaasWiden() failed, or clamped %d samples: %v", clipped, err)
+			}
+
+			corr := wav.PhaseCorrelation()
+
+			if corr < bound - 0.005 {
+				t.Errorf("wet gain %v, %.1f Hz: correlation %.3f is below the bound %.3f", wet_gain, freq, corr, bound)
+			}
+			if freq == worst_freq && corr > bound + 0.02 {
+				t.Errorf("wet gain %v: the worst case sine gave %.3f, not close to the bound %.3f", wet_gain, corr, bound)
+			}
+		}
+	}
+}
+
+
+func TestHaasWidenNeedsStereo(t *testing.T) {
+
+	mono, _ := NewWithFormat(1000, PREFERRED_FREQ, 1)
+
+	if _, err := mono.HaasWiden(10, 0.5); err == nil {
+		t.Fatalf("HaasWiden() accepted a mono WAV")
+	}
+}
+
+
+func TestMidSideRoundTrip(t *testing.T) {
+
+	// Random data, plus every combination of the extremes, comes back within 1 LSB and unclamped.
+
+	original := noise_wav(50000, 8)
+
+	extremes := []int16{-32768, -32767, -1, 0, 1, 32766, 32767}
+	n := uint32(0)
+	for _, left := range extremes {
+		for _, right := range extremes {
+			original.Set(n, left, right)
+			n++
+		}
+	}
+
+	wav := original.Copy().ToMidSide()
+
+	if clipped := wav.FromMidSide() ; clipped != 0 {
+		t.Fatalf("%d samples were clamped", clipped)
+	}
+
+	for n := uint32(0) ; n < wav.FrameCount() ; n++ {
+		left, right := wav.Get(n)
+		want_left, want_right := original.Get(n)
+		if abs_diff(int(left), int(want_left)) > 1 || abs_diff(int(right), int(want_right)) > 1 {
+			t.Fatalf("frame %d came back as %d, %d, was %d, %d", n, left, right, want_left, want_right)
+		}
+	}
+}
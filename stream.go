@@ -0,0 +1,231 @@
+package wavmaker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// PCMReader streams a WAV's audio as an io.Reader and io.Seeker, optionally preceded by a
+// header so that the stream is itself a playable WAV file. It reads the WAV's data directly,
+// so the WAV shouldn't be modified while a reader is in use.
+
+type PCMReader struct {
+	parts [][]byte
+	size int64
+	pos int64
+}
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func NewPCMReader(wav *WAV) *PCMReader {
+
+	// Just the interleaved samples from DataChunk.Data, i.e. 16-bit little-endian for anything Load() made.
+
+	return new_pcm_reader(wav.DataChunk.Data)
+}
+
+
+func NewWAVReader(wav *WAV) *PCMReader {
+
+	// The same bytes Save() would write.
+
+	return new_pcm_reader(wav.header(), wav.DataChunk.Data, wav.trailer())
+}
+
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (r *PCMReader) Read(p []byte) (int, error) {
+
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	offset := int64(0)
+
+	for _, part := range r.parts {
+
+		if len(p) == 0 {
+			break
+		}
+
+		part_end := offset + int64(len(part))
+
+		if r.pos < part_end {
+			copied := copy(p, part[r.pos - offset:])
+			p = p[copied:]
+			r.pos += int64(copied)
+			n += copied
+		}
+
+		offset = part_end
+	}
+
+	return n, nil
+}
+
+
+func (r *PCMReader) Seek(offset int64, whence int) (int64, error) {
+
+	var pos int64
+
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return r.pos, errors.New("PCMReader.Seek(): invalid whence")
+	}
+
+	if pos < 0 {
+		return r.pos, errors.New("PCMReader.Seek(): negative position")
+	}
+
+	r.pos = pos
+	return pos, nil
+}
+
+
+func (r *PCMReader) Len() int {
+
+	// How many bytes remain to be read.
+
+	if r.pos >= r.size {
+		return 0
+	}
+	return int(r.size - r.pos)
+}
+
+
+func (wav *WAV) ReadFrom(r io.Reader) (int64, error) {
+
+	// Implements io.ReaderFrom, appending raw interleaved frames (in the WAV's own format, so 16-bit
+	// stereo for anything made by Load() or New()) from r until EOF. If the stream ends part way
+	// through a frame, that partial frame is discarded. The return value counts every byte read
+	// from r, including any discarded ones.
+
+	stride := int(wav.FmtChunk.BlockAlign)
+	if stride == 0 {
+		return 0, errors.New("ReadFrom(): block align was zero")
+	}
+
+	wav.own_data()
+	wav.DataChunk.Data = wav.DataChunk.Data[:wav.DataChunk.Size]		// Paranoia
+
+	buf := make([]byte, 65536 - 65536 % stride + stride)		// Room for a partial frame plus whole frames
+	pending := 0													// Bytes of an incomplete frame at the start of buf
+
+	total := int64(0)
+
+	for {
+		n, err := r.Read(buf[pending:])
+		total += int64(n)
+		pending += n
+
+		whole := pending - pending % stride
+
+		if uint64(len(wav.DataChunk.Data)) + uint64(whole) > math.MaxUint32 {
+			return total, errors.New("ReadFrom(): data would exceed the maximum WAV size")
+		}
+
+		wav.DataChunk.Data = append(wav.DataChunk.Data, buf[:whole]...)
+		wav.DataChunk.Size = uint32(len(wav.DataChunk.Data))
+
+		pending = copy(buf, buf[whole:pending])
+
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, fmt.Errorf("ReadFrom(): %w", err)
+		}
+	}
+}
+
+
+func (wav *WAV) WriteTo(w io.Writer) (int64, error) {
+
+	// Implements io.WriterTo, writing the same bytes Save() would. Note this is a whole WAV file,
+	// unlike ReadFrom() which deals in raw frames.
+
+	total := int64(0)
+
+	for _, part := range [][]byte{wav.header(), wav.DataChunk.Data, wav.trailer()} {
+		n, err := w.Write(part)
+		total += int64(n)
+		if err != nil {
+			return total, fmt.Errorf("WriteTo(): %w", err)
+		}
+	}
+
+	return total, nil
+}
+
+
+func (wav *WAV) Bytes() []byte {
+
+	// The complete file as Save() would write it, in a new slice.
+
+	var buf bytes.Buffer
+	buf.Grow(int(wav.encoded_size()))
+
+	wav.WriteTo(&buf)		// Can't fail
+	return buf.Bytes()
+}
+
+
+func (wav *WAV) MarshalBinary() ([]byte, error) {
+	return wav.Bytes(), nil
+}
+
+
+func (wav *WAV) UnmarshalBinary(b []byte) error {
+
+	// The inverse of MarshalBinary. Unlike LoadBytes(), the format is kept exactly as found, so
+	// a round trip gives back an identical WAV. The receiver's error policy and logger are kept.
+
+	loaded, err := load_reader(context.Background(), bytes.NewReader(b), "<bytes>",
+		LoadOptions{KeepFormat: true, Logger: Discard, MaxDataBytes: math.MaxUint32})
+	if err != nil {
+		return fmt.Errorf("UnmarshalBinary(): %w", err)
+	}
+
+	loaded.Policy = wav.Policy
+	loaded.Logger = wav.Logger
+	*wav = *loaded
+
+	return nil
+}
+
+
+// ------------------------------------- NON-EXPOSED METHODS
+
+
+func (wav *WAV) encoded_size() int64 {
+	return int64(len(wav.header())) + int64(len(wav.DataChunk.Data)) + int64(len(wav.trailer()))
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func new_pcm_reader(parts ...[]byte) *PCMReader {
+
+	r := &PCMReader{parts: parts}
+
+	for _, part := range parts {
+		r.size += int64(len(part))
+	}
+
+	return r
+}
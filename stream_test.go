@@ -0,0 +1,103 @@
+package wavmaker
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"testing"
+)
+
+var _ encoding.BinaryMarshaler = (*WAV)(nil)
+var _ encoding.BinaryUnmarshaler = (*WAV)(nil)
+
+
+func check_binary_round_trip(t *testing.T, name string, wav *WAV) *WAV {
+
+	// Marshals and unmarshals the WAV, checking the result is the same WAV and marshals to the
+	// same bytes. Returns it for any further checks.
+
+	b, err := wav.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	got := &WAV{Policy: POLICY_ERROR}
+
+	if err := got.UnmarshalBinary(b) ; err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	again, _ := got.MarshalBinary()
+
+	if !got.Equal(wav) || !bytes.Equal(again, b) || got.FmtChunk != wav.FmtChunk {
+		t.Fatalf("%s: the round trip changed the WAV", name)
+	}
+	if got.Policy != POLICY_ERROR {
+		t.Fatalf("%s: the receiver's policy wasn't kept", name)
+	}
+
+	return got
+}
+
+
+func TestBinaryRoundTripConverted(t *testing.T) {
+
+	// A WAV as Load() leaves it, after converting from 8-bit mono.
+
+	wav, err := LoadBytes(mono8_file(999))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check_binary_round_trip(t, "converted", wav)
+}
+
+
+func TestBinaryRoundTripFormats(t *testing.T) {
+
+	// Formats Load() would convert are kept as they are, odd data length included.
+
+	mono8, err := load_reader(context.Background(), bytes.NewReader(mono8_file(999)), "8-bit", LoadOptions{KeepFormat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mono16, _ := NewWithFormat(500, 48000, 1)
+	for n := uint32(0) ; n < 500 ; n++ {
+		mono16.Set(n, int16(n * 50), 0)
+	}
+
+	check_binary_round_trip(t, "8-bit mono", mono8)
+	check_binary_round_trip(t, "16-bit mono at 48000 Hz", mono16)
+	check_binary_round_trip(t, "24-bit extensible", extensible_wav(1, 24))
+}
+
+
+func TestBinaryRoundTripMetadata(t *testing.T) {
+
+	wav, err := LoadBytes(chunk_rich_file())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wav.ID3.Title = "Marshalled"
+
+	got := check_binary_round_trip(t, "metadata", wav)
+
+	if got.ID3.Title != "Marshalled" || got.IXML != wav.IXML || *got.ACID != *wav.ACID || len(got.ExtraChunks) != len(wav.ExtraChunks) {
+		t.Fatalf("metadata was lost")
+	}
+	for i, chunk := range got.ExtraChunks {
+		if chunk.ID != wav.ExtraChunks[i].ID || !bytes.Equal(chunk.Data, wav.ExtraChunks[i].Data) {
+			t.Fatalf("extra chunk %d changed", i)
+		}
+	}
+}
+
+
+func TestUnmarshalBinaryBadInput(t *testing.T) {
+
+	wav := New(10)
+
+	if err := wav.UnmarshalBinary([]byte("RIFF")) ; err == nil {
+		t.Fatalf("a truncated file was accepted")
+	}
+}
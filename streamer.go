@@ -0,0 +1,71 @@
+package wavmaker
+
+import (
+	"fmt"
+)
+
+// Streamer plays a WAV's frames out as [2]float64 pairs in the range -1 to 1. Its methods have the
+// same shape as the Streamer / StreamSeeker interfaces of playback libraries like faiface/beep,
+// so a trivial adapter (or none) is needed to use one there. Like PCMReader, it reads the WAV
+// directly, so the WAV shouldn't be modified while it's in use.
+
+type Streamer struct {
+	wav *WAV
+	pos int
+	err error
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) Streamer() *Streamer {
+	return &Streamer{wav: wav}
+}
+
+
+func (s *Streamer) Stream(samples [][2]float64) (int, bool) {
+
+	// Fills samples from the current position, returning how many were filled. The bool is false
+	// once the WAV is exhausted and nothing at all was filled.
+
+	frames := s.Len()
+
+	n := 0
+
+	for n < len(samples) && s.pos < frames {
+		left, right := s.wav.Get(uint32(s.pos))
+		samples[n][0] = sample_to_float(left)
+		samples[n][1] = sample_to_float(right)
+		n++
+		s.pos++
+	}
+
+	return n, n > 0
+}
+
+
+func (s *Streamer) Err() error {
+	return s.err
+}
+
+
+func (s *Streamer) Len() int {
+	return int(s.wav.FrameCount())
+}
+
+
+func (s *Streamer) Position() int {
+	return s.pos
+}
+
+
+func (s *Streamer) Seek(frame int) error {
+
+	if frame < 0 || frame > s.Len() {
+		s.err = fmt.Errorf("Streamer.Seek(): frame %d out of range 0-%d", frame, s.Len())
+		return s.err
+	}
+
+	s.pos = frame
+	return nil
+}
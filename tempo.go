@@ -0,0 +1,49 @@
+package wavmaker
+
+import (
+	"math"
+)
+
+// Tempo converts musical positions to frames. Positions are always computed directly from the
+// beat number, never by adding up per-beat steps, so there's no cumulative rounding drift.
+
+type Tempo struct {
+	BPM float64
+	SampleRate uint32
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (t Tempo) FramesPerBeat() float64 {
+
+	if t.BPM <= 0 {
+		return 0
+	}
+
+	return 60 * float64(t.SampleRate) / t.BPM
+}
+
+
+func (t Tempo) FrameAtBeat(beat float64) uint32 {
+
+	// Beat 0 is frame 0. Rounds to the nearest frame; negative results give 0.
+
+	f := math.Round(beat * 60 * float64(t.SampleRate) / t.BPM)
+
+	if t.BPM <= 0 || f < 0 || math.IsNaN(f) { return 0 }
+	if f > math.MaxUint32 { return math.MaxUint32 }
+
+	return uint32(f)
+}
+
+
+// ------------------------------------- EXPOSED FUNCTIONS
+
+
+func AddAtBeat(target *WAV, tempo Tempo, beat float64, source *WAV, volume float64, fadeout uint32) uint32 {
+
+	// Adds the whole source at the given beat, as Add() would. Returns the clip count.
+
+	return target.Add(tempo.FrameAtBeat(beat), source, 0, source.FrameCount(), volume, fadeout)
+}
@@ -0,0 +1,68 @@
+package wavmaker
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestTempoNoDrift(t *testing.T) {
+
+	// Ten minutes at an awkward tempo. Every beat must land on the frame worked out exactly
+	// (in rationals) from its number; adding up FramesPerBeat() instead would be off by now.
+
+	tempo := Tempo{BPM: 133.33, SampleRate: 44100}
+
+	bpm := new(big.Rat).SetFloat64(tempo.BPM)
+	beats := int64(1333)
+
+	for k := int64(0) ; k <= beats ; k++ {
+
+		exact := new(big.Rat).SetInt64(k * 60 * 44100)
+		exact.Quo(exact, bpm)
+		exact.Add(exact, big.NewRat(1, 2))
+
+		want := new(big.Int).Quo(exact.Num(), exact.Denom())		// Floor of exact + 0.5
+
+		if got := tempo.FrameAtBeat(float64(k)) ; uint64(got) != want.Uint64() {
+			t.Fatalf("beat %d is at frame %d, expected %d", k, got, want.Uint64())
+		}
+	}
+}
+
+
+func TestAddAtBeatLastBeat(t *testing.T) {
+
+	// A one frame click on every beat of ten minutes: the last lands at 1333 * 60 * 44100 / 133.33
+	// frames, rounded, where a rounded per beat step (19845) would have put it at 26453385.
+
+	if testing.Short() {
+		t.Skip("makes ten minutes of audio")
+	}
+
+	tempo := Tempo{BPM: 133.33, SampleRate: 44100}
+	beats := 1333
+
+	const last_frame = 26454046
+
+	target, _ := NewWithFormat(last_frame + 100, 44100, 1)
+	click, _ := NewWithFormat(1, 44100, 1)
+	click.Set(0, 1000, 1000)
+
+	for k := 0 ; k <= beats ; k++ {
+		AddAtBeat(target, tempo, float64(k), click, 1, 0)
+	}
+
+	if last, _ := target.Get(last_frame) ; last != 1000 {
+		t.Fatalf("the last beat isn't at frame %d", last_frame)
+	}
+
+	count := 0
+	for n := uint32(0) ; n < target.FrameCount() ; n++ {
+		if left, _ := target.Get(n) ; left != 0 {
+			count++
+		}
+	}
+	if count != beats + 1 {
+		t.Fatalf("found %d clicks, expected %d", count, beats + 1)
+	}
+}
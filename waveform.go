@@ -0,0 +1,98 @@
+package wavmaker
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// WaveformOptions controls RenderWaveformPNG. Nil colours get defaults (white background,
+// dark blue waveform, grey centre line).
+
+type WaveformOptions struct {
+	Background color.Color
+	Foreground color.Color
+	CentreLine bool
+	CentreLineColour color.Color
+	Stereo bool				// Draw each channel in its own half (left on top) instead of the mono sum
+}
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) RenderWaveformPNG(w io.Writer, width, height int, opts WaveformOptions) error {
+
+	// Draws the classic min/max waveform, one Overview() column per pixel, and writes it as a PNG.
+
+	if width <= 0 || height <= 0 {
+		return errors.New("RenderWaveformPNG(): width and height must be positive")
+	}
+
+	if opts.Background == nil {
+		opts.Background = color.White
+	}
+	if opts.Foreground == nil {
+		opts.Foreground = color.RGBA{0x20, 0x40, 0x90, 0xff}
+	}
+	if opts.CentreLineColour == nil {
+		opts.CentreLineColour = color.Gray{0xa0}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0 ; y < height ; y++ {
+		for x := 0 ; x < width ; x++ {
+			img.Set(x, y, opts.Background)
+		}
+	}
+
+	if opts.Stereo {
+		left, right := wav.OverviewStereo(uint32(width))
+		draw_lane(img, left, 0, height / 2, opts)
+		draw_lane(img, right, height / 2, height - height / 2, opts)
+	} else {
+		draw_lane(img, wav.Overview(uint32(width)), 0, height, opts)
+	}
+
+	err := png.Encode(w, img)
+	if err != nil {
+		return fmt.Errorf("RenderWaveformPNG(): %w", err)
+	}
+
+	return nil
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func draw_lane(img *image.RGBA, columns []MinMax, top int, lane_height int, opts WaveformOptions) {
+
+	// Draws the columns into the horizontal strip of the image starting at row top.
+
+	if lane_height <= 0 {
+		return
+	}
+
+	centre := top + lane_height / 2
+
+	if opts.CentreLine {
+		for x := range columns {
+			img.Set(x, centre, opts.CentreLineColour)
+		}
+	}
+
+	to_row := func(v float64) int {		// +1.0 is the top row of the lane, -1.0 the bottom
+		row := top + int((1 - v) / 2 * float64(lane_height - 1) + 0.5)
+		return max(top, min(top + lane_height - 1, row))
+	}
+
+	for x, col := range columns {
+		for y := to_row(col.Max) ; y <= to_row(col.Min) ; y++ {
+			img.Set(x, y, opts.Foreground)
+		}
+	}
+}
@@ -1,17 +1,65 @@
 package wavmaker
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
 	"strings"
+	"sync"
 )
 
 const PREFERRED_FREQ = 44100
 
+// The range of rates we're willing to convert to.
+
+const MIN_SAMPLE_RATE = 1000
+const MAX_SAMPLE_RATE = 768000
+
+// How many frames the long-running ...Context() operations process between checks of ctx.Err()
+
+const context_check_frames = 4096
+
+// ErrorPolicy controls what a WAV does when a method that has no error return
+// (Get, Set, Add and friends) runs into a problem, e.g. an out of bounds frame.
+// Whatever the policy, once Err() is non-nil the chainable methods (the ones that
+// return the WAV itself, e.g. the fades) do nothing until ClearErr(); see Then().
+
+type ErrorPolicy int
+
+const (
+	POLICY_WARN_ONCE ErrorPolicy = iota		// Warn the first time each kind of problem happens (the default); see WAV.Logger
+	POLICY_SILENT							// Say nothing
+	POLICY_ERROR							// Record the first problem, which can be retrieved via Err()
+	POLICY_PANIC							// Panic
+)
+
+// Concurrency: methods that only read the audio (Get, FrameCount, Peak, Copy, Save and so on) are
+// safe to call from several goroutines at once. Methods that modify a WAV (Set, Add, the fades...)
+// need the caller to ensure nothing else is using that WAV, in the usual Go way. Problem reporting
+// (see ErrorPolicy) is internally synchronised, so out of bounds reads don't count as writes.
+
 type WAV struct {
 	FmtChunk FmtChunk_Struct
+	FmtExtension []byte			// The fmt chunk's bytes past the basic 16 (cbSize onwards), e.g. for WAVE_FORMAT_EXTENSIBLE
 	DataChunk DataChunk_Struct
+	Policy ErrorPolicy
+	Logger Logger				// Where POLICY_WARN_ONCE warnings go; nil means the package logger (see SetLogger)
+	ExtraChunks []RawChunk		// Chunks the loader doesn't handle itself, in file order; Save() writes them after the data
+	ID3 ID3Tags					// From an "id3 " chunk, if there was one
+	IXML string					// The XML of an iXML chunk, exactly as found; see ParseIXML()
+	ACID *ACIDInfo				// From an "acid" chunk; nil if none
+	Warnings []error			// Problems worked around in making this WAV, e.g. a malformed metadata chunk the loader skipped
+
+	warned uint32		// Bitfield of the problem kinds we've already warned about
+	err error			// First problem recorded, under POLICY_ERROR or by a failed Then() step under any policy
+	borrowed bool		// DataChunk.Data isn't ours to write to (e.g. it's memory-mapped, or shared with a Snapshot) so copy it first
+	instrument *Instrument		// From an "inst" chunk, via SetInstrument() or the loader; nil if none
 }
 
 type FmtChunk_Struct struct {
@@ -29,41 +77,267 @@ type DataChunk_Struct struct {
 	Data []byte
 }
 
-var have_warned_get_out_of_bounds bool = false
-var have_warned_set_out_of_bounds bool = false
-var have_warned_clipping bool = false
+// RawChunk is any other RIFF chunk, kept as it was found. Data doesn't include the pad byte.
+
+type RawChunk struct {
+	ID [4]byte
+	Data []byte
+}
+
+// LoadOptions adjusts what the loader does. The zero value gives exactly the behaviour of Load().
+
+type LoadOptions struct {
+	Lenient bool			// Accept a truncated data chunk, keeping whatever whole frames are present
+	Logger Logger			// Where conversion messages go; nil means the package logger (see SetLogger)
+	MaxDataBytes uint32		// Refuse data chunks larger than this; 0 means DEFAULT_MAX_DATA_BYTES
+	SampleRate uint32		// The rate to convert to; 0 means PREFERRED_FREQ
+	KeepFormat bool			// Don't convert at all, keeping the file's own rate, channels and bit depth
+	DropExtraChunks bool	// Skip unrecognised chunks rather than keeping them in ExtraChunks
+}
+
+const DEFAULT_MAX_DATA_BYTES = 1 << 30
+
+// Logger receives the package's informational messages and warnings. Messages have no trailing newline.
+
+type Logger func(format string, args ...any)
+
+// Discard is a Logger that throws everything away. It's the package logger unless SetLogger() is used.
+
+var Discard Logger = func(format string, args ...any) {}
+
+// Stderr is a Logger that writes each message to stderr, on its own line.
+
+var Stderr Logger = func(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format + "\n", args...)
+}
+
+// Errors returned (wrapped) by Validate(), so callers can test for them with errors.Is()...
+
+var (
+	ErrFmtSize = errors.New("fmt chunk size did not match its contents")
+	ErrAudioFormat = errors.New("audio format was not 1 (PCM), 3 (float) or 0xFFFE (extensible)")
+	ErrFmtExtension = errors.New("fmt extension was wrong for the audio format")
+	ErrFloatBits = errors.New("float audio was not 32 or 64 bit")
+	ErrNumChannels = errors.New("num channels > 2")
+	ErrByteRate = errors.New("byte rate did not match other fmt fields")
+	ErrBlockAlign = errors.New("block align did not match other fmt fields")
+	ErrZeroBlockAlign = errors.New("block align was zero")
+	ErrDataSize = errors.New("data chunk size did not match amount of data read")
+	ErrDataAlign = errors.New("data chunk size was not a multiple of block align")
+)
+
+// Guards the warned and err fields of every WAV. Problems are rare so a single lock is fine.
+
+var report_mutex sync.Mutex
+
+// The package logger, used for POLICY_WARN_ONCE warnings and by default when loading. Silent
+// unless the caller asks otherwise, since a library shouldn't write to stderr by itself...
+
+var logger Logger = Discard
+var logger_mutex sync.Mutex
+
+// Kinds of problem, used so that POLICY_WARN_ONCE can warn once per kind...
+
+const (
+	problem_get_bounds uint32 = 1 << iota
+	problem_set_bounds
+	problem_save_invalid
+	problem_rate_mismatch
+	problem_too_large
+	problem_format
+)
+
+// The last 14 bytes of the standard WAVE_FORMAT_EXTENSIBLE SubFormat GUIDs, whose first 2 bytes
+// are the format code (1 for PCM, 3 for float).
+
+var extensible_guid_suffix = []byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
 
 
 // ------------------------------------- EXPOSED METHODS
 
 
 func (wav *WAV) String() string {
-	length := float64(wav.FrameCount()) / float64(wav.FmtChunk.SampleRate)
-	return fmt.Sprintf("<WAV: %d channel, %d bit, %d Hz, %d frames, %.2f seconds>",
-		wav.FmtChunk.NumChannels,
+
+	// One line, e.g. <WAV: stereo 16-bit 44100 Hz, 132300 frames, 3.000 s, peak -2.1 dBFS>
+
+	var channels string
+
+	switch wav.FmtChunk.NumChannels {
+	case 1:
+		channels = "mono"
+	case 2:
+		channels = "stereo"
+	default:
+		channels = fmt.Sprintf("%d-channel", wav.FmtChunk.NumChannels)
+	}
+
+	length := 0.0
+	if wav.FmtChunk.SampleRate > 0 {
+		length = float64(wav.FrameCount()) / float64(wav.FmtChunk.SampleRate)
+	}
+
+	return fmt.Sprintf("<WAV: %s %d-bit %d Hz, %d frames, %.3f s, peak %.1f dBFS>",
+		channels,
 		wav.FmtChunk.BitsPerSample,
 		wav.FmtChunk.SampleRate,
 		wav.FrameCount(),
 		length,
+		wav.PeakDB(),
 	)
 }
 
 
+func (wav *WAV) SetErrorPolicy(policy ErrorPolicy) {
+	wav.Policy = policy
+}
+
+
+func (wav *WAV) Err() error {
+	report_mutex.Lock()
+	defer report_mutex.Unlock()
+	return wav.err
+}
+
+
+func (wav *WAV) ClearErr() {
+	report_mutex.Lock()
+	defer report_mutex.Unlock()
+	wav.err = nil
+	wav.warned = 0
+}
+
+
+func (wav *WAV) Then(step func(wav *WAV) error) *WAV {
+
+	// For chaining methods that return values, or anything else. Runs step on the WAV unless a
+	// problem has already been recorded, in which case it's skipped. If step fails, its error is
+	// recorded (whatever the Policy) and the rest of the chain is skipped too, so the first
+	// failure is the one Err() reports, e.g.
+	//
+	//     err := wav.FadeInSamples(64).Then(func(w *WAV) error { return w.Limit(-1, 5, 50) }).Normalize(0.95).Err()
+	//
+	// This is the intended way to chain FadeRange(), the filters, the trims and the rest of the
+	// methods that return counts or errors; they have no chainable twins, since the step is where
+	// their results can be looked at:
+	//
+	//     wav.Then(func(w *WAV) error {
+	//         if clipped, err := w.EQ3(3, 0, 2, 200, 4000) ; err != nil || clipped > 0 {
+	//             return fmt.Errorf("EQ3 clipped %d samples: %v", clipped, err)
+	//         }
+	//         return nil
+	//     })
+
+	if wav.Err() != nil {
+		return wav
+	}
+
+	var err error
+
+	if step == nil {
+		err = errors.New("Then(): nil step")
+	} else {
+		err = step(wav)
+	}
+
+	if err != nil {
+		report_mutex.Lock()
+		defer report_mutex.Unlock()
+		if wav.err == nil {
+			wav.err = err
+		}
+	}
+
+	return wav
+}
+
+
 func (wav *WAV) FrameCount() uint32 {
+	if wav.FmtChunk.BlockAlign == 0 {
+		return 0
+	}
 	return wav.DataChunk.Size / uint32(wav.FmtChunk.BlockAlign)
 }
 
 
+func (wav *WAV) Validate() error {
+
+	// Checks that the fmt fields are consistent with each other and with the data. If several
+	// things are wrong, the returned error wraps all of them.
+
+	errs := make([]any, 0)
+
+	// The fmt chunk is the basic 16 bytes plus any extension, which (if present) starts with its
+	// own size. Plain PCM needs no extension, though some writers add an empty one; extensible
+	// needs at least the standard 22 bytes after the size.
+
+	ext := wav.FmtExtension
+
+	if wav.FmtChunk.Size != 16 + uint32(len(ext)) {
+		errs = append(errs, ErrFmtSize)
+	}
+
+	if len(ext) == 1 || (len(ext) >= 2 && int(binary.LittleEndian.Uint16(ext)) != len(ext) - 2) {
+		errs = append(errs, ErrFmtExtension)
+	}
+
+	switch wav.FmtChunk.AudioFormat {
+	case 1:
+		if len(ext) > 2 {
+			errs = append(errs, ErrFmtExtension)
+		}
+	case 3:
+		if wav.FmtChunk.BitsPerSample != 32 && wav.FmtChunk.BitsPerSample != 64 {
+			errs = append(errs, ErrFloatBits)
+		}
+	case 0xfffe:
+		if len(ext) < 24 {
+			errs = append(errs, ErrFmtExtension)
+		}
+	default:
+		errs = append(errs, ErrAudioFormat)
+	}
+
+	if wav.FmtChunk.NumChannels > 2 {
+		errs = append(errs, ErrNumChannels)
+	}
+
+	if wav.FmtChunk.ByteRate != wav.FmtChunk.SampleRate * uint32(wav.FmtChunk.NumChannels) * uint32(wav.FmtChunk.BitsPerSample) / 8 {
+		errs = append(errs, ErrByteRate)
+	}
+
+	if wav.FmtChunk.BlockAlign != wav.FmtChunk.NumChannels * wav.FmtChunk.BitsPerSample / 8 {
+		errs = append(errs, ErrBlockAlign)
+	}
+
+	if wav.FmtChunk.BlockAlign == 0 {
+		errs = append(errs, ErrZeroBlockAlign)
+	} else if wav.DataChunk.Size % uint32(wav.FmtChunk.BlockAlign) != 0 {
+		errs = append(errs, ErrDataAlign)
+	}
+
+	if wav.DataChunk.Size != uint32(len(wav.DataChunk.Data)) {
+		errs = append(errs, ErrDataSize)
+	}
+
+	if len(errs) > 0 {
+		format := "Validate(): " + strings.TrimSuffix(strings.Repeat("%w, ", len(errs)), ", ")
+		return fmt.Errorf(format, errs...)
+	}
+
+	return nil
+}
+
+
 func (wav *WAV) Copy() *WAV {
 
-	var new_wav WAV
+	new_wav := wav.copy_metadata()
 
-	new_wav.FmtChunk = wav.FmtChunk
-	new_wav.DataChunk.Size = wav.DataChunk.Size
+	new_wav.Policy = wav.Policy
+	new_wav.Logger = wav.Logger
 	new_wav.DataChunk.Data = make([]byte, len(wav.DataChunk.Data))
 	copy(new_wav.DataChunk.Data, wav.DataChunk.Data)
 
-	if wav.sanitycheck() != nil {
+	if wav.Validate() != nil {
 		panic("newly copied WAV was not valid")
 	}
 
@@ -73,17 +347,45 @@ func (wav *WAV) Copy() *WAV {
 
 func (original *WAV) Stretched(new_frame_count uint32) *WAV {
 
+	// Without cancellation, the only failure is a result too large for a WAV, which is reported
+	// according to the policy, giving an empty WAV.
+
+	new_wav, err := original.StretchedContext(context.Background(), new_frame_count)
+	if err != nil {
+		original.report(problem_too_large, "%v", err)
+		return original.blank_copy(0)
+	}
+	return new_wav
+}
+
+
+func (original *WAV) StretchedContext(ctx context.Context, new_frame_count uint32) (*WAV, error) {
+
 	// This uses linear interpolation to do the stretching or
 	// squashing, which sound techies don't recommend as it's lossy.
+	// If ctx is cancelled part way through, the partial result is discarded.
 
 	if new_frame_count == original.FrameCount() {
-		return original.Copy()
+		return original.Copy(), nil
+	}
+
+	if uint64(new_frame_count) * uint64(original.FmtChunk.BlockAlign) > math.MaxUint32 {
+		return nil, fmt.Errorf("StretchedContext(): %d frames would exceed the maximum WAV size", new_frame_count)
 	}
 
-	new_wav := New(new_frame_count)
+	new_wav := original.blank_copy(new_frame_count)
+
+	// A source with no frames has nothing to interpolate, so the result is just silence. A target
+	// of one frame would make the loop below wrap around, so just take the first source frame.
 
-	if new_frame_count == 0 {
-		return new_wav
+	if new_frame_count == 0 || original.FrameCount() == 0 {
+		return new_wav, nil
+	}
+
+	if new_frame_count == 1 {
+		left, right := original.Get(0)
+		new_wav.Set(0, left, right)
+		return new_wav, nil
 	}
 
 	// Set the final frame directly...
@@ -91,15 +393,34 @@ func (original *WAV) Stretched(new_frame_count uint32) *WAV {
 	left, right := original.Get(original.FrameCount() - 1)
 	new_wav.Set(new_frame_count - 1, left, right)
 
+	if original.fast_16_stereo() {
+		err := parallel_frames(new_frame_count - 1, func(start, end uint32) error {
+			return stretch_16_stereo(ctx, original.DataChunk.Data, new_wav.DataChunk.Data, start, end)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return new_wav, nil
+	}
+
 	for n := uint32(0) ; n <= new_frame_count - 2 ; n++ {
 
+		if n % context_check_frames == 0 && ctx.Err() != nil {
+			return nil, fmt.Errorf("StretchedContext(): %w", ctx.Err())
+		}
+
 		index_f := (float64(n) / float64(new_frame_count - 1)) * float64(original.FrameCount() - 1)
 		index := uint32(index_f)
 
 		interpolate_fraction := index_f - float64(index)
 
+		next_index := index + 1
+		if next_index >= original.FrameCount() {		// Only possible with a one-frame source
+			next_index = index
+		}
+
 		old_val_left,      old_val_right      := original.Get(index)
-		old_val_left_next, old_val_right_next := original.Get(index + 1)
+		old_val_left_next, old_val_right_next := original.Get(next_index)
 
 		diff_left  := old_val_left_next  - old_val_left
 		diff_right := old_val_right_next - old_val_right
@@ -113,7 +434,7 @@ func (original *WAV) Stretched(new_frame_count uint32) *WAV {
 		new_wav.Set(n, new_val_left, new_val_right)
 	}
 
-	return new_wav
+	return new_wav, nil
 }
 
 
@@ -122,12 +443,75 @@ func (wav *WAV) StretchedRelative(multiplier float64) *WAV {
 	old_framecount_f := float64(wav.FrameCount())
 	new_framecount_f := old_framecount_f * multiplier
 
+	if new_framecount_f > math.MaxUint32 {		// Converting it would be undefined; let Stretched() report it
+		new_framecount_f = math.MaxUint32
+	}
+
 	new_framecount := uint32(new_framecount_f)
 
 	return wav.Stretched(new_framecount)
 }
 
 
+func (wav *WAV) Repitched(semitones float64) *WAV {
+
+	// Tape-style repitch: raising the pitch shortens the sound and vice versa. The frame count is
+	// rounded to nearest (not truncated as in StretchedRelative) so that chains of repitches which
+	// cancel out land back on the original length.
+
+	if semitones == 0 {
+		return wav.Copy()
+	}
+
+	ratio := math.Pow(2, semitones / 12)
+	new_framecount_f := math.Round(float64(wav.FrameCount()) / ratio)
+
+	if new_framecount_f > math.MaxUint32 / float64(wav.FmtChunk.BlockAlign) {
+		new_framecount_f = math.MaxUint32 / float64(wav.FmtChunk.BlockAlign)
+	}
+
+	return wav.Stretched(uint32(new_framecount_f))
+}
+
+
+func (wav *WAV) Resampled(new_rate uint32) (*WAV, error) {
+
+	// The same audio at a different sample rate, i.e. Stretched() to the right length, with the
+	// format updated to match. The length is worked out in integers and rounded, so it's exact
+	// to the frame however long the file is.
+
+	if new_rate < MIN_SAMPLE_RATE || new_rate > MAX_SAMPLE_RATE {
+		return nil, fmt.Errorf("Resampled(): sample rate %d is outside the range %d-%d", new_rate, MIN_SAMPLE_RATE, MAX_SAMPLE_RATE)
+	}
+	if wav.FmtChunk.SampleRate == 0 {
+		return nil, fmt.Errorf("Resampled(): source sample rate was 0")
+	}
+
+	if new_rate == wav.FmtChunk.SampleRate {
+		return wav.Copy(), nil
+	}
+
+	old_rate := uint64(wav.FmtChunk.SampleRate)
+	new_frame_count := (uint64(wav.FrameCount()) * uint64(new_rate) + old_rate / 2) / old_rate
+
+	if new_frame_count * uint64(wav.FmtChunk.BlockAlign) > math.MaxUint32 {
+		return nil, fmt.Errorf("Resampled(): result would exceed the maximum WAV size")
+	}
+
+	new_wav := wav.Stretched(uint32(new_frame_count))
+
+	new_wav.FmtChunk.SampleRate = new_rate
+	new_wav.FmtChunk.ByteRate = new_rate * uint32(new_wav.FmtChunk.BlockAlign)
+
+	return new_wav, nil
+}
+
+
+func (wav *WAV) RepitchedToNote(from_midi_note, to_midi_note int) *WAV {
+	return wav.Repitched(float64(to_midi_note - from_midi_note))
+}
+
+
 func (wav *WAV) Save(filename string) error {
 
 	outfile, err := os.Create(filename)
@@ -138,31 +522,14 @@ func (wav *WAV) Save(filename string) error {
 		return fmt.Errorf("Couldn't create output file '%s'", filename)
 	}
 
-	filesize := 36 + wav.DataChunk.Size
-
-	// Conceptually one might think of strings as being big endian, but because
-	// they are comprised of byte-sized units, they have no endianness at all.
-
-	bo := binary.LittleEndian
+	_, err = wav.WriteTo(outfile)
+	if err != nil {
+		return fmt.Errorf("Couldn't write to output file '%s': %v", filename, err)
+	}
 
-	binary.Write(outfile, bo, []byte("RIFF"))
-	binary.Write(outfile, bo, &filesize)
-	binary.Write(outfile, bo, []byte("WAVE"))
-	binary.Write(outfile, bo, []byte("fmt "))
-	binary.Write(outfile, bo, &wav.FmtChunk.Size)
-	binary.Write(outfile, bo, &wav.FmtChunk.AudioFormat)
-	binary.Write(outfile, bo, &wav.FmtChunk.NumChannels)
-	binary.Write(outfile, bo, &wav.FmtChunk.SampleRate)
-	binary.Write(outfile, bo, &wav.FmtChunk.ByteRate)
-	binary.Write(outfile, bo, &wav.FmtChunk.BlockAlign)
-	binary.Write(outfile, bo, &wav.FmtChunk.BitsPerSample)
-	binary.Write(outfile, bo, []byte("data"))
-	binary.Write(outfile, bo, &wav.DataChunk.Size)
-	binary.Write(outfile, bo, wav.DataChunk.Data)
-
-	err = wav.sanitycheck()
+	err = wav.Validate()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: while saving '%s', %v\n", filename, err)
+		wav.report(problem_save_invalid, "while saving '%s', %v", filename, err)
 	}
 
 	return nil
@@ -171,176 +538,221 @@ func (wav *WAV) Save(filename string) error {
 
 func (wav *WAV) Set(frame uint32, left, right int16) {
 
-	// Assumes the wav is 16-bit stereo
+	// The frame layout comes from BlockAlign and BitsPerSample. A mono WAV stores the average of
+	// left and right; a WAV with more than 2 channels has only its first two channels touched.
 
-	if frame >= wav.DataChunk.Size / 4 {
-		if have_warned_set_out_of_bounds == false {
-			have_warned_set_out_of_bounds = true
-			fmt.Fprintf(os.Stderr, "Warning: out of bounds Set(). No further such warnings shall be given.\n")
+	wav.own_data()
+	data := wav.DataChunk.Data
+
+	if wav.fast_16_stereo() {
+
+		if frame >= uint32(len(data)) / 4 {
+			wav.report(problem_set_bounds, "out of bounds Set() at frame %d", frame)
+			return
 		}
+
+		n := frame * 4
+
+		// Reminder to self, humans and compilers think in big-endian but the storage is little-endian...
+
+		data[n + 0] = byte(left & 0xff)		// The less-significant byte
+		data[n + 1] = byte(left >> 8)		// The more-significant byte
+
+		data[n + 2] = byte(right & 0xff)	// The less-significant byte
+		data[n + 3] = byte(right >> 8)		// The more-significant byte
+
 		return
 	}
 
-	n := frame * 4
+	stride, width, ok := wav.layout()
+	if !ok {
+		wav.report(problem_format, "Set() can't write audio of format %#x with %d bits per sample", wav.FmtChunk.AudioFormat, wav.FmtChunk.BitsPerSample)
+		return
+	}
+	if frame >= uint32(len(data)) / stride {
+		wav.report(problem_set_bounds, "out of bounds Set() at frame %d", frame)
+		return
+	}
 
-	// Reminder to self, humans and compilers think in big-endian but the storage is little-endian...
+	n := frame * stride
 
-	wav.DataChunk.Data[n + 0] = byte(left & 0xff)		// The less-significant byte
-	wav.DataChunk.Data[n + 1] = byte(left >> 8)			// The more-significant byte
+	if wav.FmtChunk.NumChannels == 1 {
+		set_sample(data[n:], width, int16((int32(left) + int32(right)) / 2))
+		return
+	}
 
-	wav.DataChunk.Data[n + 2] = byte(right & 0xff)		// The less-significant byte
-	wav.DataChunk.Data[n + 3] = byte(right >> 8)		// The more-significant byte
+	set_sample(data[n:], width, left)
+	set_sample(data[n + width:], width, right)
 }
 
 
 func (wav *WAV) Get(frame uint32) (int16, int16) {
 
-	// Assumes the wav is 16-bit stereo
+	// As with Set(), the layout comes from the fmt fields. A mono WAV returns its one sample as
+	// both left and right. Samples wider than 16 bits are truncated to their top 16 bits.
+
+	data := wav.DataChunk.Data
+
+	if wav.fast_16_stereo() {
 
-	if frame >= wav.DataChunk.Size / 4 {
-		if have_warned_get_out_of_bounds == false {
-			have_warned_get_out_of_bounds = true
-			fmt.Fprintf(os.Stderr, "Warning: out of bounds Get(). No further such warnings shall be given.\n")
+		if frame >= uint32(len(data)) / 4 {
+			wav.report(problem_get_bounds, "out of bounds Get() at frame %d", frame)
+			return 0, 0
 		}
+
+		n := frame * 4
+
+		left  := int16(data[n + 0]) | (int16(data[n + 1]) << 8)
+		right := int16(data[n + 2]) | (int16(data[n + 3]) << 8)
+
+		return left, right
+	}
+
+	stride, width, ok := wav.layout()
+	if !ok {
+		wav.report(problem_format, "Get() can't read audio of format %#x with %d bits per sample", wav.FmtChunk.AudioFormat, wav.FmtChunk.BitsPerSample)
+		return 0, 0
+	}
+	if frame >= uint32(len(data)) / stride {
+		wav.report(problem_get_bounds, "out of bounds Get() at frame %d", frame)
 		return 0, 0
 	}
 
-	n := frame * 4
+	n := frame * stride
 
-	left  := int16(wav.DataChunk.Data[n + 0]) | (int16(wav.DataChunk.Data[n + 1]) << 8)
-	right := int16(wav.DataChunk.Data[n + 2]) | (int16(wav.DataChunk.Data[n + 3]) << 8)
+	if wav.FmtChunk.NumChannels == 1 {
+		val := get_sample(data[n:], width)
+		return val, val
+	}
 
-	return left, right
+	return get_sample(data[n:], width), get_sample(data[n + width:], width)
 }
 
 
-func (target *WAV) Add(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, fadeout uint32) {
-	target.Insert(t_loc, source, s_loc, frames, volume, fadeout, true)
+// Add, Replace and Insert return the number of samples (not frames) that had to be clamped,
+// so callers can tell whether their mix clipped, and e.g. retry at a lower volume.
+
+func (target *WAV) Add(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, fadeout uint32) uint32 {
+	return target.Insert(t_loc, source, s_loc, frames, volume, fadeout, true)
 }
 
 
-func (target *WAV) Replace(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, fadeout uint32) {
-	target.Insert(t_loc, source, s_loc, frames, volume, fadeout, false)
+func (target *WAV) Replace(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, fadeout uint32) uint32 {
+	return target.Insert(t_loc, source, s_loc, frames, volume, fadeout, false)
 }
 
 
-func (target *WAV) Insert(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, fadeout uint32, additive bool) {
+func (target *WAV) Insert(t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, fadeout uint32, additive bool) uint32 {
 
 	// This function adds the source wav to the target, with various options. It is highly relevant to my related
 	// Trackmaker project, and indeed perhaps includes too much logic specific to that. If things get out of hand,
 	// it should just be moved into that project, and a simplified feature-reduced version placed here.
 
-	t := t_loc
-	s := s_loc
-	frames_added := uint32(0)
-
-	var clipped bool = false
-
-	for {
-		if t >= target.FrameCount() {
-			break
-		}
-		if s >= source.FrameCount() {
-			break
-		}
-
-		target_left, target_right := int16(0), int16(0)
-		if additive {
-			target_left, target_right = target.Get(t)
-		}
+	if !target.rates_match(source, "Add") {
+		return 0
+	}
 
-		source_left, source_right := source.Get(s)
+	if target.fast_16_stereo() && source.fast_16_stereo() {
+		target.own_data()
+		return insert_16_stereo(target.DataChunk.Data, t_loc, source.DataChunk.Data, s_loc, frames, volume, fadeout, additive)
+	}
 
-		frames_to_go := frames - frames_added
-		if frames_to_go < fadeout {
-			fade_multiplier := float64(frames_to_go) / float64(fadeout)
+	return target.mix_frames(t_loc, frames, additive, func(i uint32) (int32, int32, bool) {
 
-			source_left  = int16(fade_multiplier * float64(source_left))
-			source_right = int16(fade_multiplier * float64(source_right))
+		source_left, source_right, ok := source.faded_frame(s_loc, i, frames, fadeout)
+		if !ok {
+			return 0, 0, false
 		}
 
-		var new_left_32, new_right_32 int32
-
 		if volume == 1.0 {
-			new_left_32  = int32(target_left)  + int32(source_left)
-			new_right_32 = int32(target_right) + int32(source_right)
-		} else {
-			new_left_32  = int32(target_left)  + int32(float64(source_left) * volume)
-			new_right_32 = int32(target_right) + int32(float64(source_right) * volume)
+			return int32(source_left), int32(source_right), true
 		}
 
-		if new_left_32  < -32768 { new_left_32  = -32768 ; clipped = true }
-		if new_left_32  >  32767 { new_left_32  =  32767 ; clipped = true }
-		if new_right_32 < -32768 { new_right_32 = -32768 ; clipped = true }
-		if new_right_32 >  32767 { new_right_32 =  32767 ; clipped = true }
+		return int32(float64(source_left) * volume), int32(float64(source_right) * volume), true
+	})
+}
 
-		new_left  := int16(new_left_32)
-		new_right := int16(new_right_32)
 
-		target.Set(t, new_left, new_right)
+func (wav *WAV) FadeSamples(frames_to_fade uint32) *WAV {
 
-		t++
-		s++
+	total_frames := wav.FrameCount()
 
-		frames_added++
-		if frames_added >= frames {
-			break
-		}
+	if frames_to_fade <= 0 || total_frames < 2 || wav.Err() != nil {
+		return wav
 	}
 
-	if clipped == true && have_warned_clipping == false {
-		have_warned_clipping = true
-		fmt.Fprintf(os.Stderr, "Warning: clipping occurred in Add(). No further such warnings shall be given.\n")
+	if frames_to_fade > total_frames {
+		frames_to_fade = total_frames
 	}
+
+	// The first frame of the range is left alone, i.e. the multiplier reaches 1 one frame early.
+
+	wav.FadeRange(total_frames - frames_to_fade, total_frames, 1, 0)
+	return wav
 }
 
 
-func (wav *WAV) FadeSamples(frames_to_fade uint32) {
+func (wav *WAV) FadeFraction(fraction float64) *WAV {		// e.g. an argument of 0.25 fades out the final 25%
 
-	if frames_to_fade <= 0 {
-		return
+	if fraction <= 0 {
+		return wav
+	}
+	if fraction > 1 {
+		fraction = 1
 	}
 
 	total_frames := wav.FrameCount()
+	frames_to_fade := uint32(float64(total_frames) * fraction)
 
-	if total_frames < 2 {
-		return
+	return wav.FadeSamples(frames_to_fade)
+}
+
+
+func (wav *WAV) FadeInSamples(frames_to_fade uint32) *WAV {
+
+	// Fades in over the first frames_to_fade frames, starting from silence.
+
+	if wav.Err() != nil {
+		return wav
 	}
 
+	total_frames := wav.FrameCount()
+
 	if frames_to_fade > total_frames {
 		frames_to_fade = total_frames
 	}
 
-	for n := total_frames - 1 ; n > total_frames - frames_to_fade ; n-- {	// Use > not >= because of uint wrap-around
+	wav.FadeRange(0, frames_to_fade, 0, 1)
+	return wav
+}
 
-		multiplier := float64(total_frames - n) / float64(frames_to_fade)
 
-		old_left, old_right := wav.Get(n)
+func (wav *WAV) FadeRange(start_frame, end_frame uint32, start_gain, end_gain float64) uint32 {
 
-		new_left_f  := float64(old_left)  * multiplier
-		new_right_f := float64(old_right) * multiplier
+	// Scales frames [start_frame, end_frame) by a gain moving linearly from start_gain (at
+	// start_frame) towards end_gain (which it would reach at end_frame). Parts of the range
+	// beyond the audio are ignored, without changing the slope. All the fades use this. Returns
+	// the number of samples clamped, which can only happen with gains over 1.
 
-		new_left  := int16(new_left_f)
-		new_right := int16(new_right_f)
+	last := min(end_frame, wav.FrameCount())		// Exclusive
 
-		wav.Set(n, new_left, new_right)
+	if start_frame >= last || (start_gain == 1 && end_gain == 1) {
+		return 0
 	}
-}
 
+	length := float64(end_frame - start_frame)
 
-func (wav *WAV) FadeFraction(fraction float64) {		// e.g. an argument of 0.25 fades out the final 25%
+	return wav.scale_range(start_frame, last, func(n uint32) float64 {
+		return (start_gain * float64(end_frame - n) + end_gain * float64(n - start_frame)) / length
+	})
+}
 
-	if fraction <= 0 {
-		return
-	}
-	if fraction > 1 {
-		fraction = 1
-	}
 
-	total_frames := wav.FrameCount()
-	frames_to_fade := uint32(float64(total_frames) * fraction)
+func (wav *WAV) FadeRangeSeconds(start, end float64, start_gain, end_gain float64) uint32 {
+
+	// FadeRange(), with the times rounded to the nearest frame.
 
-	wav.FadeSamples(frames_to_fade)
+	return wav.FadeRange(wav.SecondsToFrames(start), wav.SecondsToFrames(end), start_gain, end_gain)
 }
 
 
@@ -348,39 +760,481 @@ func (wav *WAV) FadeFraction(fraction float64) {		// e.g. an argument of 0.25 fa
 
 
 func Load(filename string) (*WAV, error) {
+	return load_file(context.Background(), filename, LoadOptions{})
+}
 
-	var infile *os.File
-	var err error
-	var buf [4]byte
-	var wav WAV
-	var got_fmt, got_data bool
 
-	infile, err = os.Open(filename)
-	if infile != nil {
-		defer infile.Close()
-	}
-	if err != nil {
-		return &wav, fmt.Errorf("load_wav() couldn't load '%s': %v", filename, err)
-	}
+func LoadContext(ctx context.Context, filename string) (*WAV, error) {
 
-	// --------------------
+	// Like Load(), but gives up (returning an error wrapping ctx.Err()) if ctx is cancelled.
 
-	err = binary.Read(infile, binary.LittleEndian, &buf)
-	if err != nil {
-		return &wav, fmt.Errorf("load_wav() couldn't read RIFF bytes: %v", err)
-	}
-	if buf != [4]byte{'R', 'I', 'F', 'F'} {
-		return &wav, fmt.Errorf("load_wav() found bytes 0-3 != RIFF")
-	}
+	return load_file(ctx, filename, LoadOptions{})
+}
 
-	// --------------------
 
-	var totalsize uint32
+func LoadWithOptions(filename string, opts LoadOptions) (*WAV, error) {
+	return load_file(context.Background(), filename, opts)
+}
 
-	err = binary.Read(infile, binary.LittleEndian, &totalsize)
-	if err != nil {
-		return &wav, fmt.Errorf("load_wav() couldn't read total file size: %v", err)
-	}
+
+func LoadReader(r io.Reader) (*WAV, error) {
+
+	// Like Load(), but from any reader, e.g. an HTTP body. Seekable readers are handled more
+	// efficiently, since unwanted chunks can be skipped rather than read.
+
+	return load_reader(context.Background(), r, "<reader>", LoadOptions{})
+}
+
+
+func LoadBytes(b []byte) (*WAV, error) {
+	return load_reader(context.Background(), bytes.NewReader(b), "<bytes>", LoadOptions{})
+}
+
+
+func LoadFS(fsys fs.FS, name string) (*WAV, error) {
+
+	// Like Load(), but from a file system such as an embed.FS or a zip.Reader. An error opening
+	// the file is wrapped, so errors.Is(err, fs.ErrNotExist) works.
+
+	infile, err := fsys.Open(name)
+	if err != nil {
+		return &WAV{}, fmt.Errorf("LoadFS(): %w", err)
+	}
+	defer infile.Close()
+
+	return load_reader(context.Background(), infile, name, LoadOptions{})
+}
+
+
+func SetLogger(l Logger) {
+
+	// Replaces the package logger, which by default is Discard; use Stderr to see the warnings
+	// and conversion messages. A nil argument restores the default. A single WAV can instead be
+	// given its own, via its Logger field.
+
+	if l == nil {
+		l = Discard
+	}
+
+	logger_mutex.Lock()
+	defer logger_mutex.Unlock()
+	logger = l
+}
+
+
+func New(frames uint32) *WAV {
+
+	wav, err := NewWithFormat(frames, PREFERRED_FREQ, 2)
+	if err != nil {
+		panic("failed to create a valid WAV")
+	}
+
+	return wav
+}
+
+
+func NewWithFormat(frames uint32, sample_rate uint32, channels uint16) (*WAV, error) {
+
+	// Creates a silent 16-bit WAV with the given rate and channel count.
+
+	var wav WAV
+
+	if sample_rate == 0 {
+		return nil, fmt.Errorf("NewWithFormat(): sample rate was 0")
+	}
+	if channels == 0 || channels > 2 {
+		return nil, fmt.Errorf("NewWithFormat(): channel count %d was not 1 or 2", channels)
+	}
+
+	wav.FmtChunk.Size = 16
+	wav.FmtChunk.AudioFormat = 1
+	wav.FmtChunk.NumChannels = channels
+	wav.FmtChunk.SampleRate = sample_rate
+	wav.FmtChunk.BitsPerSample = 16
+	wav.FmtChunk.BlockAlign = channels * 2
+	wav.FmtChunk.ByteRate = sample_rate * uint32(wav.FmtChunk.BlockAlign)		// Bytes per second
+
+	if uint64(frames) * uint64(wav.FmtChunk.BlockAlign) > math.MaxUint32 {
+		return nil, fmt.Errorf("NewWithFormat(): %d frames is too many", frames)
+	}
+
+	wav.DataChunk.Size = frames * uint32(wav.FmtChunk.BlockAlign)
+	wav.DataChunk.Data = make([]byte, wav.DataChunk.Size)
+
+	err := wav.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("NewWithFormat(): %w", err)
+	}
+
+	return &wav, nil
+}
+
+
+// ------------------------------------- NON-EXPOSED FUNCTIONS
+
+
+func stretch_16_stereo(ctx context.Context, src []byte, dst []byte, start uint32, end uint32) error {
+
+	// The inner loop of Stretched() for the common case, working on the bytes directly. This must
+	// give exactly the same output as the general loop, including its int16 arithmetic. It fills
+	// destination frames [start, end), which must not include the final frame; the caller sets
+	// that. Both buffers hold at least 2 frames.
+
+	src_frames := uint32(len(src) / 4)
+	dst_frames := uint32(len(dst) / 4)
+
+	src = src[:src_frames * 4]		// Hints to the compiler about lengths, hoisting bounds checks
+	dst = dst[:dst_frames * 4]
+
+	src_last := float64(src_frames - 1)
+	dst_last := float64(dst_frames - 1)
+
+	for n := start ; n < end ; n++ {
+
+		if (n - start) % context_check_frames == 0 && ctx.Err() != nil {
+			return fmt.Errorf("StretchedContext(): %w", ctx.Err())
+		}
+
+		index_f := (float64(n) / dst_last) * src_last
+		index := uint32(index_f)
+
+		interpolate_fraction := index_f - float64(index)
+
+		i := index * 4
+		j := i + 4
+		if index + 1 >= src_frames {
+			j = i
+		}
+
+		old_val_left       := int16(src[i + 0]) | (int16(src[i + 1]) << 8)
+		old_val_right      := int16(src[i + 2]) | (int16(src[i + 3]) << 8)
+		old_val_left_next  := int16(src[j + 0]) | (int16(src[j + 1]) << 8)
+		old_val_right_next := int16(src[j + 2]) | (int16(src[j + 3]) << 8)
+
+		diff_left  := old_val_left_next  - old_val_left
+		diff_right := old_val_right_next - old_val_right
+
+		new_val_left  := int16(float64(old_val_left)  + float64(diff_left)  * interpolate_fraction)
+		new_val_right := int16(float64(old_val_right) + float64(diff_right) * interpolate_fraction)
+
+		k := n * 4
+
+		dst[k + 0] = byte(new_val_left & 0xff)
+		dst[k + 1] = byte(new_val_left >> 8)
+		dst[k + 2] = byte(new_val_right & 0xff)
+		dst[k + 3] = byte(new_val_right >> 8)
+	}
+
+	return nil
+}
+
+
+func insert_16_stereo(dst []byte, t_loc uint32, src []byte, s_loc uint32, frames uint32, volume float64, fadeout uint32, additive bool) uint32 {
+
+	// The fast path of Insert(), walking the byte buffers directly. It must behave exactly like the general
+	// loop, including its quirk of always writing at least one frame even when frames is 0.
+
+	dst_frames := uint32(len(dst) / 4)
+	src_frames := uint32(len(src) / 4)
+
+	if t_loc >= dst_frames || s_loc >= src_frames {
+		return 0
+	}
+
+	count := frames
+	if count == 0 {
+		count = 1
+	}
+	if count > dst_frames - t_loc {
+		count = dst_frames - t_loc
+	}
+	if count > src_frames - s_loc {
+		count = src_frames - s_loc
+	}
+
+	// Frames before plain_end get no fade. The fade applies once frames - i < fadeout.
+
+	plain_end := uint32(0)
+	if frames >= fadeout {
+		plain_end = frames - fadeout + 1
+	}
+	if plain_end > count {
+		plain_end = count
+	}
+
+	dst = dst[t_loc * 4 : (t_loc + count) * 4]
+	src = src[s_loc * 4 : (s_loc + count) * 4]
+
+	plain_dst := dst[:plain_end * 4]
+	plain_src := src[:plain_end * 4]
+
+	clipped := uint32(0)
+
+	// The loops below work a sample (2 bytes) at a time, since both channels are treated alike.
+	// The 3-index slices let the compiler drop most of the bounds checks.
+
+	if volume == 1.0 && additive {
+
+		for k := 0 ; k + 1 < len(plain_dst) ; k += 2 {
+			d := plain_dst[k : k + 2 : k + 2]
+			val := int32(int16(binary.LittleEndian.Uint16(d))) + int32(int16(binary.LittleEndian.Uint16(plain_src[k : k + 2 : k + 2])))
+			if val < -32768 { val = -32768 ; clipped++ } else if val > 32767 { val = 32767 ; clipped++ }
+			binary.LittleEndian.PutUint16(d, uint16(val))
+		}
+
+	} else if volume == 1.0 {
+
+		copy(plain_dst, plain_src)		// Replacing at full volume can't clip
+
+	} else if additive {
+
+		for k := 0 ; k + 1 < len(plain_dst) ; k += 2 {
+			d := plain_dst[k : k + 2 : k + 2]
+			val := int32(int16(binary.LittleEndian.Uint16(d))) + int32(float64(int16(binary.LittleEndian.Uint16(plain_src[k : k + 2 : k + 2]))) * volume)
+			if val < -32768 { val = -32768 ; clipped++ } else if val > 32767 { val = 32767 ; clipped++ }
+			binary.LittleEndian.PutUint16(d, uint16(val))
+		}
+
+	} else {
+
+		for k := 0 ; k + 1 < len(plain_dst) ; k += 2 {
+			val := int32(float64(int16(binary.LittleEndian.Uint16(plain_src[k : k + 2 : k + 2]))) * volume)
+			if val < -32768 { val = -32768 ; clipped++ } else if val > 32767 { val = 32767 ; clipped++ }
+			binary.LittleEndian.PutUint16(plain_dst[k : k + 2 : k + 2], uint16(val))
+		}
+	}
+
+	// The fadeout section, which is usually short, so no great effort is made here...
+
+	for i := plain_end ; i < count ; i++ {
+
+		fade_multiplier := float64(frames - i) / float64(fadeout)
+
+		for k := i * 4 ; k < i * 4 + 4 ; k += 2 {
+			src_val := int16(fade_multiplier * float64(int16(binary.LittleEndian.Uint16(src[k:]))))
+			val := int32(0)
+			if additive {
+				val = int32(int16(binary.LittleEndian.Uint16(dst[k:])))
+			}
+			if volume == 1.0 {
+				val += int32(src_val)
+			} else {
+				val += int32(float64(src_val) * volume)
+			}
+			if val < -32768 { val = -32768 ; clipped++ } else if val > 32767 { val = 32767 ; clipped++ }
+			binary.LittleEndian.PutUint16(dst[k:], uint16(val))
+		}
+	}
+
+	return clipped
+}
+
+
+func expand_to_16_stereo(src []byte, dst []byte, frames uint32, bits uint16, channels uint16) {
+
+	// Writes frames of 16-bit stereo into dst, from 8 or 16-bit mono or stereo in src.
+
+	width := uint32(bits / 8)
+	stride := width * uint32(channels)
+
+	for n := uint32(0) ; n < frames ; n++ {
+
+		left := get_sample(src[n * stride:], width)
+		right := left
+		if channels == 2 {
+			right = get_sample(src[n * stride + width:], width)
+		}
+
+		// Reminder to self, humans and compilers think in big-endian but the storage is little-endian...
+
+		dst[n * 4 + 0] = byte(left & 0xff)			// The less-significant bytes
+		dst[n * 4 + 1] = byte(left >> 8)			// The more-significant bytes
+		dst[n * 4 + 2] = byte(right & 0xff)
+		dst[n * 4 + 3] = byte(right >> 8)
+	}
+}
+
+
+func resample_in_place(ctx context.Context, buf []byte, old_frames uint32, new_frames uint32) error {
+
+	// Does exactly what Stretched() does to 16-bit stereo, but within buf, which must be big enough
+	// for both the old and new frame counts. This works because when squashing, output frame n only
+	// depends on input frames >= n, so we can go forwards; and when stretching, output frame n only
+	// depends on input frames <= n, so we can go backwards. (Strictly, output frame 0 also reads
+	// input frame 1, but with an interpolation fraction of exactly 0, so it doesn't matter.)
+
+	if new_frames == old_frames || new_frames == 0 {
+		return nil
+	}
+
+	if old_frames == 0 {
+		clear(buf[:new_frames * 4])
+		return nil
+	}
+
+	if new_frames == 1 {
+		return nil			// Frame 0 is already the first source frame
+	}
+
+	get := func(n uint32) (int16, int16) {
+		return int16(buf[n * 4 + 0]) | (int16(buf[n * 4 + 1]) << 8), int16(buf[n * 4 + 2]) | (int16(buf[n * 4 + 3]) << 8)
+	}
+
+	set := func(n uint32, left, right int16) {
+		buf[n * 4 + 0] = byte(left & 0xff)
+		buf[n * 4 + 1] = byte(left >> 8)
+		buf[n * 4 + 2] = byte(right & 0xff)
+		buf[n * 4 + 3] = byte(right >> 8)
+	}
+
+	src_last := float64(old_frames - 1)
+	dst_last := float64(new_frames - 1)
+
+	interpolate := func(n uint32) (int16, int16) {
+
+		index_f := (float64(n) / dst_last) * src_last
+		index := uint32(index_f)
+
+		interpolate_fraction := index_f - float64(index)
+
+		next_index := index + 1
+		if next_index >= old_frames {
+			next_index = index
+		}
+
+		old_val_left,      old_val_right      := get(index)
+		old_val_left_next, old_val_right_next := get(next_index)
+
+		diff_left  := old_val_left_next  - old_val_left
+		diff_right := old_val_right_next - old_val_right
+
+		return int16(float64(old_val_left) + float64(diff_left) * interpolate_fraction), int16(float64(old_val_right) + float64(diff_right) * interpolate_fraction)
+	}
+
+	last_left, last_right := get(old_frames - 1)
+
+	if new_frames < old_frames {
+		for n := uint32(0) ; n <= new_frames - 2 ; n++ {
+			if n % context_check_frames == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			left, right := interpolate(n)
+			set(n, left, right)
+		}
+		set(new_frames - 1, last_left, last_right)
+	} else {
+		set(new_frames - 1, last_left, last_right)
+		for n := new_frames - 2 ; ; n-- {
+			if n % context_check_frames == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			left, right := interpolate(n)
+			set(n, left, right)
+			if n == 0 {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+
+func get_sample(b []byte, width uint32) int16 {
+
+	// 8-bit WAVs are unsigned; the mapping used here matches the one convert() uses.
+	// Anything 16-bit or wider is signed, and we just take the most-significant 2 bytes.
+
+	if width == 1 {
+		val := int32(b[0])
+		return int16(((val - 128) * 256) + val)
+	}
+
+	return int16(b[width - 2]) | (int16(b[width - 1]) << 8)
+}
+
+
+func set_sample(b []byte, width uint32, val int16) {
+
+	if width == 1 {
+		b[0] = byte((val >> 8) + 128)
+		return
+	}
+
+	for n := uint32(0) ; n < width - 2 ; n++ {
+		b[n] = 0
+	}
+
+	b[width - 2] = byte(val & 0xff)		// The less-significant byte
+	b[width - 1] = byte(val >> 8)		// The more-significant byte
+}
+
+
+func get_logger() Logger {
+	logger_mutex.Lock()
+	defer logger_mutex.Unlock()
+	return logger
+}
+
+
+func load_file(ctx context.Context, filename string, opts LoadOptions) (*WAV, error) {
+
+	infile, err := os.Open(filename)
+	if infile != nil {
+		defer infile.Close()
+	}
+	if err != nil {
+		return &WAV{}, fmt.Errorf("load_wav() couldn't load '%s': %v", filename, err)
+	}
+
+	return load_reader(ctx, infile, filename, opts)
+}
+
+
+func load_reader(ctx context.Context, infile io.Reader, filename string, opts LoadOptions) (*WAV, error) {		// Filename just for messages
+
+	var err error
+	var buf [4]byte
+	var wav WAV
+	var got_fmt, got_data bool
+
+	// --------------------
+
+	err = binary.Read(infile, binary.LittleEndian, &buf)
+	if err != nil {
+		return &wav, fmt.Errorf("load_wav() couldn't read RIFF bytes: %v", err)
+	}
+	if buf != [4]byte{'R', 'I', 'F', 'F'} {
+		return &wav, fmt.Errorf("load_wav() found bytes 0-3 != RIFF")
+	}
+
+	// --------------------
+
+	var totalsize uint32
+
+	err = binary.Read(infile, binary.LittleEndian, &totalsize)
+	if err != nil {
+		return &wav, fmt.Errorf("load_wav() couldn't read total file size: %v", err)
+	}
+
+	log := opts.Logger
+	if log == nil {
+		log = get_logger()
+	}
+
+	warn := func(format string, args ...any) {		// For problems we can work around
+		e := fmt.Errorf(format, args...)
+		wav.Warnings = append(wav.Warnings, e)
+		log("Warning: %v", e)
+	}
+
+	// The RIFF size is often wrong (e.g. from writers that couldn't seek back to fill it in), and
+	// nothing below relies on it; the chunks are read until the input actually ends.
+
+	remaining, known := remaining_bytes(infile)
+	if known && int64(totalsize) != remaining {
+		warn("RIFF size in '%s' says %d bytes follow but %d do", filename, totalsize, remaining)
+	}
 
 	// --------------------
 
@@ -394,45 +1248,105 @@ func Load(filename string) (*WAV, error) {
 
 	// --------------------
 
+	// Read chunks until EOF. Once we have fmt and data, problems with any later chunks
+	// (which are only ever metadata) are logged but not treated as fatal.
+
 	for {
 
-		err = binary.Read(infile, binary.LittleEndian, &buf)
+		if ctx.Err() != nil {
+			return &wav, fmt.Errorf("load_wav(): %w", ctx.Err())
+		}
+
+		var got int
+		got, err = io.ReadFull(infile, buf[:])
 		if err != nil {
+			if got_fmt && got_data {
+				if err == io.ErrUnexpectedEOF {
+					warn("ignoring %d trailing bytes at the end of '%s'", got, filename)
+				} else if err != io.EOF {
+					warn("stopped reading '%s' after the data: %v", filename, err)
+				}
+				break
+			}
+			if err == io.EOF {
+				return &wav, fmt.Errorf("load_wav() reached end of '%s' without finding both fmt and data chunks", filename)
+			}
 			return &wav, fmt.Errorf("load_wav() couldn't read chunk's starting bytes: %v", err)
 		}
 
-		if buf == [4]byte{'f', 'm', 't', ' '} {
-			wav.FmtChunk, err = load_fmt(infile)
+		if buf == [4]byte{'f', 'm', 't', ' '} && got_fmt == false {
+			wav.FmtChunk, wav.FmtExtension, err = load_fmt(infile)
 			if err != nil {
 				return &wav, err
 			}
 			got_fmt = true
-		} else if buf == [4]byte{'d', 'a', 't', 'a'} {
-			wav.DataChunk, err = load_data(infile)
+		} else if buf == [4]byte{'d', 'a', 't', 'a'} && got_data == false {
+			var truncated bool
+			wav.DataChunk, truncated, err = load_data(infile, opts)
 			if err != nil {
 				return &wav, err
 			}
 			got_data = true
+			if truncated {
+				if got_fmt == false {
+					return &wav, fmt.Errorf("load_wav(): data chunk was truncated before any fmt chunk was seen")
+				}
+				break			// Nothing can follow a truncated chunk
+			}
+		} else if is_metadata_chunk(buf) || (opts.DropExtraChunks == false && buf != [4]byte{'f', 'm', 't', ' '} && buf != [4]byte{'d', 'a', 't', 'a'}) {
+			var chunk RawChunk
+			chunk, err = load_raw_chunk(infile, buf, opts)
+			if err != nil {
+				if got_fmt && got_data {
+					warn("ignoring bad trailing chunk in '%s': %v", filename, err)
+					break
+				}
+				return &wav, err
+			}
+			if wav.interpret_chunk(chunk) == false && opts.DropExtraChunks == false {
+				wav.ExtraChunks = append(wav.ExtraChunks, chunk)
+			}
 		} else {
 			err = skip_chunk(infile, buf)
 			if err != nil {
+				if got_fmt && got_data {
+					warn("ignoring bad trailing chunk in '%s': %v", filename, err)
+					break
+				}
 				return &wav, err
 			}
 		}
-
-		if got_fmt && got_data {
-			break
-		}
 	}
 
 	// --------------------
 
-	err = wav.sanitycheck()
+	if opts.Lenient && wav.FmtChunk.BlockAlign > 0 {
+		wav.DataChunk.Size -= wav.DataChunk.Size % uint32(wav.FmtChunk.BlockAlign)		// Drop any partial frame
+		wav.DataChunk.Data = wav.DataChunk.Data[:wav.DataChunk.Size]
+	}
+
+	err = wav.Validate()
 	if err != nil {
 		return &wav, err
 	}
 
-	err = wav.convert(filename)
+	if ctx.Err() != nil {
+		return &wav, fmt.Errorf("load_wav(): %w", ctx.Err())
+	}
+
+	if opts.KeepFormat {
+		return &wav, nil
+	}
+
+	rate := opts.SampleRate
+	if rate == 0 {
+		rate = PREFERRED_FREQ
+	}
+	if rate < MIN_SAMPLE_RATE || rate > MAX_SAMPLE_RATE {
+		return &wav, fmt.Errorf("load_wav(): requested sample rate %d is outside the range %d-%d", rate, MIN_SAMPLE_RATE, MAX_SAMPLE_RATE)
+	}
+
+	err = wav.convert(ctx, filename, rate, log)
 	if err != nil {
 		return &wav, err
 	}
@@ -441,211 +1355,662 @@ func Load(filename string) (*WAV, error) {
 }
 
 
-func New(frames uint32) *WAV {
+func skip_chunk(infile io.Reader, chunk_name [4]byte) error {
 
-	var wav WAV
+	var chunk_size uint32
+	var err error
 
-	wav.FmtChunk.Size = 16
-	wav.FmtChunk.AudioFormat = 1
-	wav.FmtChunk.NumChannels = 2
-	wav.FmtChunk.SampleRate = PREFERRED_FREQ
-	wav.FmtChunk.ByteRate = PREFERRED_FREQ * 4		// Bytes per second; we are using 4 bytes per frame
-	wav.FmtChunk.BlockAlign = 4
-	wav.FmtChunk.BitsPerSample = 16
+	err = binary.Read(infile, binary.LittleEndian, &chunk_size)
+	if err != nil {
+		return fmt.Errorf("skip_chunk() couldn't read '%s' chunk size: %v", chunk_name, err)
+	}
 
-	wav.DataChunk.Size = uint32(wav.FmtChunk.BitsPerSample / 8) * frames * uint32(wav.FmtChunk.NumChannels)
-	wav.DataChunk.Data = make([]byte, wav.DataChunk.Size)
+	remaining, known := remaining_bytes(infile)
+	if known && int64(chunk_size) > remaining {
+		return fmt.Errorf("skip_chunk(): '%s' chunk claims %d bytes but only %d remain", chunk_name, chunk_size, remaining)
+	}
 
-	if wav.sanitycheck() != nil {
-		panic("failed to create a valid WAV")
+	if seeker, ok := infile.(io.Seeker); ok {
+		_, err = seeker.Seek(int64(chunk_size), io.SeekCurrent)
+	} else {
+		_, err = io.CopyN(io.Discard, infile, int64(chunk_size))
+	}
+	if err != nil {
+		return fmt.Errorf("skip_chunk() couldn't read '%s' chunk contents: %v", chunk_name, err)
+	}
+
+	err = skip_pad(infile, chunk_size)
+	if err != nil {
+		return fmt.Errorf("skip_chunk() couldn't read '%s' pad byte: %v", chunk_name, err)
 	}
 
-	return &wav
+	return nil
 }
 
 
-// ------------------------------------- NON-EXPOSED FUNCTIONS
+func skip_pad(infile io.Reader, chunk_size uint32) error {
+
+	var buf byte
+
+	if chunk_size % 2 == 0 {
+		return nil
+	}
+
+	err := binary.Read(infile, binary.LittleEndian, &buf)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
 
+func remaining_bytes(infile io.Reader) (int64, bool) {
 
-func skip_chunk(infile *os.File, chunk_name [4]byte) error {
+	// If the input is seekable, returns how many bytes are left in it. The bool is false if we can't tell.
+
+	seeker, ok := infile.(io.Seeker)
+	if !ok {
+		return 0, false
+	}
+
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false
+	}
+	_, err = seeker.Seek(current, io.SeekStart)
+	if err != nil {
+		return 0, false
+	}
+
+	return end - current, true
+}
+
+
+func is_metadata_chunk(id [4]byte) bool {
+
+	// True for the chunks that have fields of their own on the WAV.
+
+	return is_id3_chunk(id) || id == [4]byte{'i', 'X', 'M', 'L'} || id == [4]byte{'a', 'c', 'i', 'd'} || id == [4]byte{'i', 'n', 's', 't'}
+}
+
+
+func is_id3_chunk(id [4]byte) bool {
+	return id == [4]byte{'i', 'd', '3', ' '} || id == [4]byte{'I', 'D', '3', ' '}
+}
+
+
+func load_raw_chunk(infile io.Reader, chunk_name [4]byte, opts LoadOptions) (RawChunk, error) {
+
+	// Reads a whole chunk whose contents we don't interpret, with the same caution about the
+	// declared size as load_data().
 
 	var chunk_size uint32
 	var err error
-	var buf byte
+
+	chunk := RawChunk{ID: chunk_name}
 
 	err = binary.Read(infile, binary.LittleEndian, &chunk_size)
 	if err != nil {
-		return fmt.Errorf("skip_chunk() couldn't read '%s' chunk size: %v", chunk_name, err)
+		return chunk, fmt.Errorf("load_raw_chunk() couldn't read '%s' chunk size: %v", chunk_name, err)
 	}
 
-	for n := uint32(0) ; n < chunk_size ; n++ {
-		err = binary.Read(infile, binary.LittleEndian, &buf)
-		if err != nil {
-			return fmt.Errorf("skip_chunk() couldn't read '%s' chunk contents: %v", chunk_name, err)
-		}
+	max_bytes := opts.MaxDataBytes
+	if max_bytes == 0 {
+		max_bytes = DEFAULT_MAX_DATA_BYTES
 	}
 
-	return nil
+	remaining, known := remaining_bytes(infile)
+	if known && int64(chunk_size) > remaining {
+		return chunk, fmt.Errorf("load_raw_chunk(): '%s' chunk claims %d bytes but only %d remain", chunk_name, chunk_size, remaining)
+	}
+	if chunk_size > max_bytes {
+		return chunk, fmt.Errorf("load_raw_chunk(): '%s' chunk size %d exceeds the maximum of %d bytes", chunk_name, chunk_size, max_bytes)
+	}
+
+	chunk.Data, err = read_declared(infile, chunk_size, known)
+	if err != nil {
+		return chunk, fmt.Errorf("load_raw_chunk() couldn't read '%s' chunk contents: %v", chunk_name, err)
+	}
+
+	err = skip_pad(infile, chunk_size)
+	if err != nil {
+		return chunk, fmt.Errorf("load_raw_chunk() couldn't read '%s' pad byte: %v", chunk_name, err)
+	}
+
+	return chunk, nil
+}
+
+
+func read_declared(infile io.Reader, size uint32, known bool) ([]byte, error) {
+
+	// Reads size bytes, with the same results as io.ReadFull. If the input's length is unknown, a
+	// size taken from the file can't be trusted with an allocation up front (a tiny malicious
+	// stream could claim a gigabyte), so the buffer grows only as the data actually arrives.
+
+	if known {
+		b := make([]byte, size)
+		n, err := io.ReadFull(infile, b)
+		return b[:n], err
+	}
+
+	var buf bytes.Buffer
+
+	n, err := io.CopyN(&buf, infile, int64(size))
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return buf.Bytes(), err
 }
 
 
-func load_fmt(infile *os.File) (FmtChunk_Struct, error) {
+func load_fmt(infile io.Reader) (FmtChunk_Struct, []byte, error) {
+
+	// Returns the basic fields and the extension, if any, leaving infile at the next chunk.
 
 	var chunk FmtChunk_Struct
 	var err error
 
 	err = binary.Read(infile, binary.LittleEndian, &chunk)
 	if err != nil {
-		return chunk, fmt.Errorf("load_fmt() couldn't read fmt chunk: %v", err)
+		return chunk, nil, fmt.Errorf("load_fmt() couldn't read fmt chunk: %v", err)
 	}
 
-	return chunk, nil
+	if chunk.Size < 16 {
+		return chunk, nil, fmt.Errorf("load_fmt(): fmt chunk size %d is too small", chunk.Size)
+	}
+	if chunk.Size == 16 {
+		return chunk, nil, nil
+	}
+
+	// An extension's own size field is 16 bits, so anything much bigger is nonsense.
+
+	if chunk.Size - 16 > 2 + math.MaxUint16 {
+		return chunk, nil, fmt.Errorf("load_fmt(): fmt chunk size %d is too large", chunk.Size)
+	}
+
+	ext := make([]byte, chunk.Size - 16)
+
+	_, err = io.ReadFull(infile, ext)
+	if err != nil {
+		return chunk, nil, fmt.Errorf("load_fmt() couldn't read fmt extension: %v", err)
+	}
+
+	err = skip_pad(infile, chunk.Size)
+	if err != nil {
+		return chunk, nil, fmt.Errorf("load_fmt() couldn't read pad byte: %v", err)
+	}
+
+	return chunk, ext, nil
 }
 
 
-func load_data(infile *os.File) (DataChunk_Struct, error) {
+func load_data(infile io.Reader, opts LoadOptions) (DataChunk_Struct, bool, error) {
+
+	// If opts.Lenient, a data chunk cut short by EOF is returned with whatever was actually
+	// present, and the bool return value is set to indicate this.
 
 	var chunk DataChunk_Struct
 	var err error
 
-	binary.Read(infile, binary.LittleEndian, &chunk.Size)
-	err = binary.Read(infile, binary.LittleEndian, chunk.Data)
+	err = binary.Read(infile, binary.LittleEndian, &chunk.Size)
 	if err != nil {
-		return chunk, fmt.Errorf("load_data() couldn't read chunk size: %v", err)
+		return chunk, false, fmt.Errorf("load_data() couldn't read chunk size: %v", err)
 	}
 
-	chunk.Data = make([]byte, chunk.Size)
+	// Don't trust the declared size with an allocation until it has been checked...
 
-	err = binary.Read(infile, binary.LittleEndian, chunk.Data)
+	max_bytes := opts.MaxDataBytes
+	if max_bytes == 0 {
+		max_bytes = DEFAULT_MAX_DATA_BYTES
+	}
+
+	alloc_size := chunk.Size
+
+	remaining, known := remaining_bytes(infile)
+	if known && int64(chunk.Size) > remaining {
+		if opts.Lenient == false {
+			return chunk, false, fmt.Errorf("load_data(): data chunk claims %d bytes but only %d remain", chunk.Size, remaining)
+		}
+		alloc_size = uint32(remaining)
+	}
+
+	if alloc_size > max_bytes {
+		return chunk, false, fmt.Errorf("load_data(): data chunk size %d exceeds the maximum of %d bytes", alloc_size, max_bytes)
+	}
+
+	chunk.Data, err = read_declared(infile, alloc_size, known)
+	n := len(chunk.Data)
+
+	if n < int(chunk.Size) && (err == nil || err == io.ErrUnexpectedEOF || err == io.EOF) && opts.Lenient {
+		chunk.Size = uint32(n)
+		chunk.Data = chunk.Data[:n]
+		return chunk, true, nil
+	}
 	if err != nil {
-		return chunk, fmt.Errorf("load_data() couldn't read data: %v", err)
+		return chunk, false, fmt.Errorf("load_data() couldn't read data: %v", err)
 	}
 
-	return chunk, nil
+	// Skip the pad byte after an odd-sized chunk. Some writers omit it when the data chunk
+	// is the last thing in the file, so hitting EOF here is fine.
+
+	err = skip_pad(infile, chunk.Size)
+	if err != nil {
+		return chunk, false, fmt.Errorf("load_data() couldn't read pad byte: %v", err)
+	}
+
+	return chunk, false, nil
 }
 
 
 // ------------------------------------- NON-EXPOSED METHODS
 
 
-func (wav *WAV) convert(filename string) error {		// Filename given just for printing useful info
+func (wav *WAV) header() []byte {
 
-	// Remember, this is an in-place conversion, we can't just set *wav ptr to be something else.
-	// Rather, the struct that *wav points to itself needs to be modified.
+	// Returns everything that goes in the file before the audio data itself.
 
-	// We want 16-bit audio:
+	var buf bytes.Buffer
 
-	if wav.FmtChunk.BitsPerSample != 16 {
+	// RIFF chunks must start on even boundaries, so an odd-sized data chunk is followed by a pad
+	// byte. This counts towards the RIFF size, but not towards the data chunk's own size.
 
-		if wav.FmtChunk.BitsPerSample != 8 {
-			return fmt.Errorf("convert_wav(): bits per sample in '%s' was not 8 or 16", filename)
-		}
+	pad := wav.DataChunk.Size % 2
+	fmt_pad := uint32(len(wav.FmtExtension) % 2)
 
-		fmt.Fprintf(os.Stderr, "Converting '%s' to 16 bit...\n", filename)
+	filesize := 36 + uint32(len(wav.FmtExtension)) + fmt_pad + wav.DataChunk.Size + pad + wav.extra_chunks_size()
+
+	// Conceptually one might think of strings as being big endian, but because
+	// they are comprised of byte-sized units, they have no endianness at all.
 
-		new_data := make([]byte, wav.DataChunk.Size * 2)
+	bo := binary.LittleEndian
 
-		for n := uint32(0) ; n < wav.DataChunk.Size ; n++ {
+	binary.Write(&buf, bo, []byte("RIFF"))
+	binary.Write(&buf, bo, &filesize)
+	binary.Write(&buf, bo, []byte("WAVE"))
+	binary.Write(&buf, bo, []byte("fmt "))
+	binary.Write(&buf, bo, &wav.FmtChunk.Size)
+	binary.Write(&buf, bo, &wav.FmtChunk.AudioFormat)
+	binary.Write(&buf, bo, &wav.FmtChunk.NumChannels)
+	binary.Write(&buf, bo, &wav.FmtChunk.SampleRate)
+	binary.Write(&buf, bo, &wav.FmtChunk.ByteRate)
+	binary.Write(&buf, bo, &wav.FmtChunk.BlockAlign)
+	binary.Write(&buf, bo, &wav.FmtChunk.BitsPerSample)
+	buf.Write(wav.FmtExtension)
+	if fmt_pad == 1 {
+		buf.WriteByte(0)
+	}
+	binary.Write(&buf, bo, []byte("data"))
+	binary.Write(&buf, bo, &wav.DataChunk.Size)
 
-			old_val := int32(wav.DataChunk.Data[n])
+	return buf.Bytes()
+}
 
-			new_val := ((old_val - 128) * 256) + old_val
 
-			// Reminder to self, humans and compilers think in big-endian but the storage is little-endian...
+func (wav *WAV) trailer() []byte {
 
-			new_data[n * 2] = byte(new_val & 0xff)			// The less-significant bytes
-			new_data[n * 2 + 1] = byte(new_val >> 8)		// The more-significant bytes
+	// Returns everything that goes in the file after the audio data: the data chunk's pad byte,
+	// if needed, then any extra chunks.
+
+	var buf bytes.Buffer
+
+	if wav.DataChunk.Size % 2 == 1 {
+		buf.WriteByte(0)
+	}
+
+	for _, chunk := range wav.trailing_chunks() {
+		buf.Write(chunk.ID[:])
+		binary.Write(&buf, binary.LittleEndian, uint32(len(chunk.Data)))
+		buf.Write(chunk.Data)
+		if len(chunk.Data) % 2 == 1 {
+			buf.WriteByte(0)
 		}
+	}
 
-		wav.FmtChunk.BitsPerSample = 16
+	return buf.Bytes()
+}
 
-		wav.FmtChunk.ByteRate *= 2
-		wav.FmtChunk.BlockAlign *= 2
 
-		wav.DataChunk.Data = new_data
-		wav.DataChunk.Size *= 2
+func (wav *WAV) trailing_chunks() []RawChunk {
+
+	// The chunks written after the data: ExtraChunks, then the metadata chunks made from fields.
+	// Any copy of the latter in ExtraChunks (e.g. one the loader couldn't parse) is left out, so
+	// it isn't written twice.
+
+	var generated []RawChunk
+
+	if !wav.ID3.IsEmpty() {
+		generated = append(generated, RawChunk{[4]byte{'i', 'd', '3', ' '}, wav.ID3.encode()})
+	}
+	if wav.IXML != "" {
+		generated = append(generated, RawChunk{[4]byte{'i', 'X', 'M', 'L'}, []byte(wav.IXML)})
+	}
+	if wav.ACID != nil {
+		generated = append(generated, RawChunk{[4]byte{'a', 'c', 'i', 'd'}, wav.ACID.encode()})
+	}
+	if wav.instrument != nil {
+		generated = append(generated, RawChunk{[4]byte{'i', 'n', 's', 't'}, wav.instrument.encode()})
 	}
 
-	// We want stereo:
+	var chunks []RawChunk
+
+	for _, chunk := range wav.ExtraChunks {
+		duplicate := false
+		for _, g := range generated {
+			if chunk.ID == g.ID || (is_id3_chunk(chunk.ID) && is_id3_chunk(g.ID)) {
+				duplicate = true
+			}
+		}
+		if !duplicate {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	return append(chunks, generated...)
+}
 
-	if wav.FmtChunk.NumChannels == 1 {
 
-		fmt.Fprintf(os.Stderr, "Converting '%s' to stereo...\n", filename)
+func (wav *WAV) interpret_chunk(chunk RawChunk) bool {
 
-		new_data := make([]byte, wav.DataChunk.Size * 2)
+	// Called by the loader for chunks other than fmt and data. Fills in the relevant field and
+	// returns true if the chunk is one we understand. One that's malformed is noted in Warnings
+	// and left for ExtraChunks, so it's still preserved as it was.
 
-		for n := uint32(0) ; n < wav.DataChunk.Size ; n += 2 {
+	switch {
+
+	case is_id3_chunk(chunk.ID):
+		tags, err := parse_id3(chunk.Data)
+		if err != nil {
+			wav.Warnings = append(wav.Warnings, fmt.Errorf("load_wav(): skipping ID3 tag: %w", err))
+			return false
+		}
+		wav.ID3 = tags
+		return true
 
-			// Things are guaranteed 16-bit at this point, so the following is right...
+	case chunk.ID == [4]byte{'i', 'X', 'M', 'L'}:
+		wav.IXML = string(chunk.Data)
+		return true
 
-			new_data[n * 2] = wav.DataChunk.Data[n]
-			new_data[n * 2 + 2] = wav.DataChunk.Data[n]
+	case chunk.ID == [4]byte{'a', 'c', 'i', 'd'}:
+		acid, err := parse_acid(chunk.Data)
+		if err != nil {
+			wav.Warnings = append(wav.Warnings, fmt.Errorf("load_wav(): skipping acid chunk: %w", err))
+			return false
+		}
+		wav.ACID = acid
+		return true
 
-			new_data[n * 2 + 1] = wav.DataChunk.Data[n + 1]
-			new_data[n * 2 + 3] = wav.DataChunk.Data[n + 1]
+	case chunk.ID == [4]byte{'i', 'n', 's', 't'}:
+		inst, err := parse_inst(chunk.Data)
+		if err != nil {
+			wav.Warnings = append(wav.Warnings, fmt.Errorf("load_wav(): skipping inst chunk: %w", err))
+			return false
 		}
+		if err := inst.check() ; err != nil {
+			wav.Warnings = append(wav.Warnings, fmt.Errorf("load_wav(): keeping inst chunk as found, though %w", err))
+		}
+		wav.instrument = inst
+		return true
+	}
+
+	return false
+}
+
+
+func (wav *WAV) extra_chunks_size() uint32 {
+
+	// Bytes taken by the chunks after the data in the file, headers and pad bytes included.
+
+	total := uint32(0)
+
+	for _, chunk := range wav.trailing_chunks() {
+		total += 8 + uint32(len(chunk.Data)) + uint32(len(chunk.Data) % 2)
+	}
+
+	return total
+}
+
+
+func (wav *WAV) blank_copy(frames uint32) *WAV {
+
+	// Returns a silent WAV of the given length, in the same format as this one. If that would be
+	// too large for a WAV, the problem is reported and the WAV is empty instead, so that callers
+	// never get a buffer shorter than they asked for without DataChunk.Size saying so.
+
+	var new_wav WAV
+
+	new_wav.FmtChunk = wav.FmtChunk
+	new_wav.FmtExtension = append([]byte(nil), wav.FmtExtension...)
+	new_wav.Policy = wav.Policy
+	new_wav.Logger = wav.Logger
+
+	if uint64(frames) * uint64(wav.FmtChunk.BlockAlign) > math.MaxUint32 {
+		wav.report(problem_too_large, "%d frames would exceed the maximum WAV size", frames)
+		frames = 0
+	}
+
+	new_wav.DataChunk.Size = frames * uint32(wav.FmtChunk.BlockAlign)
+	new_wav.DataChunk.Data = make([]byte, new_wav.DataChunk.Size)
+
+	return &new_wav
+}
+
+
+func (wav *WAV) copy_metadata() WAV {
+
+	// Everything but the audio, deep copied; DataChunk.Data is left nil. Policy, Logger and the
+	// problem state aren't copied either, since they belong to the WAV object, not its contents.
+
+	var new_wav WAV
+
+	new_wav.FmtChunk = wav.FmtChunk
+	new_wav.FmtExtension = append([]byte(nil), wav.FmtExtension...)
+	new_wav.DataChunk.Size = wav.DataChunk.Size
+
+	for _, chunk := range wav.ExtraChunks {
+		new_wav.ExtraChunks = append(new_wav.ExtraChunks, RawChunk{chunk.ID, append([]byte(nil), chunk.Data...)})
+	}
+
+	new_wav.ID3 = wav.ID3
+	new_wav.ID3.other = append([]byte(nil), wav.ID3.other...)
+	if wav.ID3.original != nil {
+		new_wav.ID3.original = append([]byte(nil), wav.ID3.original...)
+	}
+	new_wav.IXML = wav.IXML
+
+	if wav.ACID != nil {
+		acid := *wav.ACID
+		new_wav.ACID = &acid
+	}
+	if wav.instrument != nil {
+		inst := *wav.instrument
+		new_wav.instrument = &inst
+	}
+
+	return new_wav
+}
 
-		wav.FmtChunk.NumChannels = 2
 
-		wav.FmtChunk.ByteRate *= 2
-		wav.FmtChunk.BlockAlign *= 2
+func (wav *WAV) own_data() {
 
+	// Every method that writes to DataChunk.Data must call this first, for copy-on-write. Callers
+	// writing to DataChunk.Data themselves get no such protection; see Snapshot.
+
+	if wav.borrowed {
+		new_data := make([]byte, len(wav.DataChunk.Data))
+		copy(new_data, wav.DataChunk.Data)
 		wav.DataChunk.Data = new_data
-		wav.DataChunk.Size *= 2
+		wav.borrowed = false
 	}
+}
+
+
+func (wav *WAV) fast_16_stereo() bool {
+	return wav.FmtChunk.BlockAlign == 4 && wav.FmtChunk.BitsPerSample == 16 && wav.FmtChunk.AudioFormat == 1
+}
+
 
-	// We want 44100 Hz:
+func (wav *WAV) sample_format() uint16 {
 
-	if wav.FmtChunk.SampleRate != PREFERRED_FREQ {
+	// The format code of the samples themselves: AudioFormat, unless that's WAVE_FORMAT_EXTENSIBLE,
+	// in which case it's the one in the SubFormat GUID. 0 if the GUID isn't a standard one.
 
-		new_frame_count := wav.FrameCount() * PREFERRED_FREQ / wav.FmtChunk.SampleRate
-		fmt.Fprintf(os.Stderr, "Converting '%s' to %d Hz ", filename, PREFERRED_FREQ)
-		fmt.Fprintf(os.Stderr, " (%d -> %d frames)...\n", wav.FrameCount(), new_frame_count)
-		*wav = *wav.Stretched(new_frame_count)
+	if wav.FmtChunk.AudioFormat != 0xfffe {
+		return wav.FmtChunk.AudioFormat
 	}
 
-	// Final sanity check:
+	ext := wav.FmtExtension
 
-	err := wav.sanitycheck()
-	if err != nil {
-		return fmt.Errorf("convert_wav(): seemed to succeed, but: %v", err)
+	if len(ext) < 24 || !bytes.Equal(ext[10:24], extensible_guid_suffix) {
+		return 0
 	}
 
-	return nil
+	return binary.LittleEndian.Uint16(ext[8:10])
 }
 
 
-func (wav *WAV) sanitycheck() error {
+func (wav *WAV) layout() (uint32, uint32, bool) {
 
-	s := make([]string, 0)
+	// Returns the frame stride and the sample width in bytes, and whether they make sense together.
+	// Only integer PCM can be read or written sample by sample; float data (say, loaded with
+	// KeepFormat) can't, rather than being misread as integers.
 
-	if wav.FmtChunk.Size != 16 {
-		s = append(s, "fmt chunk size != 16")
+	if wav.sample_format() != 1 {
+		return 0, 0, false
 	}
 
-	if wav.FmtChunk.AudioFormat != 1 {
-		s = append(s, "audio format != 1 (PCM)")
+	stride := uint32(wav.FmtChunk.BlockAlign)
+	width := uint32(wav.FmtChunk.BitsPerSample / 8)
+
+	channels := uint32(wav.FmtChunk.NumChannels)
+	if channels > 2 {
+		channels = 2		// We only ever touch the first two
 	}
 
-	if wav.FmtChunk.NumChannels > 2 {
-		s = append(s, "num channels > 2")
+	if stride == 0 || width == 0 || width > 4 || channels == 0 || width * channels > stride {
+		return 0, 0, false
 	}
 
-	if wav.FmtChunk.ByteRate != wav.FmtChunk.SampleRate * uint32(wav.FmtChunk.NumChannels) * uint32(wav.FmtChunk.BitsPerSample) / 8 {
-		s = append(s, "byte rate did not match other fmt fields")
+	return stride, width, true
+}
+
+
+func (wav *WAV) report(kind uint32, format string, args ...any) {
+
+	// Deals with a problem according to the WAV's policy. The error is only built if needed,
+	// since Get() and Set() can end up here a great many times under POLICY_SILENT.
+
+	switch wav.Policy {
+
+	case POLICY_SILENT:
+		return
+
+	case POLICY_ERROR:
+		report_mutex.Lock()
+		defer report_mutex.Unlock()
+		if wav.err == nil {
+			wav.err = fmt.Errorf(format, args...)
+		}
+
+	case POLICY_PANIC:
+		panic(fmt.Errorf(format, args...))
+
+	default:
+		report_mutex.Lock()
+		defer report_mutex.Unlock()
+		if wav.warned & kind == 0 {
+			wav.warned |= kind
+			log := wav.Logger
+			if log == nil {
+				log = get_logger()
+			}
+			log("Warning: %v. No further such warnings shall be given for this WAV.", fmt.Errorf(format, args...))
+		}
 	}
+}
 
-	if wav.FmtChunk.BlockAlign != wav.FmtChunk.NumChannels * wav.FmtChunk.BitsPerSample / 8 {
-		s = append(s, "block align did not match other fmt fields")
+
+func (wav *WAV) convert(ctx context.Context, filename string, rate uint32, log Logger) error {		// Filename given just for printing useful info
+
+	// Remember, this is an in-place conversion, we can't just set *wav ptr to be something else.
+	// Rather, the struct that *wav points to itself needs to be modified.
+
+	// We want 16-bit stereo audio at the target rate, usually 44100 Hz. To keep peak memory down, all
+	// the sizes are worked out first, and everything happens in (at most) one new buffer.
+
+	bits := wav.FmtChunk.BitsPerSample
+	channels := wav.FmtChunk.NumChannels
+
+	if wav.sample_format() != 1 {
+		return fmt.Errorf("convert_wav(): audio in '%s' is not integer PCM", filename)
+	}
+	if bits != 8 && bits != 16 {
+		return fmt.Errorf("convert_wav(): bits per sample in '%s' was not 8 or 16", filename)
+	}
+	if wav.FmtChunk.SampleRate < MIN_SAMPLE_RATE || wav.FmtChunk.SampleRate > MAX_SAMPLE_RATE {		// Also stops tiny files resampling to huge ones
+		return fmt.Errorf("convert_wav(): sample rate %d in '%s' is outside the range %d-%d", wav.FmtChunk.SampleRate, filename, MIN_SAMPLE_RATE, MAX_SAMPLE_RATE)
 	}
 
-	if wav.DataChunk.Size != uint32(len(wav.DataChunk.Data)) {
-		s = append(s, "data chunk size did not match amount of data read")
+	old_frame_count := wav.FrameCount()
+	new_frame_count_64 := uint64(old_frame_count)
+
+	if wav.FmtChunk.SampleRate != rate {
+		new_frame_count_64 = uint64(old_frame_count) * uint64(rate) / uint64(wav.FmtChunk.SampleRate)
+	}
+
+	expanded_size := uint64(old_frame_count) * 4
+	final_size := new_frame_count_64 * 4
+
+	if expanded_size > math.MaxUint32 || final_size > math.MaxUint32 {
+		return fmt.Errorf("convert_wav(): '%s' would be too large as 16-bit stereo at %d Hz", filename, rate)
+	}
+
+	new_frame_count := uint32(new_frame_count_64)
+
+	if bits == 8 {
+		log("Converting '%s' to 16 bit...", filename)
+	}
+	if channels == 1 {
+		log("Converting '%s' to stereo...", filename)
+	}
+	if wav.FmtChunk.SampleRate != rate {
+		log("Converting '%s' to %d Hz (%d -> %d frames)...", filename, rate, old_frame_count, new_frame_count)
 	}
 
-	if len(s) > 0 {
-		msg := "sanitycheck(): " + strings.Join(s, ", ")
-		return fmt.Errorf("%v", msg)
+	data := wav.DataChunk.Data[:wav.DataChunk.Size]
+
+	if bits != 16 || channels != 2 || final_size > expanded_size {
+		buf := make([]byte, max(expanded_size, final_size))
+		expand_to_16_stereo(data, buf, old_frame_count, bits, channels)
+		data = buf
+	}
+
+	err := resample_in_place(ctx, data, old_frame_count, new_frame_count)
+	if err != nil {
+		return fmt.Errorf("convert_wav(): %w", err)
+	}
+
+	wav.FmtChunk.Size = 16
+	wav.FmtChunk.AudioFormat = 1
+	wav.FmtExtension = nil
+	wav.FmtChunk.BitsPerSample = 16
+	wav.FmtChunk.NumChannels = 2
+	wav.FmtChunk.BlockAlign = 4
+	wav.FmtChunk.SampleRate = rate
+	wav.FmtChunk.ByteRate = rate * 4
+
+	wav.DataChunk.Data = data[:final_size]
+	wav.DataChunk.Size = uint32(final_size)
+
+	// Final sanity check:
+
+	err = wav.Validate()
+	if err != nil {
+		return fmt.Errorf("convert_wav(): seemed to succeed, but: %v", err)
 	}
 
 	return nil
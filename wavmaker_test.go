@@ -0,0 +1,1378 @@
+package wavmaker
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//go:embed testdata/tiny.wav
+var test_fs embed.FS		// tiny.wav is 32 frames of 16-bit stereo at 44100 Hz, frame n being (100n, -100n)
+
+// Tests run with POLICY_PANIC where they can, so an out of bounds Get() or Set() (which would
+// otherwise be one warning, discarded by default) fails the test.
+
+func test_wav(frames uint32) *WAV {
+
+	// A stereo WAV at the preferred rate holding a recognisable ramp, different in each channel.
+
+	wav := New(frames)
+	wav.Policy = POLICY_PANIC
+
+	for n := uint32(0) ; n < frames ; n++ {
+		wav.Set(n, int16(n * 7), -int16(n * 3))
+	}
+
+	return wav
+}
+
+
+func TestStretchedEmptySource(t *testing.T) {
+
+	for _, frames := range []uint32{0, 1, 2, 1000} {
+
+		result := test_wav(0).Stretched(frames)
+
+		if result.FrameCount() != frames {
+			t.Fatalf("stretching 0 frames to %d gave %d frames", frames, result.FrameCount())
+		}
+		for n := uint32(0) ; n < frames ; n++ {
+			if left, right := result.Get(n); left != 0 || right != 0 {
+				t.Fatalf("stretching 0 frames to %d: frame %d is %d, %d, not silence", frames, n, left, right)
+			}
+		}
+	}
+}
+
+
+func TestStretchedToOneFrame(t *testing.T) {
+
+	for _, frames := range []uint32{1, 2, 1000} {
+
+		source := test_wav(frames)
+		result := source.Stretched(1)
+
+		if result.FrameCount() != 1 {
+			t.Fatalf("stretching %d frames to 1 gave %d frames", frames, result.FrameCount())
+		}
+
+		left, right := result.Get(0)
+		want_left, want_right := source.Get(0)
+
+		if left != want_left || right != want_right {
+			t.Fatalf("stretching %d frames to 1 gave %d, %d, expected the first frame's %d, %d", frames, left, right, want_left, want_right)
+		}
+	}
+}
+
+
+func TestStretchedFromOneFrame(t *testing.T) {
+
+	source := test_wav(0)
+	source.DataChunk.Data = []byte{0x34, 0x12, 0xcc, 0xfe}
+	source.DataChunk.Size = 4
+
+	result := source.Stretched(500)
+
+	for n := uint32(0) ; n < 500 ; n++ {
+		if left, right := result.Get(n); left != 0x1234 || right != -0x134 {
+			t.Fatalf("frame %d is %d, %d, expected the one source frame repeated", n, left, right)
+		}
+	}
+}
+
+
+func TestStretchedTooLarge(t *testing.T) {
+
+	// 2^31 frames of 4 bytes each is past what a WAV can hold; the length used to wrap, leaving
+	// the fast path a buffer far too short for it.
+
+	for _, policy := range []ErrorPolicy{POLICY_SILENT, POLICY_ERROR} {
+
+		source := test_wav(2)
+		source.Policy = policy
+
+		result := source.Stretched(1 << 31)
+
+		if result.FrameCount() != 0 || result.Validate() != nil {
+			t.Fatalf("policy %d: expected an empty valid WAV, got %d frames", policy, result.FrameCount())
+		}
+		if policy == POLICY_ERROR && source.Err() == nil {
+			t.Fatalf("policy %d: the problem wasn't recorded", policy)
+		}
+
+		if source.StretchedRelative(1e12).FrameCount() != 0 {
+			t.Fatalf("policy %d: StretchedRelative() didn't give an empty WAV", policy)
+		}
+	}
+
+	if _, err := test_wav(2).StretchedContext(context.Background(), 1 << 31); err == nil {
+		t.Fatalf("StretchedContext() didn't return an error")
+	}
+}
+
+
+func TestConcurrentReads(t *testing.T) {
+
+	// The documented contract: readers can share a WAV, even when they make out of bounds calls
+	// that get reported. Worth running with -race, which is what it's really for.
+
+	for _, policy := range []ErrorPolicy{POLICY_WARN_ONCE, POLICY_ERROR, POLICY_SILENT} {
+
+		shared := test_wav(10000)
+		shared.Policy = policy
+
+		want_peak := shared.Peak()
+		want_bytes := shared.Bytes()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 16)
+
+		for g := 0 ; g < 8 ; g++ {
+
+			wg.Add(1)
+
+			go func(g int) {
+
+				defer wg.Done()
+
+				// Each goroutine mixes the shared WAV into a target of its own...
+
+				target := New(shared.FrameCount())
+				target.Add(0, shared, 0, shared.FrameCount(), 0.5, 100)
+
+				for n := uint32(0) ; n < shared.FrameCount() + 10 ; n++ {
+					shared.Get(n)		// Goes out of bounds at the end
+				}
+
+				if shared.FrameCount() != 10000 || shared.Peak() != want_peak || !shared.Copy().Equal(shared) {
+					errs <- fmt.Errorf("goroutine %d saw the shared WAV change", g)
+				}
+				if !bytes.Equal(shared.Bytes(), want_bytes) {
+					errs <- fmt.Errorf("goroutine %d got different bytes from Bytes()", g)
+				}
+				shared.Err()
+			}(g)
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Error(err)
+		}
+
+		if policy == POLICY_ERROR && shared.Err() == nil {
+			t.Errorf("the out of bounds Get() calls weren't recorded")
+		}
+	}
+}
+
+
+func TestConcurrentWritesToSeparateWAVs(t *testing.T) {
+
+	// Nothing global should be written to by operations on different WAVs.
+
+	var wg sync.WaitGroup
+
+	for g := 0 ; g < 8 ; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wav := test_wav(5000)
+			wav.Policy = POLICY_WARN_ONCE
+			wav.Set(99999, 1, 1)
+			wav.FadeSamples(1000).FadeInSamples(100).Normalize(0.5)
+			wav.Stretched(7000).Repitched(3)
+		}()
+	}
+
+	wg.Wait()
+}
+
+
+func TestGetSetMono16(t *testing.T) {
+
+	// Built by hand rather than with NewWithFormat(), so only the fmt fields say what the layout is.
+
+	wav := &WAV{Policy: POLICY_PANIC}
+	wav.FmtChunk = FmtChunk_Struct{Size: 16, AudioFormat: 1, NumChannels: 1, SampleRate: 22050, ByteRate: 44100, BlockAlign: 2, BitsPerSample: 16}
+	wav.DataChunk.Data = []byte{0x01, 0x00, 0x02, 0x00, 0x03, 0x00}
+	wav.DataChunk.Size = 6
+
+	if wav.FrameCount() != 3 {
+		t.Fatalf("FrameCount() is %d, expected 3", wav.FrameCount())
+	}
+
+	if left, right := wav.Get(1); left != 2 || right != 2 {
+		t.Fatalf("Get(1) gave %d, %d, expected 2, 2", left, right)
+	}
+
+	wav.Set(2, 0x1234, 0x1234)
+	wav.Set(0, 100, -300)		// Stored as the average
+
+	want := []byte{0x9c, 0xff, 0x02, 0x00, 0x34, 0x12}
+
+	if !bytes.Equal(wav.DataChunk.Data, want) {
+		t.Fatalf("data is % x, expected % x", wav.DataChunk.Data, want)
+	}
+
+	if left, right := wav.Get(0); left != -100 || right != -100 {
+		t.Fatalf("Get(0) gave %d, %d, expected -100, -100", left, right)
+	}
+}
+
+
+func TestGetSetStereo24(t *testing.T) {
+
+	// 24-bit samples: Set() zeroes the low byte, Get() ignores it.
+
+	wav := &WAV{Policy: POLICY_PANIC}
+	wav.FmtChunk = FmtChunk_Struct{Size: 16, AudioFormat: 1, NumChannels: 2, SampleRate: 48000, ByteRate: 288000, BlockAlign: 6, BitsPerSample: 24}
+	wav.DataChunk.Data = []byte{0xff, 0x01, 0x02, 0xff, 0x03, 0x04, 0xff, 0x05, 0x06, 0xff, 0x07, 0x08}
+	wav.DataChunk.Size = 12
+
+	if left, right := wav.Get(1); left != 0x0605 || right != 0x0807 {
+		t.Fatalf("Get(1) gave %#x, %#x, expected 0x605, 0x807", left, right)
+	}
+
+	wav.Set(0, -2, 0x7fff)
+
+	want := []byte{0x00, 0xfe, 0xff, 0x00, 0xff, 0x7f, 0xff, 0x05, 0x06, 0xff, 0x07, 0x08}
+
+	if !bytes.Equal(wav.DataChunk.Data, want) {
+		t.Fatalf("data is % x, expected % x", wav.DataChunk.Data, want)
+	}
+}
+
+
+func TestGetSetBounds(t *testing.T) {
+
+	wav := &WAV{Policy: POLICY_ERROR}
+	wav.FmtChunk = FmtChunk_Struct{Size: 16, AudioFormat: 1, NumChannels: 1, SampleRate: 22050, ByteRate: 44100, BlockAlign: 2, BitsPerSample: 16}
+	wav.DataChunk.Data = []byte{0x01, 0x00, 0x02, 0x00, 0x03}		// A partial frame at the end
+	wav.DataChunk.Size = 5
+
+	wav.Set(2, 1, 1)
+
+	if wav.Err() == nil {
+		t.Fatalf("Set() into a partial frame wasn't reported")
+	}
+	if wav.DataChunk.Data[4] != 0x03 {
+		t.Fatalf("Set() into a partial frame wrote to it")
+	}
+}
+
+
+func noise_wav(frames uint32, seed int64) *WAV {
+
+	// Full-scale white noise, whose big jumps between frames exercise the int16 wrap-around in
+	// Stretched()'s interpolation.
+
+	wav := New(frames)
+	rng := rand.New(rand.NewSource(seed))
+
+	for n := uint32(0) ; n < frames ; n++ {
+		wav.Set(n, int16(rng.Uint32()), int16(rng.Uint32()))
+	}
+
+	return wav
+}
+
+
+func stretched_reference(original *WAV, new_frame_count uint32) *WAV {
+
+	// Stretched() as it was before it worked on the bytes directly, via Get() and Set().
+
+	new_wav := original.blank_copy(new_frame_count)
+
+	left, right := original.Get(original.FrameCount() - 1)
+	new_wav.Set(new_frame_count - 1, left, right)
+
+	for n := uint32(0) ; n <= new_frame_count - 2 ; n++ {
+
+		index_f := (float64(n) / float64(new_frame_count - 1)) * float64(original.FrameCount() - 1)
+		index := uint32(index_f)
+
+		interpolate_fraction := index_f - float64(index)
+
+		next_index := index + 1
+		if next_index >= original.FrameCount() {
+			next_index = index
+		}
+
+		old_val_left,      old_val_right      := original.Get(index)
+		old_val_left_next, old_val_right_next := original.Get(next_index)
+
+		diff_left  := old_val_left_next  - old_val_left
+		diff_right := old_val_right_next - old_val_right
+
+		new_wav.Set(n, int16(float64(old_val_left) + float64(diff_left) * interpolate_fraction),
+		               int16(float64(old_val_right) + float64(diff_right) * interpolate_fraction))
+	}
+
+	return new_wav
+}
+
+
+func TestStretchedMatchesReference(t *testing.T) {
+
+	source := noise_wav(20000, 1)
+
+	for _, frames := range []uint32{2, 3, 1000, 19999, 20001, 44100, 100000} {
+		if !source.Stretched(frames).Equal(stretched_reference(source, frames)) {
+			t.Fatalf("stretching to %d frames differs from the reference", frames)
+		}
+	}
+
+	one := noise_wav(1, 2)
+
+	if !one.Stretched(50).Equal(stretched_reference(one, 50)) {
+		t.Fatalf("stretching a single frame differs from the reference")
+	}
+}
+
+
+func BenchmarkStretched(b *testing.B) {
+	source := noise_wav(PREFERRED_FREQ * 60, 1)
+	b.ResetTimer()
+	for i := 0 ; i < b.N ; i++ {
+		source.Stretched(PREFERRED_FREQ * 60 * 11 / 10)
+	}
+}
+
+
+func BenchmarkStretchedReference(b *testing.B) {
+	source := noise_wav(PREFERRED_FREQ * 60, 1)
+	b.ResetTimer()
+	for i := 0 ; i < b.N ; i++ {
+		stretched_reference(source, PREFERRED_FREQ * 60 * 11 / 10)
+	}
+}
+
+
+func insert_reference(target *WAV, t_loc uint32, source *WAV, s_loc uint32, frames uint32, volume float64, fadeout uint32, additive bool) uint32 {
+
+	// Insert() as it was before it walked the byte buffers directly, via Get() and Set(). Like
+	// the original, it writes one frame even when frames is 0.
+
+	clipped := uint32(0)
+
+	for i := uint32(0) ; i == 0 || i < frames ; i++ {
+
+		t, s := uint64(t_loc) + uint64(i), uint64(s_loc) + uint64(i)
+
+		if t >= uint64(target.FrameCount()) || s >= uint64(source.FrameCount()) {
+			break
+		}
+
+		target_left, target_right := int16(0), int16(0)
+		if additive {
+			target_left, target_right = target.Get(uint32(t))
+		}
+
+		source_left, source_right := source.Get(uint32(s))
+
+		frames_to_go := frames - i
+		if frames_to_go < fadeout {
+			fade_multiplier := float64(frames_to_go) / float64(fadeout)
+			source_left  = int16(fade_multiplier * float64(source_left))
+			source_right = int16(fade_multiplier * float64(source_right))
+		}
+
+		var new_left, new_right int32
+
+		if volume == 1.0 {
+			new_left  = int32(target_left)  + int32(source_left)
+			new_right = int32(target_right) + int32(source_right)
+		} else {
+			new_left  = int32(target_left)  + int32(float64(source_left) * volume)
+			new_right = int32(target_right) + int32(float64(source_right) * volume)
+		}
+
+		if new_left  < -32768 { new_left  = -32768 ; clipped++ }
+		if new_left  >  32767 { new_left  =  32767 ; clipped++ }
+		if new_right < -32768 { new_right = -32768 ; clipped++ }
+		if new_right >  32767 { new_right =  32767 ; clipped++ }
+
+		target.Set(uint32(t), int16(new_left), int16(new_right))
+	}
+
+	return clipped
+}
+
+
+func TestInsertMatchesReference(t *testing.T) {
+
+	source := noise_wav(3000, 3)
+	background := noise_wav(5000, 4)
+
+	cases := []struct {
+		t_loc, s_loc, frames uint32
+		volume float64
+		fadeout uint32
+		additive bool
+	}{
+		{0, 0, 3000, 1.0, 0, true},
+		{100, 0, 3000, 1.0, 0, false},
+		{100, 50, 2000, 0.7, 0, true},
+		{4000, 0, 3000, 1.0, 500, true},		// Runs off the end of the target
+		{0, 2500, 3000, 0.3, 100, false},		// Runs off the end of the source
+		{10, 10, 1000, 1.0, 5000, true},		// Fadeout longer than the note
+		{0, 0, 0, 1.0, 0, true},
+		{0, 0, 0, 1.0, 10, false},
+		{6000, 0, 100, 1.0, 0, true},			// Entirely out of range
+		{0, 0, 3000, -1.5, 20, true},
+	}
+
+	for i, c := range cases {
+
+		got, want := background.Copy(), background.Copy()
+
+		got_clipped := got.Insert(c.t_loc, source, c.s_loc, c.frames, c.volume, c.fadeout, c.additive)
+		want_clipped := insert_reference(want, c.t_loc, source, c.s_loc, c.frames, c.volume, c.fadeout, c.additive)
+
+		if !got.Equal(want) {
+			t.Fatalf("case %d: the result differs from the reference", i)
+		}
+		if got_clipped != want_clipped {
+			t.Fatalf("case %d: %d samples clipped, the reference says %d", i, got_clipped, want_clipped)
+		}
+	}
+}
+
+
+func bench_add(b *testing.B, add func(target *WAV, t_loc uint32, note *WAV)) {
+
+	// 1000 one-second notes mixed into a 3 minute target.
+
+	target := New(PREFERRED_FREQ * 180)
+	note := noise_wav(PREFERRED_FREQ, 5)
+	note.FadeSamples(PREFERRED_FREQ)
+
+	b.ResetTimer()
+
+	for i := 0 ; i < b.N ; i++ {
+		for n := uint32(0) ; n < 1000 ; n++ {
+			add(target, n * (PREFERRED_FREQ * 179 / 1000), note)
+		}
+	}
+}
+
+
+func BenchmarkAdd(b *testing.B) {
+	bench_add(b, func(target *WAV, t_loc uint32, note *WAV) {
+		target.Add(t_loc, note, 0, note.FrameCount(), 0.1, 0)
+	})
+}
+
+
+func BenchmarkAddReference(b *testing.B) {
+	bench_add(b, func(target *WAV, t_loc uint32, note *WAV) {
+		insert_reference(target, t_loc, note, 0, note.FrameCount(), 0.1, 0, true)
+	})
+}
+
+
+func raw_wav(fmt_chunk FmtChunk_Struct, data []byte) []byte {
+
+	// A minimal file, fmt and data chunks only, with whatever fields it's given, sane or not.
+
+	var buf bytes.Buffer
+	bo := binary.LittleEndian
+
+	buf.WriteString("RIFF")
+	binary.Write(&buf, bo, uint32(4 + 8 + 16 + 8 + len(data) + len(data) % 2))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, bo, uint32(16))
+	for _, field := range []any{fmt_chunk.AudioFormat, fmt_chunk.NumChannels, fmt_chunk.SampleRate, fmt_chunk.ByteRate, fmt_chunk.BlockAlign, fmt_chunk.BitsPerSample} {
+		binary.Write(&buf, bo, field)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, bo, uint32(len(data)))
+	buf.Write(data)
+	if len(data) % 2 == 1 {
+		buf.WriteByte(0)
+	}
+
+	return buf.Bytes()
+}
+
+
+func with_chunks(file []byte, chunks ...RawChunk) []byte {
+
+	// The file with the given chunks appended (padded as they should be), and its RIFF size fixed.
+
+	buf := bytes.NewBuffer(append([]byte(nil), file...))
+
+	for _, chunk := range chunks {
+		buf.Write(chunk.ID[:])
+		binary.Write(buf, binary.LittleEndian, uint32(len(chunk.Data)))
+		buf.Write(chunk.Data)
+		if len(chunk.Data) % 2 == 1 {
+			buf.WriteByte(0)
+		}
+	}
+
+	ret := buf.Bytes()
+	binary.LittleEndian.PutUint32(ret[4:8], uint32(len(ret) - 8))
+
+	return ret
+}
+
+
+func temp_file(t *testing.T, b []byte) string {
+
+	filename := filepath.Join(t.TempDir(), "test.wav")
+
+	if err := os.WriteFile(filename, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+
+func BenchmarkLoadConvert(b *testing.B) {
+
+	// An 8-bit mono 22050 Hz file of 4 MB, which Load() expands to 16-bit stereo and resamples.
+	// B/op should be close to the 4 MB read plus the 32 MB of the result, i.e. one new buffer.
+
+	data := make([]byte, 4 << 20)
+	rng := rand.New(rand.NewSource(8))
+	rng.Read(data)
+
+	file := raw_wav(FmtChunk_Struct{AudioFormat: 1, NumChannels: 1, SampleRate: 22050, ByteRate: 22050, BlockAlign: 1, BitsPerSample: 8}, data)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0 ; i < b.N ; i++ {
+		_, err := LoadBytes(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+
+func extensible_wav(sub_format uint16, bits uint16) *WAV {
+
+	// 100 frames of 2 channel WAVE_FORMAT_EXTENSIBLE, with the given format code in its GUID.
+
+	wav := &WAV{Policy: POLICY_ERROR}
+	block := 2 * bits / 8
+	wav.FmtChunk = FmtChunk_Struct{Size: 40, AudioFormat: 0xfffe, NumChannels: 2, SampleRate: 44100,
+		ByteRate: 44100 * uint32(block), BlockAlign: block, BitsPerSample: bits}
+
+	ext := []byte{22, 0, byte(bits), 0, 3, 0, 0, 0, byte(sub_format), byte(sub_format >> 8)}
+	wav.FmtExtension = append(ext, extensible_guid_suffix...)
+
+	wav.DataChunk.Size = 100 * uint32(block)
+	wav.DataChunk.Data = make([]byte, wav.DataChunk.Size)
+
+	return wav
+}
+
+
+func TestExtensiblePCM(t *testing.T) {
+
+	wav := extensible_wav(1, 16)
+	wav.Set(5, 1234, -1234)
+
+	if left, right := wav.Get(5); left != 1234 || right != -1234 || wav.Err() != nil {
+		t.Fatalf("extensible PCM read back as %d, %d (%v)", left, right, wav.Err())
+	}
+
+	loaded, err := LoadBytes(wav.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := loaded.Get(5); left != 1234 || loaded.FmtChunk.AudioFormat != 1 {
+		t.Fatalf("extensible PCM loaded as format %d, frame 5 is %d", loaded.FmtChunk.AudioFormat, left)
+	}
+}
+
+
+func TestFloatIsNotReadAsPCM(t *testing.T) {
+
+	for _, wav := range []*WAV{extensible_wav(3, 32), extensible_wav(3, 16), extensible_wav(0x55, 16)} {
+
+		wav.DataChunk.Data[20] = 0x3f		// Not zero, whatever it would mean as an integer
+
+		if left, right := wav.Get(5); left != 0 || right != 0 || wav.Err() == nil {
+			t.Fatalf("format %#x: Get() read %d, %d without reporting a problem", wav.sample_format(), left, right)
+		}
+
+		if _, err := LoadBytes(wav.Bytes()) ; err == nil {
+			t.Fatalf("format %#x: LoadBytes() converted it as if it were PCM", wav.sample_format())
+		}
+	}
+
+	plain := extensible_wav(1, 32)
+	plain.FmtChunk.AudioFormat = 3
+	plain.FmtChunk.Size = 16
+	plain.FmtExtension = nil
+
+	kept := &WAV{Policy: POLICY_ERROR}
+	if err := kept.UnmarshalBinary(plain.Bytes()) ; err != nil {
+		t.Fatal(err)
+	}
+	if kept.FmtChunk.AudioFormat != 3 {
+		t.Fatalf("UnmarshalBinary() didn't keep the float format")
+	}
+	if kept.Peak() ; kept.Err() == nil {
+		t.Fatalf("Peak() of float data didn't report a problem")
+	}
+}
+
+
+func TestLoadFSEmbedded(t *testing.T) {
+
+	wav, err := LoadFS(test_fs, "testdata/tiny.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.FrameCount() != 32 {
+		t.Fatalf("loaded %d frames, expected 32", wav.FrameCount())
+	}
+	for n := uint32(0) ; n < 32 ; n++ {
+		if left, right := wav.Get(n); left != int16(n * 100) || right != -int16(n * 100) {
+			t.Fatalf("frame %d is %d, %d", n, left, right)
+		}
+	}
+
+	_, err = LoadFS(test_fs, "testdata/missing.wav")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("loading a missing file gave %v, which isn't fs.ErrNotExist", err)
+	}
+}
+
+
+func FuzzLoad(f *testing.F) {
+
+	// Load must never panic, whatever it's given, and anything it accepts must be a valid WAV of
+	// plausible size: the worst legitimate growth is 8-bit mono at the lowest rate becoming
+	// 16-bit stereo at PREFERRED_FREQ. The non-seekable path (which can't check sizes against
+	// the remaining input) is fuzzed too. The corpus in testdata/fuzz/FuzzLoad holds inputs
+	// that used to make Load() panic or allocate far too much.
+
+	f.Add(New(0).Bytes())
+	f.Add(test_wav(10).Bytes())
+	f.Add(raw_wav(FmtChunk_Struct{AudioFormat: 1, NumChannels: 1, SampleRate: 8000, ByteRate: 8000, BlockAlign: 1, BitsPerSample: 8}, []byte{1, 2, 3}))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+
+		max_bytes := uint64(len(b)) * 4 * (PREFERRED_FREQ / MIN_SAMPLE_RATE + 1)
+
+		for _, load := range []func() (*WAV, error){
+			func() (*WAV, error) { return LoadBytes(b) },
+			func() (*WAV, error) { return LoadReader(struct{ io.Reader }{bytes.NewReader(b)}) },
+		} {
+			wav, err := load()
+			if err != nil {
+				continue
+			}
+			if err := wav.Validate() ; err != nil {
+				t.Fatalf("loaded an invalid WAV: %v", err)
+			}
+			if !wav.fast_16_stereo() || wav.FmtChunk.SampleRate != PREFERRED_FREQ {
+				t.Fatalf("loaded a WAV that wasn't converted: %+v", wav.FmtChunk)
+			}
+			if uint64(wav.DataChunk.Size) > max_bytes {
+				t.Fatalf("%d bytes of input became %d bytes of audio", len(b), wav.DataChunk.Size)
+			}
+		}
+	})
+}
+
+
+func mono8_file(frames int) []byte {
+
+	// 8-bit mono at 22050 Hz, so Load() has all three conversions to do.
+
+	data := make([]byte, frames)
+	for n := range data {
+		data[n] = byte(n * 13)
+	}
+
+	return raw_wav(FmtChunk_Struct{AudioFormat: 1, NumChannels: 1, SampleRate: 22050, ByteRate: 22050, BlockAlign: 1, BitsPerSample: 8}, data)
+}
+
+
+func stereo16_fmt() FmtChunk_Struct {
+	return FmtChunk_Struct{AudioFormat: 1, NumChannels: 2, SampleRate: 44100, ByteRate: 176400, BlockAlign: 4, BitsPerSample: 16}
+}
+
+
+func TestLoadOptionsZeroValue(t *testing.T) {
+
+	unknown := RawChunk{[4]byte{'a', 'b', 'c', 'd'}, []byte{1, 2, 3}}
+
+	for _, file := range [][]byte{mono8_file(999), with_chunks(raw_wav(stereo16_fmt(), make([]byte, 400)), unknown)} {
+
+		filename := temp_file(t, file)
+
+		want, err := Load(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadWithOptions(filename, LoadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.Equal(want) || !bytes.Equal(got.Bytes(), want.Bytes()) || len(got.Warnings) != len(want.Warnings) {
+			t.Fatalf("the zero LoadOptions gave a different result from Load()")
+		}
+	}
+}
+
+
+func TestLoadOptionsLenient(t *testing.T) {
+
+	// A data chunk claiming 400 bytes with 43 present: an error normally, 10 whole frames when lenient.
+
+	file := raw_wav(stereo16_fmt(), make([]byte, 400))[:44 + 43]
+	filename := temp_file(t, file)
+
+	if _, err := Load(filename); err == nil {
+		t.Fatalf("Load() accepted a truncated data chunk")
+	}
+
+	wav, err := LoadWithOptions(filename, LoadOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.FrameCount() != 10 {
+		t.Fatalf("lenient load kept %d frames, expected 10", wav.FrameCount())
+	}
+}
+
+
+func TestLoadOptionsLogger(t *testing.T) {
+
+	// The option overrides the package logger, which should hear nothing.
+
+	var package_log, option_log []string
+
+	SetLogger(func(format string, args ...any) { package_log = append(package_log, fmt.Sprintf(format, args...)) })
+	defer SetLogger(nil)
+
+	_, err := LoadWithOptions(temp_file(t, mono8_file(100)), LoadOptions{Logger: func(format string, args ...any) {
+		option_log = append(option_log, fmt.Sprintf(format, args...))
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(option_log) != 3 || len(package_log) != 0 {
+		t.Fatalf("expected 3 conversion messages, all to the option's logger; got %q and %q", option_log, package_log)
+	}
+}
+
+
+func TestLoadOptionsMaxDataBytes(t *testing.T) {
+
+	filename := temp_file(t, raw_wav(stereo16_fmt(), make([]byte, 400)))
+
+	if _, err := LoadWithOptions(filename, LoadOptions{MaxDataBytes: 399}); err == nil {
+		t.Fatalf("a 400 byte data chunk was accepted with a maximum of 399")
+	}
+	if _, err := LoadWithOptions(filename, LoadOptions{MaxDataBytes: 400}); err != nil {
+		t.Fatalf("a 400 byte data chunk was refused with a maximum of 400: %v", err)
+	}
+}
+
+
+func TestLoadOptionsSampleRate(t *testing.T) {
+
+	filename := temp_file(t, mono8_file(22050))
+
+	wav, err := LoadWithOptions(filename, LoadOptions{SampleRate: 48000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.FmtChunk.SampleRate != 48000 || wav.FmtChunk.ByteRate != 192000 || wav.FrameCount() != 48000 {
+		t.Fatalf("converting 1 second to 48000 Hz gave %d frames at %d Hz", wav.FrameCount(), wav.FmtChunk.SampleRate)
+	}
+
+	if _, err := LoadWithOptions(filename, LoadOptions{SampleRate: MIN_SAMPLE_RATE - 1}); err == nil {
+		t.Fatalf("a rate below MIN_SAMPLE_RATE was accepted")
+	}
+}
+
+
+func TestLoadOptionsKeepFormat(t *testing.T) {
+
+	file := mono8_file(999)
+
+	wav, err := LoadWithOptions(temp_file(t, file), LoadOptions{KeepFormat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wav.FmtChunk.NumChannels != 1 || wav.FmtChunk.BitsPerSample != 8 || wav.FmtChunk.SampleRate != 22050 {
+		t.Fatalf("KeepFormat converted the WAV: %+v", wav.FmtChunk)
+	}
+	if !bytes.Equal(wav.Bytes(), file) {
+		t.Fatalf("KeepFormat didn't give back the file as it was")
+	}
+}
+
+
+func TestLoadOptionsDropExtraChunks(t *testing.T) {
+
+	// Unknown chunks go, but ones with fields of their own (here, iXML) are still read.
+
+	unknown := RawChunk{[4]byte{'a', 'b', 'c', 'd'}, []byte{1, 2, 3}}
+	ixml := RawChunk{[4]byte{'i', 'X', 'M', 'L'}, []byte("<BWFXML></BWFXML>")}
+	filename := temp_file(t, with_chunks(raw_wav(stereo16_fmt(), make([]byte, 400)), unknown, ixml))
+
+	kept, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := LoadWithOptions(filename, LoadOptions{DropExtraChunks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kept.ExtraChunks) != 1 || len(dropped.ExtraChunks) != 0 {
+		t.Fatalf("expected 1 extra chunk normally and none with DropExtraChunks, got %d and %d", len(kept.ExtraChunks), len(dropped.ExtraChunks))
+	}
+	if dropped.IXML != "<BWFXML></BWFXML>" {
+		t.Fatalf("DropExtraChunks lost the iXML")
+	}
+}
+
+
+func capture_stderr(t *testing.T, f func()) string {
+
+	// Runs f with os.Stderr sent to a pipe, and returns what was written.
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := os.Stderr
+	os.Stderr = w
+	f()
+	os.Stderr = saved
+	w.Close()
+
+	b, _ := io.ReadAll(r)
+	r.Close()
+
+	return string(b)
+}
+
+
+func TestSetLogger(t *testing.T) {
+
+	// A recording logger gets the conversion messages and the once-only warnings, and nothing
+	// reaches stderr; with Discard, nothing goes anywhere.
+
+	var log []string
+
+	exercise := func() {
+		if _, err := LoadBytes(mono8_file(100)); err != nil {
+			t.Fatal(err)
+		}
+		wav := New(10)
+		wav.Policy = POLICY_WARN_ONCE
+		wav.Get(10)
+		wav.Get(11)
+		wav.Set(10, 0, 0)
+	}
+
+	SetLogger(func(format string, args ...any) { log = append(log, fmt.Sprintf(format, args...)) })
+	defer SetLogger(nil)
+
+	if out := capture_stderr(t, exercise) ; out != "" {
+		t.Fatalf("with a logger installed, stderr got %q", out)
+	}
+
+	want := []string{"Converting '<bytes>' to 16 bit...", "Converting '<bytes>' to stereo...", "Converting '<bytes>' to 44100 Hz"}
+
+	if len(log) != 5 {
+		t.Fatalf("expected 3 conversion messages and 2 warnings, got %q", log)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(log[i], prefix) {
+			t.Fatalf("message %d was %q, expected it to start %q", i, log[i], prefix)
+		}
+	}
+	if !strings.HasPrefix(log[3], "Warning:") || !strings.HasPrefix(log[4], "Warning:") || log[3] == log[4] {
+		t.Fatalf("expected one warning each for the bad Get() and Set(), got %q", log[3:])
+	}
+
+	log = nil
+	SetLogger(Discard)
+
+	if out := capture_stderr(t, exercise) ; out != "" || len(log) != 0 {
+		t.Fatalf("with Discard, stderr got %q and the old logger got %q", out, log)
+	}
+
+	// The default is silence too, and Stderr is there for those who want it.
+
+	SetLogger(nil)
+
+	if out := capture_stderr(t, exercise) ; out != "" {
+		t.Fatalf("by default, stderr got %q", out)
+	}
+
+	SetLogger(Stderr)
+
+	if out := capture_stderr(t, exercise) ; strings.Count(out, "\n") != 5 || !strings.HasPrefix(out, "Converting '<bytes>' to 16 bit...") {
+		t.Fatalf("with Stderr, stderr got %q", out)
+	}
+}
+
+
+func TestWAVLogger(t *testing.T) {
+
+	// A WAV's own logger gets its warnings instead of the package logger, and copies inherit it.
+
+	var package_log, wav_log []string
+
+	SetLogger(func(format string, args ...any) { package_log = append(package_log, fmt.Sprintf(format, args...)) })
+	defer SetLogger(nil)
+
+	wav := New(10)
+	wav.Logger = func(format string, args ...any) { wav_log = append(wav_log, fmt.Sprintf(format, args...)) }
+
+	wav.Get(10)
+	wav.Copy().Set(10, 0, 0)
+	New(10).Get(10)
+
+	if len(wav_log) != 2 || len(package_log) != 1 {
+		t.Fatalf("the WAV's logger got %q, the package logger %q", wav_log, package_log)
+	}
+}
+
+
+func chunk_rich_file() []byte {
+
+	// 16-bit stereo at the preferred rate (so Load() leaves it alone) followed by chunks of both
+	// kinds, several of odd size, in the order Save() writes them: unknown ones as found, then
+	// the ones made from fields.
+
+	data := make([]byte, 400)
+	for n := range data {
+		data[n] = byte(n * 7)
+	}
+
+	return with_chunks(raw_wav(stereo16_fmt(), data),
+		RawChunk{[4]byte{'a', 'x', 'm', 'l'}, []byte("<x/>!")},
+		RawChunk{[4]byte{'L', 'I', 'S', 'T'}, []byte("INFOINAM\x05\x00\x00\x00Take\x00\x00")},
+		RawChunk{[4]byte{'u', 'm', 'i', 'd'}, bytes.Repeat([]byte{0xab}, 64)},
+		RawChunk{[4]byte{'X', 'Y', 'Z', 'W'}, []byte{9}},
+		RawChunk{[4]byte{'i', 'X', 'M', 'L'}, []byte("<BWFXML><TAKE>3</TAKE></BWFXML>")},
+		RawChunk{[4]byte{'a', 'c', 'i', 'd'}, (&ACIDInfo{Beats: 8, Tempo: 120}).encode()})
+}
+
+
+func TestExtraChunksRoundTrip(t *testing.T) {
+
+	file := chunk_rich_file()
+
+	wav, err := LoadBytes(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(wav.ExtraChunks) != 4 || wav.IXML == "" || wav.ACID == nil {
+		t.Fatalf("expected 4 extra chunks plus iXML and acid, got %d extra chunks", len(wav.ExtraChunks))
+	}
+	if !bytes.Equal(wav.Bytes(), file) {
+		t.Fatalf("saving gave different bytes from the file loaded")
+	}
+
+	again, err := LoadBytes(wav.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Bytes(), file) {
+		t.Fatalf("a second round trip gave different bytes")
+	}
+}
+
+
+func TestExtraChunksBeforeData(t *testing.T) {
+
+	// Chunks before the data are kept too, though Save() moves them after it.
+
+	unknown := RawChunk{[4]byte{'b', 'e', 'x', 't'}, []byte("odd")}
+	full := raw_wav(stereo16_fmt(), make([]byte, 40))
+
+	var file []byte
+	file = append(file, full[:36]...)			// RIFF header and fmt chunk
+	file = append(file, with_chunks(full[:12], unknown)[12:]...)
+	file = append(file, full[36:]...)			// The data chunk
+	binary.LittleEndian.PutUint32(file[4:8], uint32(len(file) - 8))
+
+	wav, err := LoadBytes(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := LoadBytes(wav.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(again.ExtraChunks) != 1 || again.ExtraChunks[0].ID != unknown.ID || !bytes.Equal(again.ExtraChunks[0].Data, unknown.Data) {
+		t.Fatalf("the chunk before the data wasn't kept: %v", again.ExtraChunks)
+	}
+	if !again.Equal(wav) || again.FrameCount() != 10 {
+		t.Fatalf("the audio changed")
+	}
+}
+
+
+func TestRIFFSizeUnderstated(t *testing.T) {
+
+	// A RIFF size covering only the header and fmt chunk, as a streaming writer might leave it:
+	// the whole file still loads, and the discrepancy is noted.
+
+	file := with_chunks(raw_wav(stereo16_fmt(), make([]byte, 400)), RawChunk{[4]byte{'a', 'b', 'c', 'd'}, []byte{1}})
+	binary.LittleEndian.PutUint32(file[4:8], 4 + 24)
+
+	for _, load := range []func() (*WAV, error){
+		func() (*WAV, error) { return LoadBytes(file) },
+		func() (*WAV, error) { return Load(temp_file(t, file)) },
+	} {
+		wav, err := load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wav.FrameCount() != 100 || len(wav.ExtraChunks) != 1 {
+			t.Fatalf("loaded %d frames and %d extra chunks, expected 100 and 1", wav.FrameCount(), len(wav.ExtraChunks))
+		}
+		if len(wav.Warnings) != 1 || !strings.Contains(wav.Warnings[0].Error(), "RIFF size") {
+			t.Fatalf("expected a warning about the RIFF size, got %v", wav.Warnings)
+		}
+	}
+
+	// Through a reader that can't tell how much is left, there's nothing to compare with.
+
+	wav, err := LoadReader(struct{ io.Reader }{bytes.NewReader(file)})
+	if err != nil || wav.FrameCount() != 100 || len(wav.Warnings) != 0 {
+		t.Fatalf("from a plain reader: %d frames, warnings %v, error %v", wav.FrameCount(), wav.Warnings, err)
+	}
+}
+
+
+func TestTrailingBytes(t *testing.T) {
+
+	// A few stray bytes after the last chunk, too few for a chunk header, are reported as such.
+
+	file := append(raw_wav(stereo16_fmt(), make([]byte, 40)), 1, 2, 3)
+	binary.LittleEndian.PutUint32(file[4:8], uint32(len(file) - 8))
+
+	wav, err := LoadBytes(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wav.Warnings) != 1 || !strings.Contains(wav.Warnings[0].Error(), "ignoring 3 trailing bytes") {
+		t.Fatalf("expected a warning about 3 trailing bytes, got %v", wav.Warnings)
+	}
+}
+
+
+func TestResampledRoundTrip(t *testing.T) {
+
+	// 44100 to 48000 and back (and the other way) keeps the length to within a frame, however
+	// long the file, and a 440 Hz tone comes back close to the original.
+
+	for _, frames := range []uint32{1, 2, 147, 999, 44100, 1234567} {
+		for _, rates := range [][2]uint32{{44100, 48000}, {48000, 44100}} {
+
+			original, _ := NewWithFormat(frames, rates[0], 2)
+			for n := uint32(0) ; n < frames ; n++ {
+				val := int16(math.Round(10000 * math.Sin(2 * math.Pi * 440 * float64(n) / float64(rates[0]))))
+				original.Set(n, val, -val)
+			}
+
+			there, err := original.Resampled(rates[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			back, err := there.Resampled(rates[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := math.Round(float64(frames) * float64(rates[1]) / float64(rates[0])) ; float64(there.FrameCount()) != want {
+				t.Fatalf("%d frames at %d Hz became %d at %d Hz, expected %v", frames, rates[0], there.FrameCount(), rates[1], want)
+			}
+			if diff := int64(back.FrameCount()) - int64(frames) ; diff < -1 || diff > 1 {
+				t.Fatalf("%d frames at %d Hz came back as %d", frames, rates[0], back.FrameCount())
+			}
+			if back.FmtChunk.SampleRate != rates[0] || there.FmtChunk.ByteRate != rates[1] * 4 {
+				t.Fatalf("the format wasn't updated")
+			}
+
+			if frames < 1000 {
+				continue
+			}
+
+			for n := uint32(0) ; n < min(frames, back.FrameCount()) ; n++ {
+				left, _ := back.Get(n)
+				want, _ := original.Get(n)
+				if abs_diff(int(left), int(want)) > 100 {
+					t.Fatalf("%d frames via %d Hz: frame %d came back as %d, was %d", frames, rates[1], n, left, want)
+				}
+			}
+		}
+	}
+}
+
+
+func TestResampledSameRate(t *testing.T) {
+
+	original := noise_wav(5000, 12)
+
+	same, err := original.Resampled(original.FmtChunk.SampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if same == original || !same.Equal(original) || !bytes.Equal(same.Bytes(), original.Bytes()) {
+		t.Fatalf("resampling to the same rate didn't give an exact copy")
+	}
+
+	same.Set(0, 1, 1)
+	if original.Equal(same) {
+		t.Fatalf("the copy shares its data with the original")
+	}
+}
+
+
+func TestOddDataPadByte(t *testing.T) {
+
+	// 101 bytes of 8-bit mono, then another chunk. On load the pad byte must be skipped for the
+	// next chunk to be found; on save it must be written, and counted in the RIFF size but not in
+	// the data chunk's.
+
+	extra := RawChunk{[4]byte{'X', 'Y', 'Z', 'W'}, []byte("odd")}
+	file := with_chunks(mono8_file(101), extra)
+
+	wav, err := LoadWithOptions(temp_file(t, file), LoadOptions{KeepFormat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.DataChunk.Size != 101 || len(wav.ExtraChunks) != 1 || !bytes.Equal(wav.ExtraChunks[0].Data, extra.Data) {
+		t.Fatalf("loaded %d bytes of audio and chunks %v", wav.DataChunk.Size, wav.ExtraChunks)
+	}
+
+	saved := wav.Bytes()
+
+	data_at := bytes.Index(saved, []byte("data"))
+
+	if size := binary.LittleEndian.Uint32(saved[data_at + 4:]) ; size != 101 {
+		t.Fatalf("saved a data chunk size of %d", size)
+	}
+	if saved[data_at + 8 + 101] != 0 || !bytes.Equal(saved[data_at + 8 + 102:data_at + 8 + 106], []byte("XYZW")) {
+		t.Fatalf("no pad byte between the audio and the next chunk")
+	}
+	if binary.LittleEndian.Uint32(saved[4:8]) != uint32(len(saved) - 8) || len(saved) % 2 != 0 {
+		t.Fatalf("RIFF size %d for a file of %d bytes", binary.LittleEndian.Uint32(saved[4:8]), len(saved))
+	}
+	if !bytes.Equal(saved, file) {
+		t.Fatalf("saving changed the file")
+	}
+}
+
+
+func TestOddDataMissingPadByte(t *testing.T) {
+
+	// Some writers leave out the pad byte when the data chunk is last; the audio is all there.
+
+	file := mono8_file(101)
+	file = file[:len(file) - 1]
+	binary.LittleEndian.PutUint32(file[4:8], uint32(len(file) - 8))
+
+	wav, err := LoadWithOptions(temp_file(t, file), LoadOptions{KeepFormat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.DataChunk.Size != 101 || len(wav.Warnings) != 0 {
+		t.Fatalf("loaded %d bytes of audio, warnings %v", wav.DataChunk.Size, wav.Warnings)
+	}
+	if saved := wav.Bytes() ; len(saved) != len(file) + 1 || saved[len(saved) - 1] != 0 {
+		t.Fatalf("the pad byte wasn't restored on saving")
+	}
+}
+
+
+func TestValidateSentinels(t *testing.T) {
+
+	// Each fault on its own gives its own sentinel, and only that one.
+
+	sentinels := []error{ErrFmtSize, ErrAudioFormat, ErrFmtExtension, ErrFloatBits, ErrNumChannels,
+		ErrByteRate, ErrBlockAlign, ErrZeroBlockAlign, ErrDataSize, ErrDataAlign}
+
+	cases := []struct {
+		want error
+		spoil func(wav *WAV)
+	}{
+		{ErrFmtSize, func(wav *WAV) { wav.FmtChunk.Size = 18 }},
+		{ErrAudioFormat, func(wav *WAV) { wav.FmtChunk.AudioFormat = 2 }},
+		{ErrFmtExtension, func(wav *WAV) { wav.FmtExtension = []byte{1, 0, 0} ; wav.FmtChunk.Size = 19 }},
+		{ErrFloatBits, func(wav *WAV) { wav.FmtChunk.AudioFormat = 3 }},
+		{ErrNumChannels, func(wav *WAV) {
+			wav.FmtChunk.NumChannels = 4 ; wav.FmtChunk.BlockAlign = 8 ; wav.FmtChunk.ByteRate = 44100 * 8
+		}},
+		{ErrByteRate, func(wav *WAV) { wav.FmtChunk.ByteRate = 44100 }},
+		{ErrBlockAlign, func(wav *WAV) { wav.FmtChunk.BlockAlign = 2 }},
+		{ErrDataSize, func(wav *WAV) { wav.DataChunk.Size -= 4 }},
+		{ErrDataAlign, func(wav *WAV) { wav.DataChunk.Data = wav.DataChunk.Data[:38] ; wav.DataChunk.Size = 38 }},
+	}
+
+	if err := New(10).Validate(); err != nil {
+		t.Fatalf("a new WAV failed: %v", err)
+	}
+
+	for _, c := range cases {
+
+		wav := New(10)
+		c.spoil(wav)
+
+		err := wav.Validate()
+
+		for _, sentinel := range sentinels {
+			if errors.Is(err, sentinel) != (sentinel == c.want) {
+				t.Errorf("spoiling for %q gave %v", c.want, err)
+				break
+			}
+		}
+	}
+
+	// A zero block align is also a wrong one, but must be told apart, since FrameCount() divides by it.
+
+	wav := New(10)
+	wav.FmtChunk.BlockAlign = 0
+
+	if err := wav.Validate() ; !errors.Is(err, ErrZeroBlockAlign) || errors.Is(err, ErrDataAlign) {
+		t.Errorf("block align 0 gave %v", err)
+	}
+
+	// Several faults at once are all reported.
+
+	wav = New(10)
+	wav.FmtChunk.ByteRate = 1
+	wav.DataChunk.Size = 3
+
+	if err := wav.Validate() ; !errors.Is(err, ErrByteRate) || !errors.Is(err, ErrDataSize) || !errors.Is(err, ErrDataAlign) {
+		t.Errorf("three faults gave %v", err)
+	}
+}
+
+
+func TestPCMReaderSplitFrames(t *testing.T) {
+
+	// Buffer sizes that aren't multiples of a frame (or of the header) must still give exactly the
+	// right bytes, in order, and then io.EOF.
+
+	wav := noise_wav(1001, 31)
+
+	readers := map[string]struct {
+		open func() *PCMReader
+		want []byte
+	}{
+		"NewPCMReader": {func() *PCMReader { return NewPCMReader(wav) }, wav.DataChunk.Data},
+		"NewWAVReader": {func() *PCMReader { return NewWAVReader(wav) }, wav.Bytes()},
+	}
+
+	for name, r := range readers {
+		for _, size := range []int{1, 3, 5, 7, 43, 4096} {
+
+			reader := r.open()
+			buf := make([]byte, size)
+			var got []byte
+
+			for {
+				n, err := reader.Read(buf)
+				got = append(got, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil || n == 0 {
+					t.Fatalf("%s, %d byte reads: Read() gave %d, %v", name, size, n, err)
+				}
+			}
+
+			if !bytes.Equal(got, r.want) {
+				t.Fatalf("%s, %d byte reads: got %d bytes, not the %d expected", name, size, len(got), len(r.want))
+			}
+		}
+
+		// Seeking into the middle of a frame, then reading across the next.
+
+		reader := r.open()
+
+		if pos, err := reader.Seek(2001, io.SeekStart) ; pos != 2001 || err != nil {
+			t.Fatalf("%s: Seek() gave %d, %v", name, pos, err)
+		}
+
+		buf := make([]byte, 6)
+		if n, _ := reader.Read(buf) ; n != 6 || !bytes.Equal(buf, r.want[2001:2007]) || reader.Len() != len(r.want) - 2007 {
+			t.Fatalf("%s: read %v after seeking, expected %v", name, buf[:n], r.want[2001:2007])
+		}
+	}
+}
+
+
+func TestThen(t *testing.T) {
+
+	// Value-returning methods chain through Then(). The first failing step is the error reported,
+	// later steps and chainable methods are skipped, and ClearErr() starts things afresh.
+
+	wav := test_wav(1000)
+	want := wav.Copy().FadeInSamples(64)
+	want.FadeRange(500, 1000, 1, 0)
+
+	err := wav.FadeInSamples(64).Then(func(w *WAV) error {
+		w.FadeRange(500, 1000, 1, 0)
+		return nil
+	}).Err()
+
+	if err != nil || !wav.Equal(want) {
+		t.Fatalf("a successful chain gave %v, or the wrong audio", err)
+	}
+
+	ran := false
+
+	err = wav.Then(func(w *WAV) error {
+		_, err := w.EQ3(3, 3, 3, 4000, 200)		// Crossovers the wrong way round
+		return err
+	}).Then(func(w *WAV) error {
+		ran = true
+		return nil
+	}).FadeSamples(100).Then(nil).Err()
+
+	if err == nil || !strings.HasPrefix(err.Error(), "EQ3()") || ran || !wav.Equal(want) {
+		t.Fatalf("a failing chain gave %v, ran later steps %v, or changed the audio", err, ran)
+	}
+
+	wav.ClearErr()
+
+	if err := wav.Then(nil).Err() ; err == nil || !strings.HasPrefix(err.Error(), "Then()") {
+		t.Fatalf("a nil step gave %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package wavmaker
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const data_uri_prefix = "data:audio/wav;base64,"
+
+// ------------------------------------- EXPOSED METHODS
+
+
+func (wav *WAV) DataURI(max_bytes int64) (string, error) {
+
+	// Returns the whole file (as Save() would write it) as a base64 data URI, suitable for an
+	// <audio> src attribute. If the file would be more than max_bytes long (before encoding),
+	// nothing is encoded and an error is returned. A max_bytes of 0 means no limit.
+
+	size := wav.encoded_size()
+
+	if max_bytes > 0 && size > max_bytes {
+		return "", fmt.Errorf("DataURI(): WAV is %d bytes, more than the limit of %d", size, max_bytes)
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(data_uri_prefix) + base64.StdEncoding.EncodedLen(int(size)))
+	sb.WriteString(data_uri_prefix)
+
+	// Encode straight from the WAV's own buffers, rather than building the file first.
+
+	encoder := base64.NewEncoder(base64.StdEncoding, &sb)
+
+	_, err := wav.WriteTo(encoder)
+	if err != nil {
+		return "", fmt.Errorf("DataURI(): %w", err)
+	}
+
+	err = encoder.Close()		// Flushes the final partial group
+	if err != nil {
+		return "", fmt.Errorf("DataURI(): %w", err)
+	}
+
+	return sb.String(), nil
+}
+
+
+func (wav *WAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	// Implements http.Handler, serving the file as Save() would write it. The heavy lifting (Range
+	// requests, HEAD, Content-Length, If-None-Match) is done by http.ServeContent; the body is read
+	// straight from the WAV's buffers so nothing is copied. The ETag is a hash of the whole file,
+	// metadata chunks included, so that ranges from different versions are never mixed.
+
+	hasher := sha256.New()
+	wav.WriteTo(hasher)		// Can't fail
+
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Header().Set("ETag", fmt.Sprintf("\"%x\"", hasher.Sum(nil)[:16]))
+
+	http.ServeContent(w, r, "", time.Time{}, NewWAVReader(wav))
+}